@@ -7,13 +7,13 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 )
 
-func getAllianceLedgerKey(cID uint32) string {
-	return fmt.Sprintf("alliance%v", cID)
-}
-
+// HandleInit proposes the alliance, signed by one of the allies. The
+// alliance is formed once every other ally accepted it.
 func HandleInit(APIstub shim.ChaincodeStubInterface) pb.Response {
 	log.Println("Hadling alliance init")
 	protoArgs := APIstub.GetArgs()[1]
@@ -25,30 +25,39 @@ func HandleInit(APIstub shim.ChaincodeStubInterface) pb.Response {
 	}
 
 	allianceData := trxArgs.InitPayload
+	if allianceData == nil {
+		return shim.Error("missing the alliance data")
+	}
 	allianceData.State = tfcPb.AllianceState_ACTIVE
 
-	// the lifespan will be reduced by one after the first next,
-	// so just add one up. No harm done
-	allianceData.Lifespan++
+	meta, err := newAllianceMeta(APIstub.GetArgs(), *trxArgs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	protoData, err := proto.Marshal(allianceData)
 	if err != nil {
 		return shim.Error(
 			fmt.Sprintf("could not marshal the alliance data <%v>: %s", allianceData, err))
 	}
 
-	allianceContractID := allianceData.ContractID
-	ledgerKey := getAllianceLedgerKey(allianceContractID)
-	// Cannot put private data in the init...
+	collection, err := trxCollection(*trxArgs, meta.Allies)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = assertMember(APIstub, collection)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	log.Println("Putting state on ledger....")
-	collection := trxArgs.CollectionID
-	err = APIstub.PutPrivateData(collection, ledgerKey, protoData)
+	proposal, err := propose(APIstub, collection, allianceData, protoData, meta)
 	if err != nil {
-		return shim.Error(
-			fmt.Sprintf("could not save the state on the ledger: %s", err))
+		return shim.Error(err.Error())
 	}
 	log.Printf("Saved state on the ledger. \n\n\t ###### State: #####\n %v\n\n", protoData)
 
-	return shim.Success(protoData)
+	return proposalResponse(proposal)
 }
 
 func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
@@ -62,24 +71,32 @@ func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 			fmt.Sprintf("could not unmarshal arguments proto message <%v>: %s", protoArgs, err))
 	}
 
-	// TODO: Assert preconditions
-
 	trxArgs := alliTrxArgs.InvokePayload
-	allianceContractID := trxArgs.ObserverID
-	ledgerKey := getAllianceLedgerKey(allianceContractID)
-	collection := alliTrxArgs.CollectionID
-
-	allianceData, err := getAllianceLedgerData(APIstub, collection, ledgerKey)
+	collection, err := trxCollection(*alliTrxArgs, alliTrxArgs.Allies)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	err = assertMember(APIstub, collection)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allianceData, moves, err := assertInvokePrecond(APIstub, collection, trxArgs)
+	if err != nil {
+		return shim.Error(
+			fmt.Sprintf("alliance preconditions not met: %s", err))
+	}
 
-	newAllianceData := reduceAllianceTerms(*allianceData, trxArgs.CompletedTrxArgs)
-	newAllianceData = reduceLifespan(newAllianceData, trxArgs)
+	allianceContractID := trxArgs.ObserverID
 
-	newAllianceState := computeNextAllianceState(newAllianceData, trxArgs.State)
+	meta, err := getAllianceMeta(APIstub, collection, allianceContractID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	newAllianceData.State = newAllianceState
+	newAllianceData, newMeta, err := applyMoves(*allianceData, meta, moves)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	protoData, err := proto.Marshal(&newAllianceData)
 	if err != nil {
 		return shim.Error(
@@ -87,10 +104,18 @@ func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 	}
 
 	log.Println("Finished invoke..putting state on the ledger")
-	err = APIstub.PutPrivateData(collection, ledgerKey, protoData)
+	err = putAllianceRecord(APIstub, collection, ALLIANCE_INDEX, allianceContractID, protoData)
 	if err != nil {
-		return shim.Error(
-			fmt.Sprintf("could not save the state on the ledger: %s", err))
+		return shim.Error(err.Error())
+	}
+
+	err = putAllianceMeta(APIstub, collection, allianceContractID, newMeta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putNextTrx(APIstub, collection, allianceContractID, trxArgs.LastTrxId+1)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	log.Printf("Saved state on the ledger. \n\n\t ###### State: #####\n %v\n\n", protoData)
@@ -98,53 +123,96 @@ func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 
 }
 
-func reduceAllianceTerms(allianceData tfcPb.AllianceData, trxArgs *tfcPb.GameContractTrxArgs) tfcPb.AllianceData {
+// applyMoves plays the logged moves on the alliance, in order, so that
+// the moves skipped by the client count as well. The moves made after
+// the alliance is completed or failed are ignored.
+func applyMoves(allianceData tfcPb.AllianceData, meta allianceMeta,
+	moves []tfc.MoveRecord) (tfcPb.AllianceData, allianceMeta, error) {
+
+	if len(meta.Owners) != len(allianceData.Terms) {
+		return allianceData, meta, fmt.Errorf("alliance %v has %v terms, but %v term owners",
+			allianceData.ContractID, len(allianceData.Terms), len(meta.Owners))
+	}
+
+	gb, err := boardGeometry()
+	if err != nil {
+		return allianceData, meta, err
+	}
 
-	newTerms := []*tfcPb.GameContractTrxArgs{}
-	for i := range allianceData.Terms {
-		if proto.Equal(allianceData.Terms[i], trxArgs) {
+	for _, move := range moves {
+		if allianceData.State != tfcPb.AllianceState_ACTIVE {
+			break
+		}
+		if move.Settlement != nil {
 			continue
 		}
 
-		newTerms = append(newTerms, allianceData.Terms[i])
+		trxArgs, err := move.TrxArgs()
+		if err != nil {
+			return allianceData, meta, err
+		}
+		allianceData, meta = reduceAllianceTerms(allianceData, meta, gb, trxArgs, move.Player)
+		allianceData = reduceLifespan(allianceData, meta, move)
+		allianceData.State = computeNextAllianceState(allianceData, meta)
 	}
-
-	allianceData.Terms = newTerms
-	return allianceData
+	return allianceData, meta, nil
 }
 
-func reduceLifespan(allianceData tfcPb.AllianceData, args *tfcPb.TrxCompletedArgs) tfcPb.AllianceData {
-
-	if args.State != allianceData.StartGameState {
-		return allianceData
-	}
+// reduceLifespan sets the lifespan to the rounds left until the alliance
+// ends, as counted by the game. The alliance ends with the game as well.
+func reduceLifespan(allianceData tfcPb.AllianceData, meta allianceMeta,
+	move tfc.MoveRecord) tfcPb.AllianceData {
 
-	if args.CompletedTrxArgs.Type != tfcPb.GameTrxType_NEXT {
+	if _, won := engine.Winner(move.State); won || move.Round >= meta.EndRound {
+		allianceData.Lifespan = 0
 		return allianceData
 	}
 
-	allianceData.Lifespan--
+	allianceData.Lifespan = int32(meta.EndRound - move.Round)
 	return allianceData
 }
 
-func computeNextAllianceState(allianceData tfcPb.AllianceData, gameState tfcPb.GameState) tfcPb.AllianceState {
-	if len(allianceData.Terms) == 0 {
+// computeNextAllianceState completes the alliance once every term is
+// fulfilled. Alliances holding prohibitions complete only once their
+// lifespan is over, and fail as soon as a prohibition is broken. Allies
+// can end the alliance early, by betraying it, or dissolving it together.
+func computeNextAllianceState(allianceData tfcPb.AllianceData, meta allianceMeta) tfcPb.AllianceState {
+	if meta.Betrayer != nil {
+		return BETRAYED
+	}
+
+	if len(meta.Allies) > 0 && len(meta.Dissolving) == len(meta.Allies) {
+		return DISSOLVED
+	}
+
+	if len(meta.Broken) > 0 {
+		return tfcPb.AllianceState_FAILED
+	}
+
+	owed := len(allianceData.Terms) + owedPredicates(meta)
+	if owed == 0 && len(meta.Predicates) == 0 {
 		return tfcPb.AllianceState_COMPLETED
 	}
 
 	if allianceData.Lifespan == 0 {
+		if owed == 0 {
+			return tfcPb.AllianceState_COMPLETED
+		}
 		return tfcPb.AllianceState_FAILED
 	}
 
 	return tfcPb.AllianceState_ACTIVE
 }
 
-func getAllianceLedgerData(APIstub shim.ChaincodeStubInterface, collection, ledgerKey string) (*tfcPb.AllianceData, error) {
+func getAllianceLedgerData(APIstub shim.ChaincodeStubInterface, collection string, cID uint32) (*tfcPb.AllianceData, error) {
 
-	protoData, err := APIstub.GetPrivateData(collection, ledgerKey)
+	protoData, err := getAllianceRecord(APIstub, collection, ALLIANCE_INDEX, cID)
 	if err != nil {
 		return nil, err
 	}
+	if protoData == nil {
+		return nil, fmt.Errorf("alliance %v does not exist", cID)
+	}
 
 	allianceData := &tfcPb.AllianceData{}
 	err = proto.Unmarshal(protoData, allianceData)
@@ -1,6 +1,7 @@
 package alliance
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
@@ -12,31 +13,181 @@ import (
 	"github.com/golang/protobuf/proto"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 )
 
-var AllianceCollection = "alliances"
+// AllianceCollection is the collection of red and green, the default allies.
+var AllianceCollection = "RG"
 
 // Dummy struct for hyperledger
 type MockContract struct {
 }
 
 func (gc *MockContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
-	return HandleInit(APIstub)
+	return HandleInstantiate(APIstub)
 }
 
-func (gc *MockContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+// Invoke dispatches like the alliance chaincode does, on a stub which
+// only lets the members of a collection access it
+func (gc *MockContract) Invoke(mockStub shim.ChaincodeStubInterface) pb.Response {
+	APIstub := &collectionStub{privateQueryStub{mockStub.(*shim.MockStub)}}
+	switch string(APIstub.GetArgs()[0]) {
+	case SETTLEMENT_FCN:
+		return HandleSettlement(APIstub)
+	case PROGRESS_FCN:
+		return HandleProgress(APIstub)
+	case PROPOSAL_FCN:
+		return HandleProposal(APIstub)
+	case ACCEPT_FCN:
+		return HandleAccept(APIstub)
+	case REJECT_FCN:
+		return HandleReject(APIstub)
+	case ALLIANCE_FCN:
+		return HandleAlliance(APIstub)
+	case ALLIANCES_FCN:
+		return HandleAlliances(APIstub)
+	case DISSOLVE_FCN:
+		return HandleDissolve(APIstub)
+	case BETRAY_FCN:
+		return HandleBetray(APIstub)
+	}
+
+	trxArgs := &tfcPb.AllianceTrxArgs{}
+	err := proto.Unmarshal(APIstub.GetArgs()[1], trxArgs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if trxArgs.Type == tfcPb.AllianceTrxType_INIT {
+		return HandleInit(APIstub)
+	}
 	return HandleInvoke(APIstub)
 }
 
-func initContract(t *testing.T, cUUID uint32, terms ...*tfcPb.GameContractTrxArgs) *shim.MockStub {
+// playerIdentity is the identity of the player, issued by the MSP of its
+// organization.
+func playerIdentity(p tfcPb.Player) []byte {
+	return mspIdentity(DefaultPlayerMSPs[p], p.String())
+}
+
+func mspIdentity(mspID, name string) []byte {
+	identity, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: []byte(name)})
+	return identity
+}
+
+// playerProposal signs as the player, with the player identity as
+// signature, which the mock stub returns as the creator.
+func playerProposal(p tfcPb.Player) *pb.SignedProposal {
+	return &pb.SignedProposal{ProposalBytes: []byte{}, Signature: playerIdentity(p)}
+}
+
+// gameLog stands in for the TFC chaincode, answering the move log query
+// with the moves played so far, the game ID query, and the player query
+// of the creators signing with playerProposal.
+type gameLog struct {
+	id    string
+	moves []tfc.MoveRecord
+}
+
+// testGameID is the ID of the games which were not given one.
+const testGameID = "01010101"
+
+func (gl *gameLog) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (gl *gameLog) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	switch string(args[0]) {
+	case tfc.MOVES_FCN:
+		jsonData, err := json.Marshal(gl.moves)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(jsonData)
+	case tfc.GAME_FCN:
+		if gl.id == "" {
+			return shim.Success([]byte(testGameID))
+		}
+		return shim.Success([]byte(gl.id))
+	case tfc.PLAYER_FCN:
+		for pID := range tfcPb.Player_name {
+			p := tfcPb.Player(pID)
+			if string(tfc.CreatorSign(playerIdentity(p))) == string(args[1]) {
+				return shim.Success([]byte(p.String()))
+			}
+		}
+		return shim.Error("unknown creator")
+	}
+	return shim.Error("unexpected function")
+}
+
+// play logs the move of red in the game, and returns its sequence number.
+func (gl *gameLog) play(t *testing.T, state tfcPb.GameState, trxArgs *tfcPb.GameContractTrxArgs) uint32 {
+	return gl.playAs(t, tfcPb.Player_RED, state, trxArgs)
+}
+
+func (gl *gameLog) playAs(t *testing.T, p tfcPb.Player, state tfcPb.GameState,
+	trxArgs *tfcPb.GameContractTrxArgs) uint32 {
+
+	return gl.move(t, p, state, state, trxArgs)
+}
+
+// endRound logs blue passing the turn on to red, which ends the round.
+func (gl *gameLog) endRound(t *testing.T) uint32 {
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	return gl.move(t, tfcPb.Player_BLUE, tfcPb.GameState_BDEV, tfcPb.GameState_RROLL, nextTrx)
+}
+
+// move logs the move of the player, counting the rounds as the game does.
+func (gl *gameLog) move(t *testing.T, p tfcPb.Player, prev, next tfcPb.GameState,
+	trxArgs *tfcPb.GameContractTrxArgs) uint32 {
+
+	args, err := proto.Marshal(trxArgs)
+	require.NoError(t, err)
+
+	seq := uint32(len(gl.moves))
+	round := uint32(0)
+	if seq > 0 {
+		round = gl.moves[seq-1].Round
+	}
+	if engine.RoundEnded(prev, next) {
+		round++
+	}
+	gl.moves = append(gl.moves, tfc.MoveRecord{
+		Seq:       seq,
+		Player:    p,
+		Args:      args,
+		PrevState: prev,
+		State:     next,
+		Round:     round,
+	})
+	return seq
+}
+
+// defaultTerm is the term of the alliances whose terms do not matter, as
+// alliances need at least one term.
+func defaultTerm() *tfcPb.GameContractTrxArgs {
+	return tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+}
+
+func initContract(t *testing.T, cUUID uint32, terms ...*tfcPb.GameContractTrxArgs) (*shim.MockStub, *gameLog) {
 	stub := shim.NewMockStub("mockGameContract", new(MockContract))
 	if stub == nil {
 		t.Fatalf("Failed to init mock")
 	}
 
+	game := &gameLog{}
+	stub.MockPeerChaincode(GAME_CHAINCODE, shim.NewMockStub(GAME_CHAINCODE, game))
+
+	if len(terms) == 0 {
+		terms = []*tfcPb.GameContractTrxArgs{defaultTerm()}
+	}
 	initBuilder := newInitArgsBuilder(cUUID)
 	for _, t := range terms {
 		initBuilder.AddTerm(t)
@@ -44,15 +195,14 @@ func initContract(t *testing.T, cUUID uint32, terms ...*tfcPb.GameContractTrxArg
 
 	err := initBuilder.InitMock(stub)
 	require.NoError(t, err)
-	return stub
+	return stub, game
 }
 
 func TestInitAlliance(t *testing.T) {
 	cuuid := uint32(1010101)
-	stub := initContract(t, cuuid)
+	stub, _ := initContract(t, cuuid)
 
-	ledgerKey := getAllianceLedgerKey(cuuid)
-	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, ledgerKey)
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
 	require.NoError(t, err)
 	log.Println(allianceData)
 
@@ -65,15 +215,16 @@ func TestAllianceCompletes(t *testing.T) {
 		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
 		Args()
 
-	stub := initContract(t, cuuid, term)
+	stub, game := initContract(t, cuuid, term)
+	seq := game.play(t, tfcPb.GameState_RTRADE, term)
 	err := newTrxCompletedBuilder().
 		WithArgs(term).
+		WithTrxID(seq).
 		MockInvoke(stub, cuuid)
 
 	require.NoError(t, err)
 
-	ledgerKey := getAllianceLedgerKey(cuuid)
-	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, ledgerKey)
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
 	require.NoError(t, err)
 	log.Println(allianceData)
 
@@ -87,7 +238,7 @@ func TestAllianceFails(t *testing.T) {
 	initTerm := tfc.NewArgsBuilder().
 		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
 		Args()
-	stub := initContract(t, cuuid, initTerm)
+	stub, game := initContract(t, cuuid, initTerm)
 
 	// randTrx := tfc.NewArgsBuilder().
 	// 	WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_BLUE, tfcPb.Resource_HILL, 5).
@@ -96,15 +247,17 @@ func TestAllianceFails(t *testing.T) {
 		WithNextArgs().Args()
 
 	var err error
-	for l := int32(0); l < lifespan+1; l++ {
+	for l := int32(0); l < lifespan; l++ {
+		seq := game.endRound(t)
 		err = newTrxCompletedBuilder().
 			WithArgs(nextTrx).
+			WithState(tfcPb.GameState_BDEV).
+			WithTrxID(seq).
 			MockInvoke(stub, cuuid)
 		require.NoError(t, err)
 	}
 
-	ledgerKey := getAllianceLedgerKey(cuuid)
-	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, ledgerKey)
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
 	require.NoError(t, err)
 	log.Println(allianceData)
 
@@ -112,8 +265,278 @@ func TestAllianceFails(t *testing.T) {
 	require.Equal(t, allianceData.State, tfcPb.AllianceState_FAILED)
 }
 
+func TestAllianceLifespanCountsRounds(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	stub, game := initContract(t, cuuid, term)
+
+	// Passing the turn within the round does not count
+	seq := game.play(t, tfcPb.GameState_RDEV, nextTrx)
+	err := newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithState(tfcPb.GameState_RDEV).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, lifespan, allianceData.Lifespan)
+
+	seq = game.endRound(t)
+	err = newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithState(tfcPb.GameState_BDEV).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allianceData, err = getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, lifespan-1, allianceData.Lifespan)
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, allianceData.State)
+}
+
+func TestAllianceExpiresWithGame(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	stub, game := initContract(t, cuuid, term)
+
+	seq := game.move(t, tfcPb.Player_RED, tfcPb.GameState_RDEV, tfcPb.GameState_RWON, nextTrx)
+	err := newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithState(tfcPb.GameState_RDEV).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Zero(t, allianceData.Lifespan)
+	require.Equal(t, tfcPb.AllianceState_FAILED, allianceData.State)
+}
+
+func TestAllianceAppliesSkippedMoves(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	stub, game := initContract(t, cuuid, term)
+
+	// Only the last move is reported, the trade still completes the alliance
+	game.play(t, tfcPb.GameState_RTRADE, term)
+	seq := game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+	err := newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Empty(t, allianceData.Terms)
+	require.Equal(t, tfcPb.AllianceState_COMPLETED, allianceData.State)
+}
+
+func TestAllianceIgnoresEarlierMoves(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+
+	game := &gameLog{}
+	earlier := game.play(t, tfcPb.GameState_RTRADE, term)
+
+	stub := shim.NewMockStub("mockGameContract", new(MockContract))
+	stub.MockPeerChaincode(GAME_CHAINCODE, shim.NewMockStub(GAME_CHAINCODE, game))
+	err := newInitArgsBuilder(cuuid).AddTerm(term).InitMock(stub)
+	require.NoError(t, err)
+
+	// The trade was made before the alliance was formed
+	err = newTrxCompletedBuilder().
+		WithArgs(term).
+		WithTrxID(earlier).
+		MockInvoke(stub, cuuid)
+	require.Error(t, err)
+
+	seq := game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+	err = newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Len(t, allianceData.Terms, 1)
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, allianceData.State)
+}
+
+func TestAllianceRejectsUnknownTrx(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	stub, game := initContract(t, cuuid, term)
+
+	// Nothing was played yet
+	err := newTrxCompletedBuilder().
+		WithArgs(term).
+		MockInvoke(stub, cuuid)
+	require.Error(t, err)
+
+	// The move at the sequence number is a different one
+	seq := game.play(t, tfcPb.GameState_RTRADE, tfc.NewArgsBuilder().WithNextArgs().Args())
+	err = newTrxCompletedBuilder().
+		WithArgs(term).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.Error(t, err)
+
+	// The move was made in another state
+	seq = game.play(t, tfcPb.GameState_RDEV, term)
+	err = newTrxCompletedBuilder().
+		WithArgs(term).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.Error(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Len(t, allianceData.Terms, 1)
+	require.Equal(t, lifespan, allianceData.Lifespan)
+}
+
+func TestAllianceRejectsUnknownObserver(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	stub, game := initContract(t, cuuid)
+	seq := game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+
+	err := newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid+1)
+	require.Error(t, err)
+}
+
+func TestAllianceRejectsReplay(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	stub, game := initContract(t, cuuid, term)
+
+	seq := game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+	err := newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	err = newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.Error(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, lifespan, allianceData.Lifespan)
+}
+
+func TestFinishedAllianceRejectsTrx(t *testing.T) {
+	cuuid := uint32(1010101)
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	stub, game := initContract(t, cuuid, term)
+
+	seq := game.play(t, tfcPb.GameState_RTRADE, term)
+	err := newTrxCompletedBuilder().
+		WithArgs(term).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	seq = game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+	err = newTrxCompletedBuilder().
+		WithArgs(nextTrx).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.Error(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.AllianceState_COMPLETED, allianceData.State)
+}
+
+func TestAllianceIgnoresReinitializedGame(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green := tfcPb.Player_RED, tfcPb.Player_GREEN
+
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).
+		Args()
+	stub, game := initContract(t, cuuid, term)
+
+	proposed := uint32(2020202)
+	_, err := newInitArgsBuilder(proposed).AddTerm(term).ProposeMock(stub, red)
+	require.NoError(t, err)
+
+	// The game is initialized again, and the same move is played in it
+	game.id = "02020202"
+	game.moves = nil
+	seq := game.play(t, tfcPb.GameState_RTRADE, term)
+
+	err = newTrxCompletedBuilder().
+		WithArgs(term).
+		WithTrxID(seq).
+		MockInvoke(stub, cuuid)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not the current game")
+
+	_, err = endMock(stub, DISSOLVE_FCN, AllianceCollection, cuuid, red)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not the current game")
+
+	_, err = answerMock(stub, ACCEPT_FCN, proposed, green)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not the current game")
+
+	_, err = queryProposal(stub, proposed)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not the current game")
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, allianceData.State)
+	require.NotEmpty(t, allianceData.Terms)
+}
+
 type initArgsBuilder struct {
 	allianceData *tfcPb.AllianceData
+	allies       []tfcPb.Player
+	terms        *initTerms
+	turns        []byte
 }
 
 var lifespan = int32(3)
@@ -125,7 +548,28 @@ func newInitArgsBuilder(cUUID uint32) *initArgsBuilder {
 		Terms:          []*tfcPb.GameContractTrxArgs{},
 		ContractID:     cUUID,
 	}
-	return &initArgsBuilder{ad}
+	return &initArgsBuilder{ad, []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN}, nil, nil}
+}
+
+func (ab *initArgsBuilder) WithTurns(turns uint32) *initArgsBuilder {
+	ab.turns = []byte(strconv.FormatUint(uint64(turns), 10))
+	return ab
+}
+
+func (ab *initArgsBuilder) WithStakes(stakes Stakes) *initArgsBuilder {
+	if ab.terms == nil {
+		ab.terms = &initTerms{}
+	}
+	ab.terms.Stakes = stakes
+	return ab
+}
+
+func (ab *initArgsBuilder) AddPredicate(p Predicate) *initArgsBuilder {
+	if ab.terms == nil {
+		ab.terms = &initTerms{}
+	}
+	ab.terms.Predicates = append(ab.terms.Predicates, p)
+	return ab
 }
 
 func (ab *initArgsBuilder) AddTerm(term *tfcPb.GameContractTrxArgs) *initArgsBuilder {
@@ -133,28 +577,76 @@ func (ab *initArgsBuilder) AddTerm(term *tfcPb.GameContractTrxArgs) *initArgsBui
 	return ab
 }
 
-func (ab *initArgsBuilder) InitMock(stub *shim.MockStub) error {
-
+// ProposeMock proposes the alliance, signed by the proposer.
+func (ab *initArgsBuilder) ProposeMock(stub *shim.MockStub, proposer tfcPb.Player) (Proposal, error) {
 	trxArgs := &tfcPb.AllianceTrxArgs{
-		InitPayload:  ab.allianceData,
-		CollectionID: AllianceCollection,
+		Type:        tfcPb.AllianceTrxType_INIT,
+		InitPayload: ab.allianceData,
+		Allies:      ab.allies,
 	}
 	protoData, err := proto.Marshal(trxArgs)
 	if err != nil {
-		return err
+		return Proposal{}, err
+	}
+
+	args := [][]byte{[]byte("test"), protoData}
+	if ab.terms != nil || ab.turns != nil {
+		var terms []byte
+		if ab.terms != nil {
+			terms, _ = json.Marshal(ab.terms)
+		}
+		args = append(args, terms, ab.turns)
 	}
 
 	trxID := fmt.Sprintf("%v", ab.allianceData.ContractID)
-	r := stub.MockInit(trxID, [][]byte{[]byte("test"), protoData})
+	r := stub.MockInvokeWithSignedProposal(trxID, args, playerProposal(proposer))
+	return proposalResult(r)
+}
 
-	if r.GetStatus() != shim.OK {
-		return fmt.Errorf("Could not init the contract. Error: %s", r.Message)
+// InitMock proposes the alliance as the first ally, and accepts it for
+// all others.
+func (ab *initArgsBuilder) InitMock(stub *shim.MockStub) error {
+	proposal, err := ab.ProposeMock(stub, ab.allies[0])
+	if err != nil {
+		return err
+	}
+
+	collection, err := CollectionName(proposal.Allies)
+	if err != nil {
+		return err
+	}
+	for _, p := range proposal.Allies[1:] {
+		_, err = answerInMock(stub, ACCEPT_FCN, collection, ab.allianceData.ContractID, p)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func answerMock(stub *shim.MockStub, fcn string, cID uint32, p tfcPb.Player) (Proposal, error) {
+	return answerInMock(stub, fcn, AllianceCollection, cID, p)
+}
+
+func answerInMock(stub *shim.MockStub, fcn, collection string, cID uint32, p tfcPb.Player) (Proposal, error) {
+	r := stub.MockInvokeWithSignedProposal(fcn+p.String(), [][]byte{[]byte(fcn),
+		[]byte(collection), []byte(strconv.FormatUint(uint64(cID), 10))}, playerProposal(p))
+	return proposalResult(r)
+}
+
+func proposalResult(r pb.Response) (Proposal, error) {
+	proposal := Proposal{}
+	if r.GetStatus() != shim.OK {
+		return proposal, fmt.Errorf("Could not answer the proposal. Error: %s", r.Message)
+	}
+
+	err := json.Unmarshal(r.Payload, &proposal)
+	return proposal, err
+}
+
 type trxCompletedBuilder struct {
 	trxCompletedArgs *tfcPb.TrxCompletedArgs
+	allies           []tfcPb.Player
 }
 
 func newTrxCompletedBuilder() *trxCompletedBuilder {
@@ -162,20 +654,37 @@ func newTrxCompletedBuilder() *trxCompletedBuilder {
 		trxCompletedArgs: &tfcPb.TrxCompletedArgs{
 			State: tfcPb.GameState_RTRADE,
 		},
+		allies: []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN},
 	}
 }
 
+func (tcb *trxCompletedBuilder) WithAllies(allies ...tfcPb.Player) *trxCompletedBuilder {
+	tcb.allies = allies
+	return tcb
+}
+
 func (tcb *trxCompletedBuilder) WithArgs(arg *tfcPb.GameContractTrxArgs) *trxCompletedBuilder {
 	tcb.trxCompletedArgs.CompletedTrxArgs = arg
 	return tcb
 }
 
+func (tcb *trxCompletedBuilder) WithState(state tfcPb.GameState) *trxCompletedBuilder {
+	tcb.trxCompletedArgs.State = state
+	return tcb
+}
+
+func (tcb *trxCompletedBuilder) WithTrxID(seq uint32) *trxCompletedBuilder {
+	tcb.trxCompletedArgs.LastTrxId = seq
+	return tcb
+}
+
 func (tcb *trxCompletedBuilder) MockInvoke(stub *shim.MockStub, observerID uint32) error {
 	tcb.trxCompletedArgs.ObserverID = observerID
 
 	alliTrxArgs := &tfcPb.AllianceTrxArgs{
+		Type:          tfcPb.AllianceTrxType_INVOKE,
 		InvokePayload: tcb.trxCompletedArgs,
-		CollectionID:  AllianceCollection,
+		Allies:        tcb.allies,
 	}
 
 	protoData, err := proto.Marshal(alliTrxArgs)
@@ -185,10 +694,291 @@ func (tcb *trxCompletedBuilder) MockInvoke(stub *shim.MockStub, observerID uint3
 
 	n := rand.Int63()
 	uuid := strconv.FormatInt(n, 8)
-	r := stub.MockInvoke(uuid, [][]byte{[]byte("test"), protoData})
+	r := stub.MockInvokeWithSignedProposal(uuid, [][]byte{[]byte("test"), protoData},
+		playerProposal(tfcPb.Player_RED))
 
 	if r.GetStatus() != shim.OK {
 		return fmt.Errorf("Could not init the contract. Error: %s", r.Message)
 	}
 	return nil
 }
+
+func querySettlement(stub *shim.MockStub, cuuid uint32) (engine.Settlement, error) {
+	settlement := engine.Settlement{}
+	r := stub.MockInvokeWithSignedProposal("settlement", [][]byte{[]byte(SETTLEMENT_FCN),
+		[]byte(AllianceCollection), []byte(strconv.FormatUint(uint64(cuuid), 10))},
+		playerProposal(tfcPb.Player_RED))
+	if r.GetStatus() != shim.OK {
+		return settlement, fmt.Errorf("Could not query the settlement. Error: %s", r.Message)
+	}
+
+	err := json.Unmarshal(r.Payload, &settlement)
+	return settlement, err
+}
+
+func TestAllianceSettlement(t *testing.T) {
+	red, green := tfcPb.Player_RED, tfcPb.Player_GREEN
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).
+		Args()
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	stakes := Stakes{Reward: 2, Penalty: 1}
+
+	newAlliance := func(cuuid uint32) (*shim.MockStub, *gameLog) {
+		stub := shim.NewMockStub("mockGameContract", new(MockContract))
+		game := &gameLog{}
+		stub.MockPeerChaincode(GAME_CHAINCODE, shim.NewMockStub(GAME_CHAINCODE, game))
+		err := newInitArgsBuilder(cuuid).AddTerm(term).WithStakes(stakes).InitMock(stub)
+		require.NoError(t, err)
+		return stub, game
+	}
+
+	// Active alliances have nothing to settle yet
+	stub, game := newAlliance(1)
+	_, err := querySettlement(stub, 1)
+	require.Error(t, err)
+
+	seq := game.play(t, tfcPb.GameState_RTRADE, term)
+	err = newTrxCompletedBuilder().WithArgs(term).WithTrxID(seq).MockInvoke(stub, 1)
+	require.NoError(t, err)
+
+	settlement, err := querySettlement(stub, 1)
+	require.NoError(t, err)
+	require.Equal(t, engine.Settlement{
+		AllianceID: 1,
+		GameID:     testGameID,
+		Points: map[int32]int32{
+			engine.GetPlayerId(red):   stakes.Reward,
+			engine.GetPlayerId(green): stakes.Reward,
+		},
+	}, settlement)
+
+	// Red never traded, and defected
+	stub, game = newAlliance(2)
+	for l := int32(0); l < lifespan; l++ {
+		seq = game.endRound(t)
+	}
+	err = newTrxCompletedBuilder().WithArgs(nextTrx).WithState(tfcPb.GameState_BDEV).
+		WithTrxID(seq).MockInvoke(stub, 2)
+	require.NoError(t, err)
+
+	settlement, err = querySettlement(stub, 2)
+	require.NoError(t, err)
+	require.Equal(t, engine.Settlement{
+		AllianceID: 2,
+		GameID:     testGameID,
+		Points:     map[int32]int32{engine.GetPlayerId(red): -stakes.Penalty},
+	}, settlement)
+}
+
+func queryProposal(stub *shim.MockStub, cID uint32) (Proposal, error) {
+	r := stub.MockInvokeWithSignedProposal("proposal", [][]byte{[]byte(PROPOSAL_FCN),
+		[]byte(AllianceCollection), []byte(strconv.FormatUint(uint64(cID), 10))},
+		playerProposal(tfcPb.Player_RED))
+	return proposalResult(r)
+}
+
+func newProposalContract(t *testing.T) (*shim.MockStub, *gameLog) {
+	stub := shim.NewMockStub("mockGameContract", new(MockContract))
+	game := &gameLog{}
+	stub.MockPeerChaincode(GAME_CHAINCODE, shim.NewMockStub(GAME_CHAINCODE, game))
+	return stub, game
+}
+
+func TestAllianceRejectsInvalidTerms(t *testing.T) {
+	cuuid := uint32(1010101)
+	red := tfcPb.Player_RED
+	stub, _ := newProposalContract(t)
+
+	// An alliance without terms would complete on the first move
+	_, err := newInitArgsBuilder(cuuid).ProposeMock(stub, red)
+	require.Error(t, err)
+
+	for _, stakes := range []Stakes{
+		{Reward: engine.MAX_STAKE + 1},
+		{Penalty: engine.MAX_STAKE + 1},
+		{Betrayal: engine.MAX_STAKE + 1},
+		{Reward: -1},
+		{Penalty: -1},
+		{Betrayal: -1},
+	} {
+		_, err = newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).WithStakes(stakes).ProposeMock(stub, red)
+		require.Error(t, err, "stakes %+v", stakes)
+	}
+
+	_, err = newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).
+		WithStakes(Stakes{Reward: engine.MAX_STAKE, Penalty: engine.MAX_STAKE}).ProposeMock(stub, red)
+	require.NoError(t, err)
+}
+
+func TestAllianceProposal(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green, blue := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+	stub, _ := newProposalContract(t)
+
+	// Only allies can propose
+	_, err := newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).ProposeMock(stub, blue)
+	require.Error(t, err)
+
+	proposal, err := newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).ProposeMock(stub, red)
+	require.NoError(t, err)
+	require.Equal(t, PROPOSED, proposal.State)
+	require.Equal(t, []tfcPb.Player{red, green}, proposal.Allies)
+	require.Equal(t, []tfcPb.Player{red}, proposal.Accepted)
+	require.EqualValues(t, DEFAULT_PROPOSAL_TURNS, proposal.Turns)
+
+	_, err = newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).ProposeMock(stub, green)
+	require.Error(t, err, "proposed twice")
+
+	// Not formed before every ally accepted
+	_, err = getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.Error(t, err)
+
+	for _, p := range []tfcPb.Player{red, blue} {
+		_, err = answerMock(stub, ACCEPT_FCN, cuuid, p)
+		require.Error(t, err, "%v accepted", p)
+	}
+
+	proposal, err = answerMock(stub, ACCEPT_FCN, cuuid, green)
+	require.NoError(t, err)
+	require.Equal(t, ACCEPTED, proposal.State)
+
+	allianceData, err := getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, allianceData.State)
+
+	_, err = answerMock(stub, REJECT_FCN, cuuid, green)
+	require.Error(t, err)
+}
+
+func TestAllianceProposalTerms(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green := tfcPb.Player_RED, tfcPb.Player_GREEN
+	stub, _ := newProposalContract(t)
+
+	stakes := Stakes{Reward: 2, Penalty: 1}
+	trade := Predicate{Type: TRADE_AT_LEAST, Player: green, Dest: red,
+		Resource: tfcPb.Resource_HILL, Amount: 2}
+	_, err := newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).WithStakes(stakes).
+		AddPredicate(trade).ProposeMock(stub, red)
+	require.NoError(t, err)
+
+	// The allies see what they are asked to accept
+	r := stub.MockInvokeWithSignedProposal("proposal", [][]byte{[]byte(PROPOSAL_FCN),
+		[]byte(AllianceCollection), []byte(strconv.FormatUint(uint64(cuuid), 10))},
+		playerProposal(green))
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	proposed := ProposedAlliance{}
+	require.NoError(t, json.Unmarshal(r.Payload, &proposed))
+	require.Equal(t, PROPOSED, proposed.State)
+	require.Equal(t, []tfcPb.Player{red}, proposed.Accepted)
+	require.Equal(t, lifespan, proposed.Alliance.Lifespan)
+	require.Len(t, proposed.Alliance.Terms, 1)
+	require.True(t, termMatches(defaultTerm(), proposed.Alliance.Terms[0]))
+	require.Equal(t, []tfcPb.Player{red}, proposed.Owners)
+	require.Equal(t, stakes, proposed.Stakes)
+	require.Equal(t, []Predicate{trade}, proposed.Predicates)
+}
+
+func TestAllianceProposalRejected(t *testing.T) {
+	cuuid := uint32(1010101)
+	stub, _ := newProposalContract(t)
+
+	_, err := newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).ProposeMock(stub, tfcPb.Player_RED)
+	require.NoError(t, err)
+
+	proposal, err := answerMock(stub, REJECT_FCN, cuuid, tfcPb.Player_GREEN)
+	require.NoError(t, err)
+	require.Equal(t, REJECTED, proposal.State)
+
+	_, err = answerMock(stub, ACCEPT_FCN, cuuid, tfcPb.Player_GREEN)
+	require.Error(t, err)
+
+	_, err = getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.Error(t, err)
+}
+
+func TestAllianceProposalExpires(t *testing.T) {
+	cuuid := uint32(1010101)
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	stub, game := newProposalContract(t)
+
+	_, err := newInitArgsBuilder(cuuid).AddTerm(defaultTerm()).WithTurns(1).ProposeMock(stub, tfcPb.Player_RED)
+	require.NoError(t, err)
+
+	// Passing on from a trade does not end the turn
+	game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+	proposal, err := queryProposal(stub, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, PROPOSED, proposal.State)
+
+	game.play(t, tfcPb.GameState_RDEV, nextTrx)
+	proposal, err = queryProposal(stub, cuuid)
+	require.NoError(t, err)
+	require.Equal(t, EXPIRED, proposal.State)
+
+	_, err = answerMock(stub, ACCEPT_FCN, cuuid, tfcPb.Player_GREEN)
+	require.Error(t, err)
+}
+
+func queryProgress(t *testing.T, stub *shim.MockStub, cID uint32) []AllyProgress {
+	r := stub.MockInvokeWithSignedProposal("progress", [][]byte{[]byte(PROGRESS_FCN),
+		[]byte(AllianceCollection), []byte(strconv.FormatUint(uint64(cID), 10))},
+		playerProposal(tfcPb.Player_RED))
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	allies := []AllyProgress{}
+	err := json.Unmarshal(r.Payload, &allies)
+	require.NoError(t, err)
+	return allies
+}
+
+func TestAllianceTermsAreOwned(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green := tfcPb.Player_RED, tfcPb.Player_GREEN
+
+	trade := tfc.NewArgsBuilder().
+		WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).
+		Args()
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+
+	// Red trades twice, and the proposer owes the next
+	stub, game := initContract(t, cuuid, trade, trade, nextTrx)
+
+	allies := queryProgress(t, stub, cuuid)
+	require.Len(t, allies, 2)
+	require.Equal(t, red, allies[0].Ally)
+	require.Len(t, allies[0].Owed, 3)
+	require.Equal(t, green, allies[1].Ally)
+	require.Empty(t, allies[1].Owed)
+
+	// Only one of the duplicate trades is struck off
+	seq := game.play(t, tfcPb.GameState_RTRADE, trade)
+	err := newTrxCompletedBuilder().WithArgs(trade).WithTrxID(seq).MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allies = queryProgress(t, stub, cuuid)
+	require.Len(t, allies[0].Owed, 2)
+	require.Equal(t, 1, allies[0].Completed)
+
+	// Green passing on does not fulfill the term of red
+	seq = game.playAs(t, green, tfcPb.GameState_GTRADE, nextTrx)
+	err = newTrxCompletedBuilder().WithArgs(nextTrx).WithTrxID(seq).
+		WithState(tfcPb.GameState_GTRADE).
+		MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allies = queryProgress(t, stub, cuuid)
+	require.Len(t, allies[0].Owed, 2)
+	require.Zero(t, allies[1].Completed)
+
+	seq = game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+	err = newTrxCompletedBuilder().WithArgs(nextTrx).WithTrxID(seq).MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allies = queryProgress(t, stub, cuuid)
+	require.Len(t, allies[0].Owed, 1)
+	require.True(t, proto.Equal(trade, allies[0].Owed[0]))
+	require.Equal(t, 2, allies[0].Completed)
+}
@@ -0,0 +1,192 @@
+package alliance
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// PLAYER_MSPS_KEY holds the MSPs of the players given at instantiation.
+const PLAYER_MSPS_KEY = "alliance.msps"
+
+// DefaultPlayerMSPs maps each player to the MSP of the organization playing
+// it in the TFC network, one organization per player. It is used unless the
+// chaincode is instantiated with another mapping. Either must match the
+// network collection config, which shares the private data collection of
+// an alliance with the MSPs of its allies only.
+var DefaultPlayerMSPs = map[tfcPb.Player]string{
+	tfcPb.Player_RED:   "Org1MSP",
+	tfcPb.Player_GREEN: "Org2MSP",
+	tfcPb.Player_BLUE:  "Org3MSP",
+}
+
+// HandleInstantiate saves the MSPs of the players, given as a JSON object
+// from player name to MSP ID, such as {"RED": "Org1MSP", ...}. Without
+// arguments, the players keep the MSPs they had, the DefaultPlayerMSPs
+// on a new chaincode.
+func HandleInstantiate(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	if len(args) < 2 || len(args[1]) == 0 {
+		return shim.Success(nil)
+	}
+
+	named := make(map[string]string)
+	err := json.Unmarshal(args[1], &named)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not unmarshal the player MSPs: %s", err))
+	}
+
+	msps := make(map[tfcPb.Player]string)
+	players := make(map[string]tfcPb.Player)
+	for name, mspID := range named {
+		pID, ok := tfcPb.Player_value[name]
+		if !ok {
+			return shim.Error(fmt.Sprintf("unknown player <%s>", name))
+		}
+		if mspID == "" {
+			return shim.Error(fmt.Sprintf("missing the MSP of %s", name))
+		}
+		if p, ok := players[mspID]; ok {
+			return shim.Error(fmt.Sprintf("MSP <%s> of %s is already the MSP of %v", mspID, name, p))
+		}
+		msps[tfcPb.Player(pID)] = mspID
+		players[mspID] = tfcPb.Player(pID)
+	}
+	if len(msps) != len(tfcPb.Player_name) {
+		return shim.Error(fmt.Sprintf("expected the MSPs of all players, got %v", named))
+	}
+
+	err = APIstub.PutState(PLAYER_MSPS_KEY, args[1])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not save the player MSPs: %s", err))
+	}
+	return shim.Success(nil)
+}
+
+// getPlayerMSPs returns the MSPs of the players given at instantiation,
+// or the DefaultPlayerMSPs.
+func getPlayerMSPs(APIstub shim.ChaincodeStubInterface) (map[tfcPb.Player]string, error) {
+	jsonData, err := APIstub.GetState(PLAYER_MSPS_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the player MSPs: %s", err)
+	}
+	if jsonData == nil {
+		return DefaultPlayerMSPs, nil
+	}
+
+	named := make(map[string]string)
+	err = json.Unmarshal(jsonData, &named)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal the player MSPs: %s", err)
+	}
+	msps := make(map[tfcPb.Player]string)
+	for name, mspID := range named {
+		msps[tfcPb.Player(tfcPb.Player_value[name])] = mspID
+	}
+	return msps, nil
+}
+
+// CollectionName returns the name of the private data collection shared
+// by any two or more allies, made of their initials in player order, such
+// as RG or RGB.
+func CollectionName(allies []tfcPb.Player) (string, error) {
+	named := make(map[tfcPb.Player]bool)
+	for _, p := range allies {
+		if _, ok := tfcPb.Player_name[int32(p)]; !ok {
+			return "", fmt.Errorf("invalid ally <%v>", p)
+		}
+		named[p] = true
+	}
+	if len(named) < 2 {
+		return "", fmt.Errorf("an alliance needs at least two allies, got %v", allies)
+	}
+
+	name := ""
+	for pID := int32(0); pID < int32(len(tfcPb.Player_name)); pID++ {
+		if named[tfcPb.Player(pID)] {
+			name += tfcPb.Player_name[pID][:1]
+		}
+	}
+	return name, nil
+}
+
+// collectionAllies returns the allies sharing the collection, and fails
+// for names which are not alliance collections.
+func collectionAllies(collection string) ([]tfcPb.Player, error) {
+	allies := []tfcPb.Player{}
+	for _, initial := range collection {
+		for pID, name := range tfcPb.Player_name {
+			if rune(name[0]) == initial {
+				allies = append(allies, tfcPb.Player(pID))
+			}
+		}
+	}
+
+	name, err := CollectionName(allies)
+	if err != nil || name != collection {
+		return nil, fmt.Errorf("unknown alliance collection <%s>", collection)
+	}
+	return allies, nil
+}
+
+// trxCollection returns the collection of the allies, which must match the
+// one given by the client, if any.
+func trxCollection(trxArgs tfcPb.AllianceTrxArgs, allies []tfcPb.Player) (string, error) {
+	collection, err := CollectionName(allies)
+	if err != nil {
+		return "", err
+	}
+	if trxArgs.CollectionID != "" && trxArgs.CollectionID != collection {
+		return "", fmt.Errorf("collection <%s> is not the collection %s of the allies",
+			trxArgs.CollectionID, collection)
+	}
+	return collection, nil
+}
+
+// assertMember checks that the transaction creator belongs to the MSP of
+// one of the allies sharing the collection.
+func assertMember(APIstub shim.ChaincodeStubInterface, collection string) error {
+	mspID, err := creatorMSP(APIstub)
+	if err != nil {
+		return err
+	}
+	msps, err := getPlayerMSPs(APIstub)
+	if err != nil {
+		return err
+	}
+	return assertMSPMember(msps, mspID, collection)
+}
+
+// assertMSPMember checks that the MSP is the MSP of one of the allies
+// sharing the collection.
+func assertMSPMember(msps map[tfcPb.Player]string, mspID, collection string) error {
+	allies, err := collectionAllies(collection)
+	if err != nil {
+		return err
+	}
+	for _, p := range allies {
+		if msps[p] == mspID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a member of collection %s", mspID, collection)
+}
+
+func creatorMSP(APIstub shim.ChaincodeStubInterface) (string, error) {
+	creator, err := APIstub.GetCreator()
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve transaction creator: %s", err)
+	}
+
+	identity := &msp.SerializedIdentity{}
+	err = proto.Unmarshal(creator, identity)
+	if err != nil {
+		return "", fmt.Errorf("could not unmarshal the creator identity: %s", err)
+	}
+	return identity.Mspid, nil
+}
@@ -0,0 +1,279 @@
+package alliance
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionName(t *testing.T) {
+	red, green, blue := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+
+	for collection, allies := range map[string][]tfcPb.Player{
+		"RG":  {green, red},
+		"RB":  {red, blue, red},
+		"GB":  {blue, green},
+		"RGB": {blue, green, red},
+	} {
+		name, err := CollectionName(allies)
+		require.NoError(t, err)
+		require.Equal(t, collection, name)
+
+		parsed, err := collectionAllies(collection)
+		require.NoError(t, err)
+		named, _ := CollectionName(parsed)
+		require.Equal(t, collection, named)
+	}
+
+	_, err := CollectionName([]tfcPb.Player{red, red})
+	require.Error(t, err)
+	_, err = CollectionName([]tfcPb.Player{red, tfcPb.Player(7)})
+	require.Error(t, err)
+
+	for _, collection := range []string{"", "R", "GR", "RR", "RGX", "alliances"} {
+		_, err = collectionAllies(collection)
+		require.Error(t, err, collection)
+	}
+}
+
+// collectionMembers mirrors the collection config of the TFC network, which
+// disseminates each alliance collection to the peers of the allies only. It
+// is kept apart from DefaultPlayerMSPs, so that the tests notice them drifting.
+var collectionMembers = map[string][]string{
+	"RG":  {"Org1MSP", "Org2MSP"},
+	"RB":  {"Org1MSP", "Org3MSP"},
+	"GB":  {"Org2MSP", "Org3MSP"},
+	"RGB": {"Org1MSP", "Org2MSP", "Org3MSP"},
+}
+
+func isCollectionMember(mspID, collection string) bool {
+	for _, member := range collectionMembers[collection] {
+		if member == mspID {
+			return true
+		}
+	}
+	return false
+}
+
+// collectionStub fails the private data access to collections the creator
+// is not a member of, like the peers of other organizations do, which do
+// not hold the collection. The creator stands for the endorsing peer, one
+// of its own organization.
+type collectionStub struct {
+	privateQueryStub
+}
+
+func (stub *collectionStub) assertAccess(collection string) error {
+	mspID, err := creatorMSP(stub)
+	if err != nil {
+		return err
+	}
+	if !isCollectionMember(mspID, collection) {
+		return fmt.Errorf("peer of %s can not access collection %s", mspID, collection)
+	}
+	return nil
+}
+
+func (stub *collectionStub) GetPrivateData(collection, key string) ([]byte, error) {
+	if err := stub.assertAccess(collection); err != nil {
+		return nil, err
+	}
+	return stub.MockStub.GetPrivateData(collection, key)
+}
+
+func (stub *collectionStub) PutPrivateData(collection, key string, value []byte) error {
+	if err := stub.assertAccess(collection); err != nil {
+		return err
+	}
+	return stub.MockStub.PutPrivateData(collection, key, value)
+}
+
+func (stub *collectionStub) DelPrivateData(collection, key string) error {
+	if err := stub.assertAccess(collection); err != nil {
+		return err
+	}
+	return stub.MockStub.DelPrivateData(collection, key)
+}
+
+func (stub *collectionStub) GetPrivateDataByPartialCompositeKey(collection, objectType string,
+	attributes []string) (shim.StateQueryIteratorInterface, error) {
+
+	if err := stub.assertAccess(collection); err != nil {
+		return nil, err
+	}
+	return stub.privateQueryStub.GetPrivateDataByPartialCompositeKey(collection, objectType, attributes)
+}
+
+func TestMembershipMatchesCollectionConfig(t *testing.T) {
+	for _, mspID := range []string{"Org1MSP", "Org2MSP", "Org3MSP", "Org9MSP"} {
+		member := []string{}
+		for collection := range collectionMembers {
+			err := assertMSPMember(DefaultPlayerMSPs, mspID, collection)
+			require.Equal(t, isCollectionMember(mspID, collection), err == nil,
+				"%s in collection %s", mspID, collection)
+			if err == nil {
+				member = append(member, collection)
+			}
+		}
+		sort.Strings(member)
+		require.Equal(t, member, mspCollections(DefaultPlayerMSPs, mspID), mspID)
+	}
+}
+
+func TestInstantiateWithPlayerMSPs(t *testing.T) {
+	stub := shim.NewMockStub("mockGameContract", new(MockContract))
+
+	// Without arguments, the players keep the default MSPs
+	r := stub.MockInit("init", [][]byte{[]byte("init")})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	msps, err := getPlayerMSPs(stub)
+	require.NoError(t, err)
+	require.Equal(t, DefaultPlayerMSPs, msps)
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"RED": "Org1MSP", "GREEN": "Org2MSP"}`,
+		`{"RED": "Org1MSP", "GREEN": "Org2MSP", "BLUE": "Org2MSP"}`,
+		`{"RED": "Org1MSP", "GREEN": "Org2MSP", "BLUE": ""}`,
+		`{"RED": "Org1MSP", "GREEN": "Org2MSP", "BLUE": "Org3MSP", "WHITE": "Org4MSP"}`,
+	} {
+		r = stub.MockInit("init", [][]byte{[]byte("init"), []byte(invalid)})
+		require.EqualValues(t, shim.ERROR, r.Status, invalid)
+	}
+
+	// Networks where other organizations play the game give their MSPs,
+	// matching the members of the alliance collections in their config
+	r = stub.MockInit("init", [][]byte{[]byte("init"),
+		[]byte(`{"RED": "Org4MSP", "GREEN": "Org2MSP", "BLUE": "Org1MSP"}`)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	msps, err = getPlayerMSPs(stub)
+	require.NoError(t, err)
+	require.Equal(t, "Org4MSP", msps[tfcPb.Player_RED])
+
+	require.NoError(t, assertMSPMember(msps, "Org4MSP", "RG"))
+	require.Error(t, assertMSPMember(msps, "Org1MSP", "RG"))
+	require.NoError(t, assertMSPMember(msps, "Org1MSP", "GB"))
+	require.Equal(t, []string{"RB", "RG", "RGB"}, mspCollections(msps, "Org4MSP"))
+}
+
+// mspProposal signs as a member of the MSP.
+func mspProposal(mspID string) *pb.SignedProposal {
+	return &pb.SignedProposal{ProposalBytes: []byte{}, Signature: mspIdentity(mspID, "outsider")}
+}
+
+func TestAllianceCollectionMembership(t *testing.T) {
+	cuuid := uint32(1010101)
+	blue := mspProposal(DefaultPlayerMSPs[tfcPb.Player_BLUE])
+	unknown := mspProposal("Org9MSP")
+	stub, game := initContract(t, cuuid)
+
+	allianceArgs := func(fcn, collection string) [][]byte {
+		return [][]byte{[]byte(fcn), []byte(collection), []byte(strconv.FormatUint(uint64(cuuid), 10))}
+	}
+
+	// Outsiders are told they can not access the collection
+	for _, fcn := range []string{PROGRESS_FCN, PROPOSAL_FCN, ACCEPT_FCN, REJECT_FCN} {
+		for _, sp := range []*pb.SignedProposal{blue, unknown} {
+			r := stub.MockInvokeWithSignedProposal(fcn, allianceArgs(fcn, AllianceCollection), sp)
+			require.EqualValues(t, shim.ERROR, r.Status, fcn)
+			require.Contains(t, r.Message, "is not a member of collection RG")
+		}
+	}
+
+	// Unsigned and malformed creators are rejected
+	r := stub.MockInvoke("progress", allianceArgs(PROGRESS_FCN, AllianceCollection))
+	require.EqualValues(t, shim.ERROR, r.Status)
+	r = stub.MockInvokeWithSignedProposal("progress", allianceArgs(PROGRESS_FCN, AllianceCollection),
+		&pb.SignedProposal{Signature: []byte{0xff, 0xff}})
+	require.EqualValues(t, shim.ERROR, r.Status)
+
+	// Collections are derived from the allies
+	for _, collection := range []string{"alliances", "GR"} {
+		r = stub.MockInvokeWithSignedProposal("progress", allianceArgs(PROGRESS_FCN, collection),
+			playerProposal(tfcPb.Player_RED))
+		require.EqualValues(t, shim.ERROR, r.Status, collection)
+		require.Contains(t, r.Message, "unknown alliance collection")
+	}
+
+	invoke := func(trxArgs *tfcPb.AllianceTrxArgs, sp *pb.SignedProposal) pb.Response {
+		protoData, err := proto.Marshal(trxArgs)
+		require.NoError(t, err)
+		return stub.MockInvokeWithSignedProposal("invoke", [][]byte{[]byte("test"), protoData}, sp)
+	}
+
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	seq := game.play(t, tfcPb.GameState_RTRADE, nextTrx)
+	completed := &tfcPb.AllianceTrxArgs{
+		Type:   tfcPb.AllianceTrxType_INVOKE,
+		Allies: []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN},
+		InvokePayload: &tfcPb.TrxCompletedArgs{
+			CompletedTrxArgs: nextTrx,
+			LastTrxId:        seq,
+			State:            tfcPb.GameState_RTRADE,
+			ObserverID:       cuuid,
+		},
+	}
+
+	r = invoke(completed, blue)
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "is not a member of collection RG")
+
+	completed.CollectionID = "RB"
+	r = invoke(completed, playerProposal(tfcPb.Player_RED))
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "is not the collection RG of the allies")
+
+	completed.CollectionID = AllianceCollection
+	r = invoke(completed, playerProposal(tfcPb.Player_GREEN))
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	// Alliances can only be proposed within the collection of the allies
+	init := &tfcPb.AllianceTrxArgs{
+		Type: tfcPb.AllianceTrxType_INIT,
+		InitPayload: &tfcPb.AllianceData{
+			Lifespan:       lifespan,
+			StartGameState: tfcPb.GameState_RTRADE,
+			Terms:          []*tfcPb.GameContractTrxArgs{tfc.NewArgsBuilder().WithRollArgs().Args()},
+			ContractID:     cuuid + 1,
+		},
+		Allies: []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN},
+	}
+	r = invoke(init, blue)
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "is not a member of collection RG")
+
+	init.Allies = []tfcPb.Player{tfcPb.Player_RED}
+	r = invoke(init, playerProposal(tfcPb.Player_RED))
+	require.EqualValues(t, shim.ERROR, r.Status)
+
+	r = invoke(&tfcPb.AllianceTrxArgs{Type: tfcPb.AllianceTrxType_INIT}, playerProposal(tfcPb.Player_RED))
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "missing the alliance data")
+}
+
+func TestSettlementOutsideCollection(t *testing.T) {
+	cuuid := uint32(1010101)
+	stub, _ := initContract(t, cuuid)
+	args := [][]byte{[]byte(SETTLEMENT_FCN), []byte(AllianceCollection),
+		[]byte(strconv.FormatUint(uint64(cuuid), 10))}
+
+	// The settlement skips the membership check for the game, but the
+	// peers of outsiders can not read the alliance
+	r := stub.MockInvokeWithSignedProposal("settlement", args,
+		mspProposal(DefaultPlayerMSPs[tfcPb.Player_BLUE]))
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "can not access collection RG")
+
+	// Allies read it, though it is too early to settle
+	r = stub.MockInvokeWithSignedProposal("settlement", args, playerProposal(tfcPb.Player_GREEN))
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "is still ACTIVE")
+}
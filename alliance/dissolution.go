@@ -0,0 +1,150 @@
+package alliance
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// DISSOLVE_FCN consents to dissolve an active alliance, which is dissolved
+// once every ally consented. BETRAY_FCN leaves an active alliance alone,
+// which ends it. They take the alliance collection and contract ID as
+// arguments, and are signed by the ally.
+const (
+	DISSOLVE_FCN = "dissolve"
+	BETRAY_FCN   = "betray"
+)
+
+// The alliance states ending an alliance early. The protobuf definitions
+// do not name them, so they are kept as further values of the open enum.
+const (
+	DISSOLVED tfcPb.AllianceState = 3
+	BETRAYED  tfcPb.AllianceState = 4
+)
+
+var earlyStateNames = map[tfcPb.AllianceState]string{
+	DISSOLVED: "DISSOLVED",
+	BETRAYED:  "BETRAYED",
+}
+
+// StateName returns the name of the alliance state, including the states
+// ending an alliance early.
+func StateName(state tfcPb.AllianceState) string {
+	if name, ok := earlyStateNames[state]; ok {
+		return name
+	}
+	return state.String()
+}
+
+// parseState returns the alliance state with the name.
+func parseState(name string) (tfcPb.AllianceState, error) {
+	if sID, ok := tfcPb.AllianceState_value[name]; ok {
+		return tfcPb.AllianceState(sID), nil
+	}
+	for state, n := range earlyStateNames {
+		if n == name {
+			return state, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown alliance state <%s>", name)
+}
+
+// HandleDissolve records the consent of the signing ally to dissolve the
+// alliance. Nothing is at stake in a dissolved alliance.
+func HandleDissolve(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return handleEarlyEnd(APIstub, func(meta *allianceMeta, ally tfcPb.Player) error {
+		if hasPlayer(meta.Dissolving, ally) {
+			return fmt.Errorf("%v already consented to dissolve the alliance", ally)
+		}
+		meta.Dissolving = append(append([]tfcPb.Player{}, meta.Dissolving...), ally)
+		return nil
+	})
+}
+
+// HandleBetray ends the alliance, betrayed by the signing ally, who loses
+// the betrayal stake, or the penalty if it is higher.
+func HandleBetray(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return handleEarlyEnd(APIstub, func(meta *allianceMeta, ally tfcPb.Player) error {
+		meta.Betrayer = &ally
+		return nil
+	})
+}
+
+// handleEarlyEnd applies the decision of the signing ally to an active
+// alliance, and saves the alliance with its next state. The moves logged
+// since the last report are applied first, so that allies cannot escape
+// an alliance which already failed, or ran out of lifespan.
+func handleEarlyEnd(APIstub shim.ChaincodeStubInterface,
+	decide func(meta *allianceMeta, ally tfcPb.Player) error) pb.Response {
+
+	collection, cID, err := memberArgs(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	allianceData, err := getAllianceLedgerData(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if allianceData.State != tfcPb.AllianceState_ACTIVE {
+		return shim.Error(fmt.Sprintf("alliance %v is not active, it is %v", cID, StateName(allianceData.State)))
+	}
+	meta, err := getAllianceMeta(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	nextTrx, err := getNextTrx(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	moves, err := getObservedMoves(APIstub, cID, meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	applied, meta, err := applyMoves(*allianceData, meta, pendingMoves(moves, nextTrx))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allianceData = &applied
+	if allianceData.State != tfcPb.AllianceState_ACTIVE {
+		return shim.Error(fmt.Sprintf("alliance %v is no longer active, it is %v",
+			cID, StateName(allianceData.State)))
+	}
+
+	ally, err := getCallerPlayer(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !hasPlayer(meta.Allies, ally) {
+		return shim.Error(fmt.Sprintf("%v is not an ally of alliance %v", ally, cID))
+	}
+
+	err = decide(&meta, ally)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allianceData.State = computeNextAllianceState(*allianceData, meta)
+
+	protoData, err := proto.Marshal(allianceData)
+	if err != nil {
+		return shim.Error(
+			fmt.Sprintf("could not marshal the alliance data <%v>: %s", allianceData, err))
+	}
+	err = putAllianceRecord(APIstub, collection, ALLIANCE_INDEX, cID, protoData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putAllianceMeta(APIstub, collection, cID, meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putNextTrx(APIstub, collection, cID, nextGameSeq(moves))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(protoData)
+}
@@ -0,0 +1,235 @@
+package alliance
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+var allPlayers = []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE}
+
+// endMock dissolves or betrays the alliance as the player, and returns the
+// alliance data.
+func endMock(stub *shim.MockStub, fcn, collection string, cID uint32,
+	p tfcPb.Player) (*tfcPb.AllianceData, error) {
+
+	r := stub.MockInvokeWithSignedProposal(fcn+p.String(), [][]byte{[]byte(fcn),
+		[]byte(collection), []byte(strconv.FormatUint(uint64(cID), 10))}, playerProposal(p))
+	if r.Status != shim.OK {
+		return nil, errors.New(r.Message)
+	}
+
+	allianceData := &tfcPb.AllianceData{}
+	err := proto.Unmarshal(r.Payload, allianceData)
+	return allianceData, err
+}
+
+// querySettlementIn queries the settlement as the first ally, the game
+// reading it on the peer of the player settling the alliance.
+func querySettlementIn(t *testing.T, stub *shim.MockStub, collection string, cID uint32) engine.Settlement {
+	allies, err := collectionAllies(collection)
+	require.NoError(t, err)
+	r := stub.MockInvokeWithSignedProposal("settlement", [][]byte{[]byte(SETTLEMENT_FCN),
+		[]byte(collection), []byte(strconv.FormatUint(uint64(cID), 10))}, playerProposal(allies[0]))
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	settlement := engine.Settlement{}
+	require.NoError(t, json.Unmarshal(r.Payload, &settlement))
+	return settlement
+}
+
+func TestThreePartyAlliance(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green, blue := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+	stakes := Stakes{Reward: 2}
+	redTrade := tfc.NewArgsBuilder().WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).Args()
+	greenTrade := tfc.NewArgsBuilder().WithTradeArgs(green, blue, tfcPb.Resource_HILL, 1).Args()
+	stub, game := newProposalContract(t)
+
+	builder := newInitArgsBuilder(cuuid).AddTerm(redTrade).AddTerm(greenTrade).WithStakes(stakes)
+	proposal, err := builder.ProposeMock(stub, red)
+	require.NoError(t, err)
+	require.Equal(t, allPlayers, proposal.Allies)
+
+	// Kept in the collection of the three allies, and formed once all accepted
+	proposal, err = answerInMock(stub, ACCEPT_FCN, "RGB", cuuid, green)
+	require.NoError(t, err)
+	require.Equal(t, PROPOSED, proposal.State)
+	proposal, err = answerInMock(stub, ACCEPT_FCN, "RGB", cuuid, blue)
+	require.NoError(t, err)
+	require.Equal(t, ACCEPTED, proposal.State)
+
+	_, err = getAllianceLedgerData(stub, AllianceCollection, cuuid)
+	require.Error(t, err)
+
+	seq := game.play(t, tfcPb.GameState_RTRADE, redTrade)
+	err = newTrxCompletedBuilder().WithArgs(redTrade).WithTrxID(seq).
+		WithAllies(allPlayers...).MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	seq = game.playAs(t, green, tfcPb.GameState_GTRADE, greenTrade)
+	err = newTrxCompletedBuilder().WithArgs(greenTrade).WithTrxID(seq).
+		WithState(tfcPb.GameState_GTRADE).
+		WithAllies(allPlayers...).MockInvoke(stub, cuuid)
+	require.NoError(t, err)
+
+	allianceData, err := getAllianceLedgerData(stub, "RGB", cuuid)
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.AllianceState_COMPLETED, allianceData.State)
+
+	require.Equal(t, map[int32]int32{
+		engine.GetPlayerId(red):   stakes.Reward,
+		engine.GetPlayerId(green): stakes.Reward,
+		engine.GetPlayerId(blue):  stakes.Reward,
+	}, querySettlementIn(t, stub, "RGB", cuuid).Points)
+}
+
+func TestAllianceDissolved(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green, blue := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+	trade := tfc.NewArgsBuilder().WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).Args()
+	stub, game := newProposalContract(t)
+
+	builder := newInitArgsBuilder(cuuid).AddTerm(trade).WithStakes(Stakes{Reward: 2, Penalty: 1})
+	builder.allies = allPlayers
+	require.NoError(t, builder.InitMock(stub))
+
+	// Dissolving needs every ally
+	allianceData, err := endMock(stub, DISSOLVE_FCN, "RGB", cuuid, red)
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, allianceData.State)
+
+	_, err = endMock(stub, DISSOLVE_FCN, "RGB", cuuid, red)
+	require.Error(t, err, "consented twice")
+
+	allianceData, err = endMock(stub, DISSOLVE_FCN, "RGB", cuuid, green)
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, allianceData.State)
+
+	allianceData, err = endMock(stub, DISSOLVE_FCN, "RGB", cuuid, blue)
+	require.NoError(t, err)
+	require.Equal(t, DISSOLVED, allianceData.State)
+
+	// Nothing is at stake, and nothing is played on any longer
+	require.Empty(t, querySettlementIn(t, stub, "RGB", cuuid).Points)
+
+	seq := game.play(t, tfcPb.GameState_RTRADE, trade)
+	err = newTrxCompletedBuilder().WithArgs(trade).WithTrxID(seq).
+		WithAllies(allPlayers...).MockInvoke(stub, cuuid)
+	require.Error(t, err)
+
+	_, err = endMock(stub, BETRAY_FCN, "RGB", cuuid, red)
+	require.Error(t, err)
+
+	listings := listAlliancesAs(t, stub, blue, "", "DISSOLVED")
+	require.Equal(t, []uint32{cuuid}, listedIDs(listings))
+	require.Equal(t, "DISSOLVED", StateName(listings[0].Alliance.State))
+}
+
+func TestAllianceBetrayed(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green, blue := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+	trade := tfc.NewArgsBuilder().WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).Args()
+	stakes := Stakes{Reward: 2, Penalty: 1, Betrayal: 3}
+	stub, _ := newProposalContract(t)
+
+	err := newInitArgsBuilder(cuuid).AddTerm(trade).WithStakes(stakes).InitMock(stub)
+	require.NoError(t, err)
+
+	// Only allies can betray the alliance
+	_, err = endMock(stub, BETRAY_FCN, AllianceCollection, cuuid, blue)
+	require.Error(t, err)
+
+	allianceData, err := endMock(stub, BETRAY_FCN, AllianceCollection, cuuid, green)
+	require.NoError(t, err)
+	require.Equal(t, BETRAYED, allianceData.State)
+
+	require.Equal(t, map[int32]int32{
+		engine.GetPlayerId(green): -stakes.Betrayal,
+	}, querySettlementIn(t, stub, AllianceCollection, cuuid).Points)
+
+	_, err = endMock(stub, DISSOLVE_FCN, AllianceCollection, cuuid, red)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not active, it is BETRAYED")
+}
+
+func TestBetrayalCostsThePenalty(t *testing.T) {
+	cuuid := uint32(1010101)
+	red, green := tfcPb.Player_RED, tfcPb.Player_GREEN
+	trade := tfc.NewArgsBuilder().WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).Args()
+	stakes := Stakes{Reward: 1, Penalty: 2}
+	stub, _ := newProposalContract(t)
+
+	err := newInitArgsBuilder(cuuid).AddTerm(trade).WithStakes(stakes).InitMock(stub)
+	require.NoError(t, err)
+
+	_, err = endMock(stub, BETRAY_FCN, AllianceCollection, cuuid, red)
+	require.NoError(t, err)
+	require.Equal(t, map[int32]int32{
+		engine.GetPlayerId(red): -stakes.Penalty,
+	}, querySettlementIn(t, stub, AllianceCollection, cuuid).Points)
+}
+
+func TestFailedAllianceCannotBeBetrayed(t *testing.T) {
+	red, green := tfcPb.Player_RED, tfcPb.Player_GREEN
+	gb, err := boardGeometry()
+	require.NoError(t, err)
+	sID := uint32(0)
+	require.Contains(t, gb.Intersections, sID)
+
+	trade := tfc.NewArgsBuilder().WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).Args()
+	noBuild := Predicate{Type: NO_BUILD_AT, Player: green, Intersection: sID}
+	stakes := Stakes{Reward: 1, Penalty: 2}
+	stub, game := newProposalContract(t)
+
+	// Red let the lifespan run out without trading, unreported
+	err = newInitArgsBuilder(1).AddTerm(trade).WithStakes(stakes).InitMock(stub)
+	require.NoError(t, err)
+	for l := int32(0); l < lifespan; l++ {
+		game.endRound(t)
+	}
+	_, err = endMock(stub, BETRAY_FCN, AllianceCollection, 1, red)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is no longer active, it is FAILED")
+
+	// Green built where it was not allowed to, unreported
+	stub, game = newProposalContract(t)
+	err = newInitArgsBuilder(2).AddPredicate(noBuild).WithStakes(stakes).InitMock(stub)
+	require.NoError(t, err)
+	game.playAs(t, green, tfcPb.GameState_GDEV, tfc.NewArgsBuilder().WithBuildSettleArgs(green, sID).Args())
+	_, err = endMock(stub, BETRAY_FCN, AllianceCollection, 2, green)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is no longer active, it is FAILED")
+
+	// The moves up to the betrayal are applied along with it
+	stub, game = newProposalContract(t)
+	tradeBack := tfc.NewArgsBuilder().WithTradeArgs(green, red, tfcPb.Resource_HILL, 1).Args()
+	err = newInitArgsBuilder(3).AddTerm(trade).AddTerm(tradeBack).WithStakes(stakes).InitMock(stub)
+	require.NoError(t, err)
+	game.play(t, tfcPb.GameState_RTRADE, trade)
+	_, err = endMock(stub, BETRAY_FCN, AllianceCollection, 3, green)
+	require.NoError(t, err)
+
+	progress := queryProgress(t, stub, 3)
+	require.Equal(t, 1, progress[0].Completed)
+	require.Empty(t, progress[0].Owed)
+}
+
+func TestStateNames(t *testing.T) {
+	for _, name := range []string{"ACTIVE", "COMPLETED", "FAILED", "DISSOLVED", "BETRAYED"} {
+		state, err := parseState(name)
+		require.NoError(t, err)
+		require.Equal(t, name, StateName(state))
+	}
+
+	_, err := parseState("BROKEN")
+	require.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package alliance
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// GAME_CHAINCODE is the name of the TFC chaincode the alliances observe.
+// It must run on the same channel as the alliance chaincode.
+const GAME_CHAINCODE = "tfc"
+
+// getGameMoves queries the move log of the game, in order.
+func getGameMoves(APIstub shim.ChaincodeStubInterface) ([]tfc.MoveRecord, error) {
+	resp := APIstub.InvokeChaincode(GAME_CHAINCODE, [][]byte{[]byte(tfc.MOVES_FCN)}, "")
+	if resp.Status != shim.OK {
+		return nil, fmt.Errorf("could not query the moves of the game: %s", resp.Message)
+	}
+
+	moves := []tfc.MoveRecord{}
+	err := json.Unmarshal(resp.Payload, &moves)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal the moves of the game: %s", err)
+	}
+	return moves, nil
+}
+
+// getObservedMoves queries the move log of the game the alliance observes.
+// A re-initialized game starts a new log, which the alliance must not
+// apply, so the game must still have the ID recorded at the proposal.
+func getObservedMoves(APIstub shim.ChaincodeStubInterface, cID uint32, meta allianceMeta) ([]tfc.MoveRecord, error) {
+	gameID, err := getGameID(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	if gameID != meta.GameID {
+		return nil, fmt.Errorf("alliance %v observes game <%s>, not the current game <%s>",
+			cID, meta.GameID, gameID)
+	}
+	return getGameMoves(APIstub)
+}
+
+// gameRound returns the number of rounds played in the game.
+func gameRound(moves []tfc.MoveRecord) uint32 {
+	if len(moves) == 0 {
+		return 0
+	}
+	return moves[len(moves)-1].Round
+}
+
+// getGameID queries the ID of the game.
+func getGameID(APIstub shim.ChaincodeStubInterface) (string, error) {
+	resp := APIstub.InvokeChaincode(GAME_CHAINCODE, [][]byte{[]byte(tfc.GAME_FCN)}, "")
+	if resp.Status != shim.OK {
+		return "", fmt.Errorf("could not query the ID of the game: %s", resp.Message)
+	}
+	return string(resp.Payload), nil
+}
+
+// completedMoves returns the moves of the log from the sequence number up
+// to the reported transaction, which must match the move logged at its
+// sequence number, args and game state included.
+func completedMoves(moves []tfc.MoveRecord, from uint32, args tfcPb.TrxCompletedArgs) ([]tfc.MoveRecord, error) {
+	completed := []tfc.MoveRecord{}
+	for _, move := range moves {
+		if move.Seq < from || move.Seq > args.LastTrxId {
+			continue
+		}
+		completed = append(completed, move)
+		if move.Seq != args.LastTrxId {
+			continue
+		}
+		if move.Settlement != nil {
+			return nil, fmt.Errorf("transaction %v is an alliance settlement", args.LastTrxId)
+		}
+
+		trxArgs, err := move.TrxArgs()
+		if err != nil {
+			return nil, err
+		}
+		if !proto.Equal(trxArgs, args.CompletedTrxArgs) || move.PrevState != args.State {
+			return nil, fmt.Errorf("transaction %v does not match the move <%v> made in state %v",
+				args.LastTrxId, trxArgs, move.PrevState)
+		}
+		return completed, nil
+	}
+	return nil, fmt.Errorf("transaction %v was not completed by the game", args.LastTrxId)
+}
+
+// pendingMoves returns the moves of the log from the sequence number on.
+func pendingMoves(moves []tfc.MoveRecord, from uint32) []tfc.MoveRecord {
+	pending := []tfc.MoveRecord{}
+	for _, move := range moves {
+		if move.Seq >= from {
+			pending = append(pending, move)
+		}
+	}
+	return pending
+}
+
+// nextGameSeq returns the sequence number of the next move of the game.
+func nextGameSeq(moves []tfc.MoveRecord) uint32 {
+	if len(moves) == 0 {
+		return 0
+	}
+	return moves[len(moves)-1].Seq + 1
+}
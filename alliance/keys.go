@@ -0,0 +1,73 @@
+package alliance
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Object types of the composite keys of the alliance records, kept in the
+// collection of the allies. Every record is keyed by the contract ID of
+// its alliance.
+const (
+	ALLIANCE_INDEX = "alliance.data"
+	META_INDEX     = "alliance.meta"
+	PROPOSAL_INDEX = "alliance.proposal"
+	PROPOSED_INDEX = "alliance.proposed"
+	NEXTTRX_INDEX  = "alliance.nexttrx"
+)
+
+// allianceKey returns the key of the alliance record. The contract ID is
+// zero padded, so the keys sort in contract ID order.
+func allianceKey(APIstub shim.ChaincodeStubInterface, objectType string, cID uint32) (string, error) {
+	key, err := APIstub.CreateCompositeKey(objectType, []string{fmt.Sprintf("%010d", cID)})
+	if err != nil {
+		return "", fmt.Errorf("could not create the %s key of alliance %v: %s", objectType, cID, err)
+	}
+	return key, nil
+}
+
+// keyContractID returns the contract ID of the alliance record key.
+func keyContractID(APIstub shim.ChaincodeStubInterface, key string) (uint32, error) {
+	_, attributes, err := APIstub.SplitCompositeKey(key)
+	if err != nil || len(attributes) != 1 {
+		return 0, fmt.Errorf("invalid alliance key <%s>: %v", key, err)
+	}
+
+	cID, err := strconv.ParseUint(attributes[0], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid alliance key <%s>: %s", key, err)
+	}
+	return uint32(cID), nil
+}
+
+// getAllianceRecord returns the record of the alliance, or nil if there
+// is none.
+func getAllianceRecord(APIstub shim.ChaincodeStubInterface, collection, objectType string,
+	cID uint32) ([]byte, error) {
+
+	key, err := allianceKey(APIstub, objectType, cID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := APIstub.GetPrivateData(collection, key)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the %s record of alliance %v: %s", objectType, cID, err)
+	}
+	return data, nil
+}
+
+func putAllianceRecord(APIstub shim.ChaincodeStubInterface, collection, objectType string,
+	cID uint32, data []byte) error {
+
+	key, err := allianceKey(APIstub, objectType, cID)
+	if err != nil {
+		return err
+	}
+	err = APIstub.PutPrivateData(collection, key, data)
+	if err != nil {
+		return fmt.Errorf("could not save the %s record of alliance %v: %s", objectType, cID, err)
+	}
+	return nil
+}
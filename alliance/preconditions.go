@@ -0,0 +1,78 @@
+package alliance
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// assertInvokePrecond checks that the completed transaction can be applied
+// to an alliance, and returns the alliance along with the moves to apply.
+// The transaction must have been accepted by the game the alliance was
+// proposed in, as recorded in its move log, and must come after the ones already applied. The moves are
+// the ones logged since, up to the transaction. The alliance must exist,
+// and still be active.
+func assertInvokePrecond(APIstub shim.ChaincodeStubInterface, collection string,
+	args *tfcPb.TrxCompletedArgs) (*tfcPb.AllianceData, []tfc.MoveRecord, error) {
+
+	if args == nil || args.CompletedTrxArgs == nil {
+		return nil, nil, fmt.Errorf("missing the completed transaction")
+	}
+
+	allianceData, err := getAllianceLedgerData(APIstub, collection, args.ObserverID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if allianceData.State != tfcPb.AllianceState_ACTIVE {
+		return nil, nil, fmt.Errorf("alliance %v is not active, it is %v",
+			args.ObserverID, StateName(allianceData.State))
+	}
+
+	nextTrx, err := getNextTrx(APIstub, collection, args.ObserverID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if args.LastTrxId < nextTrx {
+		return nil, nil, fmt.Errorf("transaction %v was already reported to alliance %v",
+			args.LastTrxId, args.ObserverID)
+	}
+
+	meta, err := getAllianceMeta(APIstub, collection, args.ObserverID)
+	if err != nil {
+		return nil, nil, err
+	}
+	moves, err := getObservedMoves(APIstub, args.ObserverID, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	moves, err = completedMoves(moves, nextTrx, *args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return allianceData, moves, nil
+}
+
+func getNextTrx(APIstub shim.ChaincodeStubInterface, collection string, cID uint32) (uint32, error) {
+	data, err := getAllianceRecord(APIstub, collection, NEXTTRX_INDEX, cID)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return 0, fmt.Errorf("alliance %v has no next transaction", cID)
+	}
+
+	next, err := strconv.ParseUint(string(data), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the next transaction of alliance %v: %s", cID, err)
+	}
+	return uint32(next), nil
+}
+
+func putNextTrx(APIstub shim.ChaincodeStubInterface, collection string, cID uint32, next uint32) error {
+	return putAllianceRecord(APIstub, collection, NEXTTRX_INDEX, cID,
+		[]byte(strconv.FormatUint(uint64(next), 10)))
+}
@@ -0,0 +1,138 @@
+package alliance
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// PredicateType names what a predicate term asks of the player.
+type PredicateType string
+
+const (
+	// TRADE_AT_LEAST asks the player to trade at least Amount of the
+	// Resource to Dest, in a single trade.
+	TRADE_AT_LEAST PredicateType = "TRADE_AT_LEAST"
+	// ROAD_NEAR_TILE asks the player to build any road on an edge of the Tile.
+	ROAD_NEAR_TILE PredicateType = "ROAD_NEAR_TILE"
+	// NO_BUILD_AT forbids the player to build a settlement on the
+	// Intersection. It is never fulfilled, and breaking it fails the alliance.
+	NO_BUILD_AT PredicateType = "NO_BUILD_AT"
+)
+
+// Predicate is an alliance term matching a family of transactions, rather
+// than a single one. Player is the ally owing the term.
+type Predicate struct {
+	Type         PredicateType  `json:"type"`
+	Player       tfcPb.Player   `json:"player"`
+	Dest         tfcPb.Player   `json:"dest"`
+	Resource     tfcPb.Resource `json:"resource,omitempty"`
+	Amount       int32          `json:"amount,omitempty"`
+	Tile         uint32         `json:"tile,omitempty"`
+	Intersection uint32         `json:"intersection,omitempty"`
+}
+
+// Prohibits tells whether the predicate forbids the transactions it matches.
+func (p Predicate) Prohibits() bool {
+	return p.Type == NO_BUILD_AT
+}
+
+// Validate checks the predicate against the board.
+func (p Predicate) Validate(gb *tfcPb.GameBoard) error {
+	if _, ok := tfcPb.Player_name[int32(p.Player)]; !ok {
+		return fmt.Errorf("invalid player in predicate %+v", p)
+	}
+
+	switch p.Type {
+	case TRADE_AT_LEAST:
+		if _, ok := tfcPb.Player_name[int32(p.Dest)]; !ok || p.Dest == p.Player {
+			return fmt.Errorf("invalid trade destination in predicate %+v", p)
+		}
+		if p.Amount <= 0 {
+			return fmt.Errorf("invalid trade amount in predicate %+v", p)
+		}
+	case ROAD_NEAR_TILE:
+		if _, ok := gb.Tiles[p.Tile]; !ok {
+			return fmt.Errorf("unknown tile in predicate %+v", p)
+		}
+	case NO_BUILD_AT:
+		if _, ok := gb.Intersections[p.Intersection]; !ok {
+			return fmt.Errorf("unknown intersection in predicate %+v", p)
+		}
+	default:
+		return fmt.Errorf("unknown predicate type <%v>", p.Type)
+	}
+	return nil
+}
+
+// Matches tells whether the transaction made by the player fulfills the
+// predicate, or for a prohibition, breaks it.
+func (p Predicate) Matches(gb *tfcPb.GameBoard, player tfcPb.Player, trxArgs *tfcPb.GameContractTrxArgs) bool {
+	if player != p.Player {
+		return false
+	}
+
+	switch p.Type {
+	case TRADE_AT_LEAST:
+		trade := trxArgs.TradeTrxPayload
+		return trxArgs.Type == tfcPb.GameTrxType_TRADE && trade != nil &&
+			trade.Source == p.Player && trade.Dest == p.Dest &&
+			trade.Resource == p.Resource && trade.Amount >= p.Amount
+
+	case ROAD_NEAR_TILE:
+		build := trxArgs.BuildTrxPayload
+		if trxArgs.Type != tfcPb.GameTrxType_DEV || build == nil ||
+			build.Type != tfcPb.BuildType_ROAD || build.BuildRoadPayload == nil {
+			return false
+		}
+		edge, ok := gb.Edges[build.BuildRoadPayload.EdgeID]
+		if !ok {
+			return false
+		}
+		// Roads are built on either twin of the edge
+		twin, ok := gb.Edges[edge.Twin]
+		return edge.IncidentTile == p.Tile || (ok && twin.IncidentTile == p.Tile)
+
+	case NO_BUILD_AT:
+		build := trxArgs.BuildTrxPayload
+		return trxArgs.Type == tfcPb.GameTrxType_DEV && build != nil &&
+			build.Type == tfcPb.BuildType_SETTLE && build.BuildSettlePayload != nil &&
+			build.BuildSettlePayload.SettleID == p.Intersection
+	}
+	return false
+}
+
+// boardGeometry returns a game board. Only its geometry is used, which
+// is the same for every game, unlike the tile resources.
+func boardGeometry() (*tfcPb.GameBoard, error) {
+	return engine.NewSeededGameBoard(0)
+}
+
+// termMatches tells whether the transaction is the one of the term. The
+// update timestamps are left out, since they differ between clients.
+func termMatches(term, trxArgs *tfcPb.GameContractTrxArgs) bool {
+	return proto.Equal(withoutTimestamps(term), withoutTimestamps(trxArgs))
+}
+
+func withoutTimestamps(trxArgs *tfcPb.GameContractTrxArgs) *tfcPb.GameContractTrxArgs {
+	clean := proto.Clone(trxArgs).(*tfcPb.GameContractTrxArgs)
+	clean.LastUpdated = nil
+	if clean.TradeTrxPayload != nil {
+		clean.TradeTrxPayload.LastUpdated = nil
+	}
+	if clean.BuildTrxPayload != nil {
+		clean.BuildTrxPayload.LastUpdated = nil
+		if clean.BuildTrxPayload.BuildRoadPayload != nil {
+			clean.BuildTrxPayload.BuildRoadPayload.LastUpdated = nil
+		}
+		if clean.BuildTrxPayload.BuildSettlePayload != nil {
+			clean.BuildTrxPayload.BuildSettlePayload.LastUpdated = nil
+		}
+	}
+	if clean.BattleTrxPayload != nil {
+		clean.BattleTrxPayload.LastUpdated = nil
+	}
+	return clean
+}
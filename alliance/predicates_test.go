@@ -0,0 +1,191 @@
+package alliance
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTradeAtLeastPredicate(t *testing.T) {
+	gb, err := boardGeometry()
+	require.NoError(t, err)
+
+	red, green, blue := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+	p := Predicate{Type: TRADE_AT_LEAST, Player: red, Dest: green,
+		Resource: tfcPb.Resource_FOREST, Amount: 3}
+	require.NoError(t, p.Validate(gb))
+
+	trade := func(src, dest tfcPb.Player, r tfcPb.Resource, a int32) *tfcPb.GameContractTrxArgs {
+		return tfc.NewArgsBuilder().WithTradeArgs(src, dest, r, a).Args()
+	}
+
+	require.True(t, p.Matches(gb, red, trade(red, green, tfcPb.Resource_FOREST, 3)))
+	require.True(t, p.Matches(gb, red, trade(red, green, tfcPb.Resource_FOREST, 5)))
+	require.False(t, p.Matches(gb, red, trade(red, green, tfcPb.Resource_FOREST, 2)))
+	require.False(t, p.Matches(gb, red, trade(red, green, tfcPb.Resource_HILL, 3)))
+	require.False(t, p.Matches(gb, red, trade(red, blue, tfcPb.Resource_FOREST, 3)))
+	require.False(t, p.Matches(gb, green, trade(green, red, tfcPb.Resource_FOREST, 3)))
+	require.False(t, p.Matches(gb, red, tfc.NewArgsBuilder().WithNextArgs().Args()))
+
+	require.Error(t, Predicate{Type: TRADE_AT_LEAST, Player: red, Dest: green}.Validate(gb))
+	require.Error(t, Predicate{Type: TRADE_AT_LEAST, Player: red, Dest: red, Amount: 1}.Validate(gb))
+}
+
+func TestRoadNearTilePredicate(t *testing.T) {
+	gb, err := boardGeometry()
+	require.NoError(t, err)
+
+	// The center tile, which has neighbours on all sides
+	red := tfcPb.Player_RED
+	tile, ok := gb.Tiles[engine.EdgeHash(tfcPb.Coord{X: 0, Y: 0}, engine.N)]
+	require.True(t, ok, "expected the board to have a center tile")
+	p := Predicate{Type: ROAD_NEAR_TILE, Player: red, Tile: tile.Id}
+	require.NoError(t, p.Validate(gb))
+
+	// Roads count on either side of the tile edges
+	edge := gb.Edges[tile.OuterComponent]
+	twin, ok := gb.Edges[edge.Twin]
+	require.True(t, ok, "expected the center tile edges to have twins")
+	road := tfc.NewArgsBuilder().WithBuildRoadArgs(red, edge.Id).Args()
+	require.True(t, p.Matches(gb, red, road))
+	twinRoad := tfc.NewArgsBuilder().WithBuildRoadArgs(red, twin.Id).Args()
+	require.True(t, p.Matches(gb, red, twinRoad))
+	require.False(t, p.Matches(gb, tfcPb.Player_GREEN,
+		tfc.NewArgsBuilder().WithBuildRoadArgs(tfcPb.Player_GREEN, edge.Id).Args()))
+
+	// The next edge of the neighbour only touches the tile at a corner
+	far := gb.Edges[twin.Next]
+	farTwin, ok := gb.Edges[far.Twin]
+	require.True(t, ok)
+	require.NotEqual(t, tile.Id, far.IncidentTile)
+	require.NotEqual(t, tile.Id, farTwin.IncidentTile)
+	require.False(t, p.Matches(gb, red, tfc.NewArgsBuilder().WithBuildRoadArgs(red, far.Id).Args()))
+
+	settle := tfc.NewArgsBuilder().WithBuildSettleArgs(red, edge.Origin).Args()
+	require.False(t, p.Matches(gb, red, settle))
+
+	require.Error(t, Predicate{Type: ROAD_NEAR_TILE, Player: red, Tile: 1}.Validate(gb))
+}
+
+func TestNoBuildAtPredicate(t *testing.T) {
+	gb, err := boardGeometry()
+	require.NoError(t, err)
+
+	red := tfcPb.Player_RED
+	var other uint32
+	var intersection *tfcPb.Intersection
+	for _, i := range gb.Intersections {
+		if intersection == nil {
+			intersection = i
+		} else {
+			other = i.Id
+			break
+		}
+	}
+	p := Predicate{Type: NO_BUILD_AT, Player: red, Intersection: intersection.Id}
+	require.NoError(t, p.Validate(gb))
+	require.True(t, p.Prohibits())
+
+	settle := tfc.NewArgsBuilder().WithBuildSettleArgs(red, intersection.Id).Args()
+	require.True(t, p.Matches(gb, red, settle))
+	require.False(t, p.Matches(gb, red, tfc.NewArgsBuilder().WithBuildSettleArgs(red, other).Args()))
+	require.False(t, p.Matches(gb, tfcPb.Player_GREEN,
+		tfc.NewArgsBuilder().WithBuildSettleArgs(tfcPb.Player_GREEN, intersection.Id).Args()))
+	require.False(t, p.Matches(gb, red,
+		tfc.NewArgsBuilder().WithBuildRoadArgs(red, intersection.IncidentEdge).Args()))
+
+	require.Error(t, Predicate{Type: NO_BUILD_AT, Player: red, Intersection: 1}.Validate(gb))
+	require.Error(t, Predicate{Type: "ANYTHING", Player: red}.Validate(gb))
+}
+
+func TestTermMatchesIgnoresTimestamps(t *testing.T) {
+	term := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	trxArgs := tfc.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_FOREST, 3).
+		Args()
+	trxArgs.LastUpdated = ptypes.TimestampNow()
+	trxArgs.TradeTrxPayload.LastUpdated = ptypes.TimestampNow()
+
+	require.True(t, termMatches(term, trxArgs))
+	require.Nil(t, term.LastUpdated)
+
+	trxArgs.TradeTrxPayload.Amount = 4
+	require.False(t, termMatches(term, trxArgs))
+}
+
+func TestAlliancePredicates(t *testing.T) {
+	red, green := tfcPb.Player_RED, tfcPb.Player_GREEN
+	gb, err := boardGeometry()
+	require.NoError(t, err)
+	var sID uint32
+	for sID = range gb.Intersections {
+		break
+	}
+
+	stakes := Stakes{Reward: 2, Penalty: 1}
+	trade := Predicate{Type: TRADE_AT_LEAST, Player: red, Dest: green,
+		Resource: tfcPb.Resource_FOREST, Amount: 3}
+	noBuild := Predicate{Type: NO_BUILD_AT, Player: green, Intersection: sID}
+
+	newAlliance := func(cuuid uint32) (*shim.MockStub, *gameLog) {
+		stub, game := newProposalContract(t)
+		err := newInitArgsBuilder(cuuid).WithStakes(stakes).
+			AddPredicate(trade).AddPredicate(noBuild).
+			InitMock(stub)
+		require.NoError(t, err)
+		return stub, game
+	}
+
+	// Red trades more than asked, and green respects the prohibition
+	stub, game := newAlliance(1)
+	bigTrade := tfc.NewArgsBuilder().WithTradeArgs(red, green, tfcPb.Resource_FOREST, 4).Args()
+	seq := game.play(t, tfcPb.GameState_RTRADE, bigTrade)
+	err = newTrxCompletedBuilder().WithArgs(bigTrade).WithTrxID(seq).MockInvoke(stub, 1)
+	require.NoError(t, err)
+
+	allies := queryProgress(t, stub, 1)
+	require.Empty(t, allies[0].Predicates)
+	require.Equal(t, 1, allies[0].Completed)
+	require.Equal(t, []Predicate{noBuild}, allies[1].Predicates)
+
+	nextTrx := tfc.NewArgsBuilder().WithNextArgs().Args()
+	for l := int32(0); l < lifespan; l++ {
+		seq = game.endRound(t)
+	}
+	err = newTrxCompletedBuilder().WithArgs(nextTrx).WithState(tfcPb.GameState_BDEV).
+		WithTrxID(seq).MockInvoke(stub, 1)
+	require.NoError(t, err)
+
+	settlement, err := querySettlement(stub, 1)
+	require.NoError(t, err)
+	require.Equal(t, map[int32]int32{
+		engine.GetPlayerId(red):   stakes.Reward,
+		engine.GetPlayerId(green): stakes.Reward,
+	}, settlement.Points)
+
+	// Green settling on the intersection fails the alliance
+	stub, game = newAlliance(2)
+	settle := tfc.NewArgsBuilder().WithBuildSettleArgs(green, sID).Args()
+	seq = game.playAs(t, green, tfcPb.GameState_GDEV, settle)
+	err = newTrxCompletedBuilder().WithArgs(settle).WithTrxID(seq).
+		WithState(tfcPb.GameState_GDEV).
+		MockInvoke(stub, 2)
+	require.NoError(t, err)
+
+	allies = queryProgress(t, stub, 2)
+	require.Equal(t, []Predicate{noBuild}, allies[1].Broken)
+
+	settlement, err = querySettlement(stub, 2)
+	require.NoError(t, err)
+	require.Equal(t, map[int32]int32{
+		engine.GetPlayerId(red):   -stakes.Penalty,
+		engine.GetPlayerId(green): -stakes.Penalty,
+	}, settlement.Points)
+}
@@ -0,0 +1,416 @@
+package alliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// ACCEPT_FCN and REJECT_FCN answer an alliance proposal. PROPOSAL_FCN
+// returns it, along with the proposed terms. They take the alliance collection and contract ID as
+// arguments, and answers are signed by the ally.
+const (
+	ACCEPT_FCN   = "accept"
+	REJECT_FCN   = "reject"
+	PROPOSAL_FCN = "proposal"
+)
+
+// DEFAULT_PROPOSAL_TURNS is the number of turns a proposal stays open,
+// unless given in the argument following the stakes.
+const DEFAULT_PROPOSAL_TURNS = 3
+
+// ProposalState is the state of an alliance proposal.
+type ProposalState string
+
+const (
+	PROPOSED ProposalState = "PROPOSED"
+	ACCEPTED ProposalState = "ACCEPTED"
+	REJECTED ProposalState = "REJECTED"
+	EXPIRED  ProposalState = "EXPIRED"
+)
+
+// Proposal is an alliance waiting for the allies to accept it. The
+// alliance is only formed once every ally accepted. ProposedAt is the
+// sequence number of the next game move when the alliance was proposed,
+// and the proposal expires once Turns turns were played from there.
+type Proposal struct {
+	ContractID uint32         `json:"contractID"`
+	Proposer   tfcPb.Player   `json:"proposer"`
+	Allies     []tfcPb.Player `json:"allies"`
+	Accepted   []tfcPb.Player `json:"accepted"`
+	State      ProposalState  `json:"state"`
+	ProposedAt uint32         `json:"proposedAt"`
+	Turns      uint32         `json:"turns"`
+}
+
+// ProposedAlliance is the proposal, along with what the allies are asked
+// to accept: the proposed alliance with its terms and lifespan, the owner
+// of each term, the stakes and the predicate terms.
+type ProposedAlliance struct {
+	Proposal
+	Alliance   *tfcPb.AllianceData `json:"alliance"`
+	Owners     []tfcPb.Player      `json:"owners"`
+	Stakes     Stakes              `json:"stakes"`
+	Predicates []Predicate         `json:"predicates"`
+}
+
+// propose saves the proposal of the alliance, accepted by its proposer.
+// The alliance data is kept aside until the alliance is formed.
+func propose(APIstub shim.ChaincodeStubInterface, collection string,
+	allianceData *tfcPb.AllianceData, protoData []byte, meta allianceMeta) (Proposal, error) {
+
+	cID := allianceData.ContractID
+	existing, err := getAllianceRecord(APIstub, collection, PROPOSAL_INDEX, cID)
+	if err != nil || existing != nil {
+		return Proposal{}, fmt.Errorf("alliance %v was already proposed", cID)
+	}
+
+	turns := uint32(DEFAULT_PROPOSAL_TURNS)
+	args := APIstub.GetArgs()
+	if len(args) > 3 && len(args[3]) > 0 {
+		t, err := strconv.ParseUint(string(args[3]), 10, 32)
+		if err != nil || t == 0 {
+			return Proposal{}, fmt.Errorf("invalid proposal turns <%s>", args[3])
+		}
+		turns = uint32(t)
+	}
+
+	proposer, err := getCallerPlayer(APIstub)
+	if err != nil {
+		return Proposal{}, err
+	}
+	if !hasPlayer(meta.Allies, proposer) {
+		return Proposal{}, fmt.Errorf("%v is not an ally of alliance %v", proposer, cID)
+	}
+
+	moves, err := getGameMoves(APIstub)
+	if err != nil {
+		return Proposal{}, err
+	}
+	meta.GameID, err = getGameID(APIstub)
+	if err != nil {
+		return Proposal{}, err
+	}
+
+	proposal := Proposal{
+		ContractID: cID,
+		Proposer:   proposer,
+		Allies:     meta.Allies,
+		Accepted:   []tfcPb.Player{proposer},
+		State:      PROPOSED,
+		ProposedAt: nextGameSeq(moves),
+		Turns:      turns,
+	}
+
+	err = putAllianceRecord(APIstub, collection, PROPOSED_INDEX, cID, protoData)
+	if err != nil {
+		return Proposal{}, err
+	}
+	meta.assignTerms(allianceData.Terms, proposer)
+	err = putAllianceMeta(APIstub, collection, cID, meta)
+	if err != nil {
+		return Proposal{}, err
+	}
+
+	return proposal, answered(APIstub, collection, &proposal, moves)
+}
+
+// HandleAccept accepts the alliance proposal for the signing ally.
+func HandleAccept(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return handleAnswer(APIstub, true)
+}
+
+// HandleReject rejects the alliance proposal for the signing ally.
+// A single rejection drops the proposal.
+func HandleReject(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return handleAnswer(APIstub, false)
+}
+
+func handleAnswer(APIstub shim.ChaincodeStubInterface, accept bool) pb.Response {
+	collection, cID, err := memberArgs(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposal, err := getProposal(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	meta, err := getAllianceMeta(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	moves, err := getObservedMoves(APIstub, cID, meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	state, err := proposalState(proposal, moves)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if state != PROPOSED {
+		return shim.Error(fmt.Sprintf("alliance %v is no longer proposed, it is %v", cID, state))
+	}
+
+	player, err := getCallerPlayer(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !hasPlayer(proposal.Allies, player) {
+		return shim.Error(fmt.Sprintf("%v is not an ally of alliance %v", player, cID))
+	}
+	if hasPlayer(proposal.Accepted, player) {
+		return shim.Error(fmt.Sprintf("%v already accepted alliance %v", player, cID))
+	}
+
+	if accept {
+		proposal.Accepted = append(proposal.Accepted, player)
+	} else {
+		proposal.State = REJECTED
+	}
+
+	err = answered(APIstub, collection, &proposal, moves)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return proposalResponse(proposal)
+}
+
+// HandleProposal returns the alliance proposal, with the proposed terms,
+// so that the allies know what they accept.
+func HandleProposal(APIstub shim.ChaincodeStubInterface) pb.Response {
+	collection, cID, err := memberArgs(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposal, err := getProposal(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	meta, err := getAllianceMeta(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	moves, err := getObservedMoves(APIstub, cID, meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	proposal.State, err = proposalState(proposal, moves)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	protoData, err := getAllianceRecord(APIstub, collection, PROPOSED_INDEX, cID)
+	if err != nil || protoData == nil {
+		return shim.Error(fmt.Sprintf("could not get the proposed alliance %v: %v", cID, err))
+	}
+	allianceData := &tfcPb.AllianceData{}
+	err = proto.Unmarshal(protoData, allianceData)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not unmarshal the proposed alliance %v: %s", cID, err))
+	}
+
+	jsonData, err := json.Marshal(ProposedAlliance{
+		Proposal:   proposal,
+		Alliance:   allianceData,
+		Owners:     meta.Owners,
+		Stakes:     meta.Stakes,
+		Predicates: meta.Predicates,
+	})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the proposal: %s", err))
+	}
+	return shim.Success(jsonData)
+}
+
+// answered saves the proposal, and forms the alliance once every ally
+// accepted. The alliance observes the moves made after it was formed, and
+// lasts for its lifespan in game rounds from then on.
+func answered(APIstub shim.ChaincodeStubInterface, collection string,
+	proposal *Proposal, moves []tfc.MoveRecord) error {
+
+	cID := proposal.ContractID
+	if proposal.State == PROPOSED && len(proposal.Accepted) == len(proposal.Allies) {
+		proposal.State = ACCEPTED
+
+		protoData, err := getAllianceRecord(APIstub, collection, PROPOSED_INDEX, cID)
+		if err != nil || protoData == nil {
+			return fmt.Errorf("could not get the proposed alliance %v: %v", cID, err)
+		}
+		err = putAllianceRecord(APIstub, collection, ALLIANCE_INDEX, cID, protoData)
+		if err != nil {
+			return err
+		}
+		err = startLifespan(APIstub, collection, cID, protoData, gameRound(moves))
+		if err != nil {
+			return err
+		}
+		err = putNextTrx(APIstub, collection, cID, nextGameSeq(moves))
+		if err != nil {
+			return err
+		}
+	}
+
+	jsonData, err := json.Marshal(proposal)
+	if err != nil {
+		return fmt.Errorf("could not marshal the proposal of alliance %v: %s", cID, err)
+	}
+	return putAllianceRecord(APIstub, collection, PROPOSAL_INDEX, cID, jsonData)
+}
+
+// startLifespan records the round in which the alliance ends.
+func startLifespan(APIstub shim.ChaincodeStubInterface, collection string, cID uint32,
+	protoData []byte, round uint32) error {
+
+	allianceData := &tfcPb.AllianceData{}
+	err := proto.Unmarshal(protoData, allianceData)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal the proposed alliance %v: %s", cID, err)
+	}
+	meta, err := getAllianceMeta(APIstub, collection, cID)
+	if err != nil {
+		return err
+	}
+	meta.EndRound = round
+	if allianceData.Lifespan > 0 {
+		meta.EndRound += uint32(allianceData.Lifespan)
+	}
+	return putAllianceMeta(APIstub, collection, cID, meta)
+}
+
+func getProposal(APIstub shim.ChaincodeStubInterface, collection string, cID uint32) (Proposal, error) {
+	jsonData, err := getAllianceRecord(APIstub, collection, PROPOSAL_INDEX, cID)
+	if err != nil {
+		return Proposal{}, err
+	}
+	if jsonData == nil {
+		return Proposal{}, fmt.Errorf("alliance %v was not proposed", cID)
+	}
+
+	proposal := Proposal{}
+	err = json.Unmarshal(jsonData, &proposal)
+	if err != nil {
+		return Proposal{}, fmt.Errorf("could not unmarshal the proposal of alliance %v: %s", cID, err)
+	}
+	return proposal, nil
+}
+
+// proposalState returns the state of the proposal, which is expired once
+// its turns were played without every ally accepting it.
+func proposalState(proposal Proposal, moves []tfc.MoveRecord) (ProposalState, error) {
+	if proposal.State != PROPOSED {
+		return proposal.State, nil
+	}
+
+	turns, err := countTurns(moves, proposal.ProposedAt)
+	if err != nil {
+		return proposal.State, err
+	}
+	if turns >= proposal.Turns {
+		return EXPIRED, nil
+	}
+	return PROPOSED, nil
+}
+
+// countTurns counts the turns ended from the sequence number on, which
+// are the moves passing on from a development state.
+func countTurns(moves []tfc.MoveRecord, from uint32) (uint32, error) {
+	turns := uint32(0)
+	for _, move := range moves {
+		if move.Seq < from || move.Settlement != nil {
+			continue
+		}
+
+		switch move.PrevState {
+		case tfcPb.GameState_RDEV, tfcPb.GameState_GDEV, tfcPb.GameState_BDEV:
+		default:
+			continue
+		}
+
+		trxArgs, err := move.TrxArgs()
+		if err != nil {
+			return 0, err
+		}
+		if trxArgs.Type == tfcPb.GameTrxType_NEXT {
+			turns++
+		}
+	}
+	return turns, nil
+}
+
+// getCallerPlayer asks the game which player signed the transaction.
+func getCallerPlayer(APIstub shim.ChaincodeStubInterface) (tfcPb.Player, error) {
+	creator, err := APIstub.GetCreator()
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve transaction creator: %s", err)
+	}
+
+	resp := APIstub.InvokeChaincode(GAME_CHAINCODE,
+		[][]byte{[]byte(tfc.PLAYER_FCN), tfc.CreatorSign(creator)}, "")
+	if resp.Status != shim.OK {
+		return 0, fmt.Errorf("could not identify the creator in the game: %s", resp.Message)
+	}
+
+	pID, ok := tfcPb.Player_value[string(resp.Payload)]
+	if !ok {
+		return 0, fmt.Errorf("unknown player <%s>", resp.Payload)
+	}
+	return tfcPb.Player(pID), nil
+}
+
+// allianceArgs returns the alliance collection and contract ID arguments.
+// The collection must be the one of the allies.
+func allianceArgs(APIstub shim.ChaincodeStubInterface) (string, uint32, error) {
+	args := APIstub.GetArgs()
+	if len(args) != 3 {
+		return "", 0, fmt.Errorf("expected the alliance collection and contract ID")
+	}
+
+	collection := string(args[1])
+	_, err := collectionAllies(collection)
+	if err != nil {
+		return "", 0, err
+	}
+
+	cID, err := strconv.ParseUint(string(args[2]), 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid alliance contract ID <%s>: %s", args[2], err)
+	}
+	return collection, uint32(cID), nil
+}
+
+// memberArgs returns the alliance arguments, for transactions created by
+// a member of the collection.
+func memberArgs(APIstub shim.ChaincodeStubInterface) (string, uint32, error) {
+	collection, cID, err := allianceArgs(APIstub)
+	if err != nil {
+		return "", 0, err
+	}
+	return collection, cID, assertMember(APIstub, collection)
+}
+
+func hasPlayer(players []tfcPb.Player, player tfcPb.Player) bool {
+	for _, p := range players {
+		if p == player {
+			return true
+		}
+	}
+	return false
+}
+
+func proposalResponse(proposal Proposal) pb.Response {
+	jsonData, err := json.Marshal(proposal)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the proposal: %s", err))
+	}
+	return shim.Success(jsonData)
+}
@@ -0,0 +1,198 @@
+package alliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// ALLIANCE_FCN is the function name used to query the data of an alliance.
+// It takes the alliance collection and contract ID as arguments.
+const ALLIANCE_FCN = "alliance"
+
+// ALLIANCES_FCN is the function name used to list the alliances the caller
+// can see, which are the ones kept in the collections of its organization.
+// It takes an ally, an alliance state and a game ID as optional arguments,
+// listing only the matching alliances.
+const ALLIANCES_FCN = "alliances"
+
+// AllianceListing is a formed alliance, along with the collection keeping
+// it and its remaining predicate terms.
+type AllianceListing struct {
+	Collection string              `json:"collection"`
+	GameID     string              `json:"gameID"`
+	Allies     []tfcPb.Player      `json:"allies"`
+	Alliance   *tfcPb.AllianceData `json:"alliance"`
+	Predicates []Predicate         `json:"predicates"`
+}
+
+// allianceFilter selects alliances. Nil and empty fields select anything.
+type allianceFilter struct {
+	ally   *tfcPb.Player
+	state  *tfcPb.AllianceState
+	gameID string
+}
+
+func (f allianceFilter) matches(allianceData *tfcPb.AllianceData, meta allianceMeta) bool {
+	if f.ally != nil && !hasPlayer(meta.Allies, *f.ally) {
+		return false
+	}
+	if f.state != nil && allianceData.State != *f.state {
+		return false
+	}
+	return f.gameID == "" || meta.GameID == f.gameID
+}
+
+// HandleAlliance returns the alliance data.
+func HandleAlliance(APIstub shim.ChaincodeStubInterface) pb.Response {
+	collection, cID, err := memberArgs(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	allianceData, err := getAllianceLedgerData(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	protoData, err := proto.Marshal(allianceData)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the alliance data <%v>: %s", allianceData, err))
+	}
+	return shim.Success(protoData)
+}
+
+// HandleAlliances lists the matching alliances of the collections the
+// caller is a member of, by collection and contract ID.
+func HandleAlliances(APIstub shim.ChaincodeStubInterface) pb.Response {
+	filter, err := allianceFilterArgs(APIstub.GetArgs())
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	mspID, err := creatorMSP(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	msps, err := getPlayerMSPs(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	listings := []AllianceListing{}
+	for _, collection := range mspCollections(msps, mspID) {
+		found, err := listAlliances(APIstub, collection, filter)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		listings = append(listings, found...)
+	}
+
+	jsonData, err := json.Marshal(listings)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the alliances: %s", err))
+	}
+	return shim.Success(jsonData)
+}
+
+func allianceFilterArgs(args [][]byte) (allianceFilter, error) {
+	filter := allianceFilter{}
+	if len(args) > 4 {
+		return filter, fmt.Errorf("expected at most an ally, an alliance state and a game ID")
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		pID, ok := tfcPb.Player_value[string(args[1])]
+		if !ok {
+			return filter, fmt.Errorf("unknown ally <%s>", args[1])
+		}
+		ally := tfcPb.Player(pID)
+		filter.ally = &ally
+	}
+	if len(args) > 2 && len(args[2]) > 0 {
+		state, err := parseState(string(args[2]))
+		if err != nil {
+			return filter, err
+		}
+		filter.state = &state
+	}
+	if len(args) > 3 {
+		filter.gameID = string(args[3])
+	}
+	return filter, nil
+}
+
+// mspCollections returns the collections of the alliances the MSP can take
+// part in, in name order.
+func mspCollections(msps map[tfcPb.Player]string, mspID string) []string {
+	collections := []string{}
+	players := int32(len(tfcPb.Player_name))
+	for set := 1; set < 1<<uint(players); set++ {
+		allies := []tfcPb.Player{}
+		member := false
+		for pID := int32(0); pID < players; pID++ {
+			if set&(1<<uint(pID)) == 0 {
+				continue
+			}
+			allies = append(allies, tfcPb.Player(pID))
+			member = member || msps[tfcPb.Player(pID)] == mspID
+		}
+
+		collection, err := CollectionName(allies)
+		if member && err == nil {
+			collections = append(collections, collection)
+		}
+	}
+	sort.Strings(collections)
+	return collections
+}
+
+func listAlliances(APIstub shim.ChaincodeStubInterface, collection string,
+	filter allianceFilter) ([]AllianceListing, error) {
+
+	iter, err := APIstub.GetPrivateDataByPartialCompositeKey(collection, ALLIANCE_INDEX, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("could not query the alliances of collection %s: %s", collection, err)
+	}
+	defer iter.Close()
+
+	listings := []AllianceListing{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("could not iterate the alliances of collection %s: %s", collection, err)
+		}
+
+		cID, err := keyContractID(APIstub, kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		allianceData := &tfcPb.AllianceData{}
+		err = proto.Unmarshal(kv.Value, allianceData)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal alliance %v: %s", cID, err)
+		}
+		meta, err := getAllianceMeta(APIstub, collection, cID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !filter.matches(allianceData, meta) {
+			continue
+		}
+		listings = append(listings, AllianceListing{
+			Collection: collection,
+			GameID:     meta.GameID,
+			Allies:     meta.Allies,
+			Alliance:   allianceData,
+			Predicates: meta.Predicates,
+		})
+	}
+	return listings, nil
+}
@@ -0,0 +1,153 @@
+package alliance
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+// privateQueryStub answers the partial composite key queries of private
+// data, which the mock stub does not implement.
+type privateQueryStub struct {
+	*shim.MockStub
+}
+
+func (stub *privateQueryStub) GetPrivateDataByPartialCompositeKey(collection, objectType string,
+	attributes []string) (shim.StateQueryIteratorInterface, error) {
+
+	prefix, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := []*queryresult.KV{}
+	for key, value := range stub.PvtState[collection] {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, &queryresult.KV{Namespace: collection, Key: key, Value: value})
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return &kvIterator{kvs: kvs}, nil
+}
+
+type kvIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (iter *kvIterator) HasNext() bool {
+	return len(iter.kvs) > 0
+}
+
+func (iter *kvIterator) Next() (*queryresult.KV, error) {
+	kv := iter.kvs[0]
+	iter.kvs = iter.kvs[1:]
+	return kv, nil
+}
+
+func (iter *kvIterator) Close() error {
+	return nil
+}
+
+func queryAlliance(t *testing.T, stub *shim.MockStub, collection string, cID uint32,
+	sp *pb.SignedProposal) (*tfcPb.AllianceData, error) {
+
+	r := stub.MockInvokeWithSignedProposal("alliance", [][]byte{[]byte(ALLIANCE_FCN),
+		[]byte(collection), []byte(strconv.FormatUint(uint64(cID), 10))}, sp)
+	if r.Status != shim.OK {
+		return nil, errors.New(r.Message)
+	}
+
+	allianceData := &tfcPb.AllianceData{}
+	require.NoError(t, proto.Unmarshal(r.Payload, allianceData))
+	return allianceData, nil
+}
+
+func listAlliancesAs(t *testing.T, stub *shim.MockStub, p tfcPb.Player, filters ...string) []AllianceListing {
+	args := [][]byte{[]byte(ALLIANCES_FCN)}
+	for _, f := range filters {
+		args = append(args, []byte(f))
+	}
+
+	r := stub.MockInvokeWithSignedProposal("alliances", args, playerProposal(p))
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	listings := []AllianceListing{}
+	require.NoError(t, json.Unmarshal(r.Payload, &listings))
+	return listings
+}
+
+func listedIDs(listings []AllianceListing) []uint32 {
+	ids := []uint32{}
+	for _, l := range listings {
+		ids = append(ids, l.Alliance.ContractID)
+	}
+	return ids
+}
+
+func TestAllianceQueries(t *testing.T) {
+	red, green, blue := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+	trade := tfc.NewArgsBuilder().WithTradeArgs(red, green, tfcPb.Resource_FOREST, 3).Args()
+	blueTrade := tfc.NewArgsBuilder().WithTradeArgs(red, blue, tfcPb.Resource_HILL, 1).Args()
+	stub, game := newProposalContract(t)
+
+	// Red and green trade twice, red and blue once, and one proposal is
+	// not accepted yet
+	require.NoError(t, newInitArgsBuilder(1).AddTerm(trade).InitMock(stub))
+	require.NoError(t, newInitArgsBuilder(2).AddTerm(trade).AddTerm(trade).InitMock(stub))
+	rb := newInitArgsBuilder(3).AddTerm(blueTrade)
+	rb.allies = []tfcPb.Player{red, blue}
+	require.NoError(t, rb.InitMock(stub))
+	_, err := newInitArgsBuilder(4).AddTerm(trade).ProposeMock(stub, red)
+	require.NoError(t, err)
+
+	seq := game.play(t, tfcPb.GameState_RTRADE, trade)
+	err = newTrxCompletedBuilder().WithArgs(trade).WithTrxID(seq).MockInvoke(stub, 1)
+	require.NoError(t, err)
+
+	allianceData, err := queryAlliance(t, stub, AllianceCollection, 2, playerProposal(green))
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, allianceData.State)
+	require.Len(t, allianceData.Terms, 2)
+
+	_, err = queryAlliance(t, stub, AllianceCollection, 2, playerProposal(blue))
+	require.Error(t, err)
+	_, err = queryAlliance(t, stub, AllianceCollection, 4, playerProposal(red))
+	require.Error(t, err, "not formed yet")
+
+	// Every player sees the alliances of its collections
+	require.Equal(t, []uint32{3, 1, 2}, listedIDs(listAlliancesAs(t, stub, red)))
+	require.Equal(t, []uint32{1, 2}, listedIDs(listAlliancesAs(t, stub, green)))
+	require.Equal(t, []uint32{3}, listedIDs(listAlliancesAs(t, stub, blue)))
+
+	listings := listAlliancesAs(t, stub, red, "BLUE")
+	require.Len(t, listings, 1)
+	require.Equal(t, "RB", listings[0].Collection)
+	require.Equal(t, []tfcPb.Player{red, blue}, listings[0].Allies)
+	require.Equal(t, testGameID, listings[0].GameID)
+	require.True(t, proto.Equal(blueTrade, listings[0].Alliance.Terms[0]))
+
+	require.Equal(t, []uint32{1}, listedIDs(listAlliancesAs(t, stub, red, "", "COMPLETED")))
+	require.Equal(t, []uint32{3, 2}, listedIDs(listAlliancesAs(t, stub, red, "", "ACTIVE")))
+	require.Equal(t, []uint32{2}, listedIDs(listAlliancesAs(t, stub, green, "RED", "ACTIVE", testGameID)))
+	require.Empty(t, listAlliancesAs(t, stub, red, "", "", "othergame"))
+
+	for _, filters := range [][]string{{"PURPLE"}, {"", "BROKEN"}, {"", "", "", "extra"}} {
+		args := [][]byte{[]byte(ALLIANCES_FCN)}
+		for _, f := range filters {
+			args = append(args, []byte(f))
+		}
+		r := stub.MockInvokeWithSignedProposal("alliances", args, playerProposal(red))
+		require.EqualValues(t, shim.ERROR, r.Status, filters)
+	}
+}
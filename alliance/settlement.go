@@ -0,0 +1,110 @@
+package alliance
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// SETTLEMENT_FCN is the function name used by the game to query the
+// settlement of a finished alliance. It takes the alliance collection and
+// the alliance contract ID as arguments.
+const SETTLEMENT_FCN = tfc.ALLIANCE_SETTLEMENT_FCN
+
+// Stakes are the winning points at stake in an alliance. Every ally gains
+// the reward when the alliance completes. When it fails, every ally who
+// still owes a term, or broke a prohibition, loses the penalty. An ally
+// betraying the alliance loses the betrayal stake, and at least the
+// penalty, so that betraying never costs less than failing. Nothing is at
+// stake when the allies dissolve it. They are given as JSON in the
+// argument following the init payload, along with the predicate terms,
+// and default to nothing at stake.
+type Stakes struct {
+	Reward   int32 `json:"reward"`
+	Penalty  int32 `json:"penalty"`
+	Betrayal int32 `json:"betrayal"`
+}
+
+// validate checks that the stakes are neither negative, nor over the
+// maximum stake the game settles.
+func (s Stakes) validate() error {
+	if s.Reward < 0 || s.Penalty < 0 || s.Betrayal < 0 ||
+		s.Reward > engine.MAX_STAKE || s.Penalty > engine.MAX_STAKE || s.Betrayal > engine.MAX_STAKE {
+		return fmt.Errorf("invalid alliance stakes %+v, they must be between 0 and %v", s, engine.MAX_STAKE)
+	}
+	return nil
+}
+
+// HandleSettlement returns the settlement of a finished alliance.
+// It is queried by the game for any player, so it is not restricted to the
+// allies. The settlement is made public by the game anyway.
+func HandleSettlement(APIstub shim.ChaincodeStubInterface) pb.Response {
+	collection, cID, err := allianceArgs(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	allianceData, err := getAllianceLedgerData(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	meta, err := getAllianceMeta(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	settlement, err := settle(*allianceData, meta)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(settlement)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the settlement: %s", err))
+	}
+	return shim.Success(jsonData)
+}
+
+// settle computes the winning points the alliance brings to each player.
+func settle(allianceData tfcPb.AllianceData, meta allianceMeta) (engine.Settlement, error) {
+	settlement := engine.Settlement{
+		AllianceID: allianceData.ContractID,
+		GameID:     meta.GameID,
+		Points:     make(map[int32]int32),
+	}
+
+	switch allianceData.State {
+	case tfcPb.AllianceState_COMPLETED:
+		for _, p := range meta.Allies {
+			settlement.Points[engine.GetPlayerId(p)] = meta.Stakes.Reward
+		}
+	case tfcPb.AllianceState_FAILED:
+		for _, owner := range meta.Owners {
+			settlement.Points[engine.GetPlayerId(owner)] = -meta.Stakes.Penalty
+		}
+		for _, p := range meta.Predicates {
+			if !p.Prohibits() {
+				settlement.Points[engine.GetPlayerId(p.Player)] = -meta.Stakes.Penalty
+			}
+		}
+		for _, p := range meta.Broken {
+			settlement.Points[engine.GetPlayerId(p.Player)] = -meta.Stakes.Penalty
+		}
+	case BETRAYED:
+		betrayal := meta.Stakes.Betrayal
+		if betrayal < meta.Stakes.Penalty {
+			betrayal = meta.Stakes.Penalty
+		}
+		settlement.Points[engine.GetPlayerId(*meta.Betrayer)] = -betrayal
+	case DISSOLVED:
+	default:
+		return settlement, fmt.Errorf("alliance %v is still %v", allianceData.ContractID,
+			StateName(allianceData.State))
+	}
+	return settlement, nil
+}
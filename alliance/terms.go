@@ -0,0 +1,287 @@
+package alliance
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// PROGRESS_FCN is the function name used to query what each ally of an
+// alliance still owes. It takes the alliance collection and contract ID
+// as arguments.
+const PROGRESS_FCN = "progress"
+
+// allianceMeta is what the alliance data does not hold, kept next to it.
+// Owners names the ally responsible for each remaining term, in the order
+// of the terms, and Completed the owners of the terms fulfilled so far.
+// Predicates are the remaining predicate terms, and Broken the prohibitions
+// an ally did not respect. GameID is the game the alliance observes.
+// Dissolving are the allies who consented to dissolve the alliance, and
+// Betrayer the ally who betrayed it, if any.
+type allianceMeta struct {
+	GameID     string         `json:"gameID"`
+	Allies     []tfcPb.Player `json:"allies"`
+	Stakes     Stakes         `json:"stakes"`
+	Owners     []tfcPb.Player `json:"owners"`
+	Completed  []tfcPb.Player `json:"completed"`
+	Predicates []Predicate    `json:"predicates"`
+	Broken     []Predicate    `json:"broken"`
+	Dissolving []tfcPb.Player `json:"dissolving"`
+	Betrayer   *tfcPb.Player  `json:"betrayer,omitempty"`
+	EndRound   uint32         `json:"endRound"`
+}
+
+// initTerms is the JSON argument following the init payload. It holds the
+// stakes, along with the predicate terms of the alliance.
+type initTerms struct {
+	Stakes
+	Predicates []Predicate `json:"predicates"`
+}
+
+// AllyProgress is what an ally still owes the alliance, and the number of
+// terms they fulfilled. Predicates holds the predicate terms they owe, or
+// must respect, and Broken the prohibitions they did not respect.
+type AllyProgress struct {
+	Ally       tfcPb.Player                 `json:"ally"`
+	Owed       []*tfcPb.GameContractTrxArgs `json:"owed"`
+	Predicates []Predicate                  `json:"predicates"`
+	Broken     []Predicate                  `json:"broken"`
+	Completed  int                          `json:"completed"`
+}
+
+// newAllianceMeta reads the stakes and predicate terms from the init args.
+// The allies are the players named in the terms, along with the ones given
+// in the args.
+func newAllianceMeta(args [][]byte, trxArgs tfcPb.AllianceTrxArgs) (allianceMeta, error) {
+	init := initTerms{}
+	if len(args) > 2 && len(args[2]) > 0 {
+		err := json.Unmarshal(args[2], &init)
+		if err != nil {
+			return allianceMeta{}, fmt.Errorf("could not unmarshal the alliance stakes <%s>: %s", args[2], err)
+		}
+	}
+	stakes := init.Stakes
+	err := stakes.validate()
+	if err != nil {
+		return allianceMeta{}, err
+	}
+
+	predicates := []Predicate{}
+	if len(init.Predicates) > 0 {
+		gb, err := boardGeometry()
+		if err != nil {
+			return allianceMeta{}, err
+		}
+		for _, p := range init.Predicates {
+			err = p.Validate(gb)
+			if err != nil {
+				return allianceMeta{}, err
+			}
+		}
+		predicates = init.Predicates
+	}
+	if len(trxArgs.InitPayload.Terms) == 0 && len(predicates) == 0 {
+		return allianceMeta{}, fmt.Errorf("an alliance needs at least one term or predicate")
+	}
+
+	named := make(map[tfcPb.Player]bool)
+	for _, p := range trxArgs.Allies {
+		named[p] = true
+	}
+	for _, term := range trxArgs.InitPayload.Terms {
+		owner, others := termPlayers(term)
+		named[owner] = true
+		for _, p := range others {
+			named[p] = true
+		}
+	}
+	for _, p := range predicates {
+		named[p.Player] = true
+		if p.Type == TRADE_AT_LEAST {
+			named[p.Dest] = true
+		}
+	}
+
+	allies := []tfcPb.Player{}
+	for pID := int32(0); pID < int32(len(tfcPb.Player_name)); pID++ {
+		if named[tfcPb.Player(pID)] {
+			allies = append(allies, tfcPb.Player(pID))
+		}
+	}
+	return allianceMeta{
+		Allies:     allies,
+		Stakes:     stakes,
+		Completed:  []tfcPb.Player{},
+		Predicates: predicates,
+		Broken:     []Predicate{},
+		Dissolving: []tfcPb.Player{},
+	}, nil
+}
+
+// assignTerms names the owner of each term. Terms naming no player are
+// owed by the proposer.
+func (meta *allianceMeta) assignTerms(terms []*tfcPb.GameContractTrxArgs, proposer tfcPb.Player) {
+	meta.Owners = []tfcPb.Player{}
+	for _, term := range terms {
+		owner, _ := termPlayers(term)
+		if owner == engine.Spectator {
+			owner = proposer
+		}
+		meta.Owners = append(meta.Owners, owner)
+	}
+}
+
+// termPlayers returns the player owing the term, and the other players it
+// names. Terms owed by nobody in particular, like a roll, return a spectator.
+func termPlayers(term *tfcPb.GameContractTrxArgs) (tfcPb.Player, []tfcPb.Player) {
+	switch {
+	case term.TradeTrxPayload != nil:
+		return term.TradeTrxPayload.Source, []tfcPb.Player{term.TradeTrxPayload.Dest}
+	case term.BuildTrxPayload != nil && term.BuildTrxPayload.BuildRoadPayload != nil:
+		return term.BuildTrxPayload.BuildRoadPayload.Player, nil
+	case term.BuildTrxPayload != nil && term.BuildTrxPayload.BuildSettlePayload != nil:
+		return term.BuildTrxPayload.BuildSettlePayload.Player, nil
+	}
+	return engine.Spectator, nil
+}
+
+// reduceAllianceTerms strikes off the first remaining term matching the
+// transaction made by the player, trying the predicate terms after the
+// exact ones. Terms owed by other allies are kept, and so are further
+// duplicates of the term. Prohibitions broken by the transaction are
+// recorded, whatever else it fulfills.
+func reduceAllianceTerms(allianceData tfcPb.AllianceData, meta allianceMeta, gb *tfcPb.GameBoard,
+	trxArgs *tfcPb.GameContractTrxArgs, player tfcPb.Player) (tfcPb.AllianceData, allianceMeta) {
+
+	for _, p := range meta.Predicates {
+		if p.Prohibits() && p.Matches(gb, player, trxArgs) {
+			meta.Broken = append(append([]Predicate{}, meta.Broken...), p)
+		}
+	}
+
+	for i, term := range allianceData.Terms {
+		if meta.Owners[i] != player || !termMatches(term, trxArgs) {
+			continue
+		}
+
+		terms := append([]*tfcPb.GameContractTrxArgs{}, allianceData.Terms[:i]...)
+		allianceData.Terms = append(terms, allianceData.Terms[i+1:]...)
+
+		owners := append([]tfcPb.Player{}, meta.Owners[:i]...)
+		meta.Owners = append(owners, meta.Owners[i+1:]...)
+		meta.Completed = append(append([]tfcPb.Player{}, meta.Completed...), player)
+		return allianceData, meta
+	}
+
+	for i, p := range meta.Predicates {
+		if p.Prohibits() || !p.Matches(gb, player, trxArgs) {
+			continue
+		}
+
+		predicates := append([]Predicate{}, meta.Predicates[:i]...)
+		meta.Predicates = append(predicates, meta.Predicates[i+1:]...)
+		meta.Completed = append(append([]tfcPb.Player{}, meta.Completed...), player)
+		break
+	}
+	return allianceData, meta
+}
+
+// owedPredicates counts the predicate terms still to be fulfilled.
+func owedPredicates(meta allianceMeta) int {
+	owed := 0
+	for _, p := range meta.Predicates {
+		if !p.Prohibits() {
+			owed++
+		}
+	}
+	return owed
+}
+
+// progress lists what each ally still owes, in player order.
+func progress(allianceData tfcPb.AllianceData, meta allianceMeta) []AllyProgress {
+	allies := []AllyProgress{}
+	for _, ally := range meta.Allies {
+		p := AllyProgress{
+			Ally:       ally,
+			Owed:       []*tfcPb.GameContractTrxArgs{},
+			Predicates: []Predicate{},
+			Broken:     []Predicate{},
+		}
+		for i, term := range allianceData.Terms {
+			if meta.Owners[i] == ally {
+				p.Owed = append(p.Owed, term)
+			}
+		}
+		for _, pred := range meta.Predicates {
+			if pred.Player == ally {
+				p.Predicates = append(p.Predicates, pred)
+			}
+		}
+		for _, pred := range meta.Broken {
+			if pred.Player == ally {
+				p.Broken = append(p.Broken, pred)
+			}
+		}
+		for _, owner := range meta.Completed {
+			if owner == ally {
+				p.Completed++
+			}
+		}
+		allies = append(allies, p)
+	}
+	return allies
+}
+
+// HandleProgress returns the progress of each ally of the alliance.
+func HandleProgress(APIstub shim.ChaincodeStubInterface) pb.Response {
+	collection, cID, err := memberArgs(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	allianceData, err := getAllianceLedgerData(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	meta, err := getAllianceMeta(APIstub, collection, cID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(progress(*allianceData, meta))
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the progress of alliance %v: %s", cID, err))
+	}
+	return shim.Success(jsonData)
+}
+
+func putAllianceMeta(APIstub shim.ChaincodeStubInterface, collection string, cID uint32,
+	meta allianceMeta) error {
+
+	jsonData, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("could not marshal the meta data of alliance %v: %s", cID, err)
+	}
+	return putAllianceRecord(APIstub, collection, META_INDEX, cID, jsonData)
+}
+
+func getAllianceMeta(APIstub shim.ChaincodeStubInterface, collection string, cID uint32) (allianceMeta, error) {
+	jsonData, err := getAllianceRecord(APIstub, collection, META_INDEX, cID)
+	if err != nil {
+		return allianceMeta{}, err
+	}
+	if jsonData == nil {
+		return allianceMeta{}, fmt.Errorf("alliance %v has no meta data", cID)
+	}
+
+	meta := allianceMeta{}
+	err = json.Unmarshal(jsonData, &meta)
+	if err != nil {
+		return allianceMeta{}, fmt.Errorf("could not unmarshal the meta data of alliance %v: %s", cID, err)
+	}
+	return meta, nil
+}
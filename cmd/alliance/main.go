@@ -16,17 +16,39 @@ type AllianceChaincode struct {
 }
 
 func (gc *AllianceChaincode) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
-	return shim.Success(nil)
+	return alli.HandleInstantiate(APIstub)
 }
 
 func (gc *AllianceChaincode) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 	/*
 		1) If new alliance, then
 			1.1) Create new alliance contract with data.ContractID
-			1.2) Give it the collection correponding to the allies (RG, RB, GB)
+			1.2) Give it the collection correponding to the allies (RG, RB, GB, RGB)
 		2) If Invoke, then forward to corresponding ContractID
+		The handlers reject callers outside the collection of the allies.
 	*/
 
+	switch string(APIstub.GetArgs()[0]) {
+	case alli.SETTLEMENT_FCN:
+		return alli.HandleSettlement(APIstub)
+	case alli.PROGRESS_FCN:
+		return alli.HandleProgress(APIstub)
+	case alli.PROPOSAL_FCN:
+		return alli.HandleProposal(APIstub)
+	case alli.ACCEPT_FCN:
+		return alli.HandleAccept(APIstub)
+	case alli.REJECT_FCN:
+		return alli.HandleReject(APIstub)
+	case alli.ALLIANCE_FCN:
+		return alli.HandleAlliance(APIstub)
+	case alli.ALLIANCES_FCN:
+		return alli.HandleAlliances(APIstub)
+	case alli.DISSOLVE_FCN:
+		return alli.HandleDissolve(APIstub)
+	case alli.BETRAY_FCN:
+		return alli.HandleBetray(APIstub)
+	}
+
 	protoArgs := APIstub.GetArgs()[1]
 	trxArgs := &tfcPb.AllianceTrxArgs{}
 	err := proto.Unmarshal(protoArgs, trxArgs)
@@ -35,37 +57,21 @@ func (gc *AllianceChaincode) Invoke(APIstub shim.ChaincodeStubInterface) pb.Resp
 			fmt.Sprintf("could not unmarshal arguments proto message <%v>: %s", protoArgs, err))
 	}
 
-	// Test if it can access the collection
-
 	log.Printf("Processing alliance transaction %v", trxArgs)
 	fcn := trxArgs.Type
 
 	switch fcn {
 
 	case tfcPb.AllianceTrxType_INIT:
-		if !canReadPrivate(APIstub, trxArgs.CollectionID, trxArgs.InitPayload.ContractID) {
-			return shim.Success(nil)
-		}
 		return alli.HandleInit(APIstub)
 
 	case tfcPb.AllianceTrxType_INVOKE:
-		if !canReadPrivate(APIstub, trxArgs.CollectionID, trxArgs.InvokePayload.ObserverID) {
-			return shim.Success(nil)
-		}
 		return alli.HandleInvoke(APIstub)
 	}
 
 	return shim.Error("unkown transaction type")
 }
 
-func canReadPrivate(APIstub shim.ChaincodeStubInterface, collectionID string, alliUUID uint32) bool {
-
-	alliName := fmt.Sprintf("alliance%v", alliUUID)
-	_, err := APIstub.GetPrivateData(collectionID, alliName)
-	log.Printf("Tested if it can read private data %v: %v", collectionID, err)
-	return err != nil
-}
-
 // The main function is only relevant in unit test mode. Only included here for completeness.
 func main() {
 
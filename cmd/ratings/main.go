@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/ratings"
+)
+
+// RatingsChaincode keeps the ratings shared by the games. It is
+// instantiated with the names of the game chaincodes as init args.
+type RatingsChaincode struct {
+}
+
+func (rc *RatingsChaincode) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return ratings.HandleInit(APIstub)
+}
+
+func (rc *RatingsChaincode) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return ratings.HandleInvoke(APIstub)
+}
+
+func main() {
+	err := shim.Start(new(RatingsChaincode))
+	if err != nil {
+		fmt.Printf("Error creating new Smart Contract: %s", err)
+	}
+}
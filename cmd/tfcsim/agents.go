@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/stefanprisca/strategy-code/mcts"
+	"github.com/stefanprisca/strategy-code/tfc/bot"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// Turn is what an agent gets to see when it has to move.
+type Turn struct {
+	State  tfcPb.GameData
+	Player tfcPb.Player
+	Legal  []tfcPb.GameContractTrxArgs
+	Rnd    *rand.Rand
+}
+
+// Agent picks the moves of a player. It returns the moves it would like
+// to make, best first. The simulator applies the first one the rules
+// accept, so agents are free to propose moves which get blocked.
+type Agent interface {
+	Moves(turn Turn) []tfcPb.GameContractTrxArgs
+}
+
+// agents maps the strategy names accepted on the command line.
+var agents = map[string]func() Agent{
+	"random": func() Agent { return randomAgent{} },
+	"greedy": func() Agent { return greedyAgent{} },
+	"trader": func() Agent { return traderAgent{} },
+	"bot":    func() Agent { return botAgent{} },
+	"mcts":   func() Agent { return mctsAgent{} },
+}
+
+// randomAgent plays a random legal move.
+type randomAgent struct{}
+
+func (randomAgent) Moves(turn Turn) []tfcPb.GameContractTrxArgs {
+	return []tfcPb.GameContractTrxArgs{turn.Legal[turn.Rnd.Intn(len(turn.Legal))]}
+}
+
+// greedyAgent never trades, and builds whatever it can afford, settlements
+// first. It picks settlement spots by production, without checking the
+// distance rule, and then tries the free roads in random order.
+type greedyAgent struct{}
+
+func (greedyAgent) Moves(turn Turn) []tfcPb.GameContractTrxArgs {
+	switch turn.State.State {
+	case tfcPb.GameState_RDEV, tfcPb.GameState_GDEV, tfcPb.GameState_BDEV:
+		return append(buildCandidates(turn), nextMove)
+	}
+	return []tfcPb.GameContractTrxArgs{turn.Legal[len(turn.Legal)-1]}
+}
+
+// traderAgent gives away single resources to random other players before
+// building, without checking if it holds them.
+type traderAgent struct{}
+
+func (traderAgent) Moves(turn Turn) []tfcPb.GameContractTrxArgs {
+	switch turn.State.State {
+	case tfcPb.GameState_RTRADE, tfcPb.GameState_GTRADE, tfcPb.GameState_BTRADE:
+		others := []tfcPb.Player{}
+		for _, p := range engine.Players {
+			if p != turn.Player {
+				others = append(others, p)
+			}
+		}
+		dest := others[turn.Rnd.Intn(len(others))]
+		r := engine.Resources[turn.Rnd.Intn(len(engine.Resources))]
+		return []tfcPb.GameContractTrxArgs{{
+			Type: tfcPb.GameTrxType_TRADE,
+			TradeTrxPayload: &tfcPb.TradeTrxPayload{
+				Source: turn.Player, Dest: dest, Resource: r, Amount: 1,
+			},
+		}, nextMove}
+	}
+	return greedyAgent{}.Moves(turn)
+}
+
+// botAgent plays the move picked by the heuristic bot.
+type botAgent struct{}
+
+func (botAgent) Moves(turn Turn) []tfcPb.GameContractTrxArgs {
+	ab, err := bot.New(turn.Player, bot.DefaultWeights).NextMove(turn.State)
+	if err != nil {
+		return []tfcPb.GameContractTrxArgs{}
+	}
+	return []tfcPb.GameContractTrxArgs{*ab.Args()}
+}
+
+// mctsAgent plays the move found by a short tree search.
+type mctsAgent struct{}
+
+func (mctsAgent) Moves(turn Turn) []tfcPb.GameContractTrxArgs {
+	ab, err := bot.SearchMove(turn.State, mcts.Config{
+		Iterations:   100,
+		RolloutDepth: 20,
+		Rnd:          turn.Rnd,
+	})
+	if err != nil {
+		return []tfcPb.GameContractTrxArgs{}
+	}
+	return []tfcPb.GameContractTrxArgs{*ab.Args()}
+}
+
+var nextMove = tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT}
+
+func canAfford(turn Turn, buildType tfcPb.BuildType) bool {
+	hand := turn.State.Profiles[engine.GetPlayerId(turn.Player)].Resources
+	for rID, amount := range engine.BuildCost(buildType) {
+		if hand[rID] < amount {
+			return false
+		}
+	}
+	return true
+}
+
+func buildCandidates(turn Turn) []tfcPb.GameContractTrxArgs {
+	gb := turn.State.Board
+	moves := []tfcPb.GameContractTrxArgs{}
+	production := engine.IntersectionProduction(*gb)
+
+	free := []uint32{}
+	for iID, I := range gb.Intersections {
+		if canAfford(turn, tfcPb.BuildType_SETTLE) && I.Attributes.Settlement == tfcPb.Settlement_NOSETTLE {
+			free = append(free, iID)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool {
+		if production[free[i]] != production[free[j]] {
+			return production[free[i]] > production[free[j]]
+		}
+		return free[i] < free[j]
+	})
+
+	for _, iID := range free {
+		moves = append(moves, tfcPb.GameContractTrxArgs{
+			Type: tfcPb.GameTrxType_DEV,
+			BuildTrxPayload: &tfcPb.BuildTrxPayload{
+				Type:               tfcPb.BuildType_SETTLE,
+				BuildSettlePayload: &tfcPb.BuildSettlePayload{Player: turn.Player, SettleID: iID},
+			},
+		})
+	}
+
+	roads := []uint32{}
+	for eID, E := range gb.Edges {
+		if canAfford(turn, tfcPb.BuildType_ROAD) && E.Attributes.Road == tfcPb.Road_NOROAD {
+			roads = append(roads, eID)
+		}
+	}
+	sort.Slice(roads, func(i, j int) bool { return roads[i] < roads[j] })
+	turn.Rnd.Shuffle(len(roads), func(i, j int) { roads[i], roads[j] = roads[j], roads[i] })
+	for _, eID := range roads {
+		moves = append(moves, tfcPb.GameContractTrxArgs{
+			Type: tfcPb.GameTrxType_DEV,
+			BuildTrxPayload: &tfcPb.BuildTrxPayload{
+				Type:             tfcPb.BuildType_ROAD,
+				BuildRoadPayload: &tfcPb.BuildRoadPayload{Player: turn.Player, EdgeID: eID},
+			},
+		})
+	}
+	return moves
+}
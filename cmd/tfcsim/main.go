@@ -0,0 +1,117 @@
+// Copyright 2019 Stefan Prisca
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command tfcsim plays TFC games in-process against the rule engine,
+// and reports how the agents did. The games never touch a ledger, so
+// thousands of them run in seconds.
+//
+//	tfcsim -games 1000 -seats random,greedy,trader
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+func main() {
+	games := flag.Int("games", 1000, "number of games to play")
+	seed := flag.Int64("seed", 1, "seed of the first game, the next ones count up from it")
+	seats := flag.String("seats", "random,greedy,trader",
+		"agents for the RED, GREEN and BLUE seats; one of random, greedy, trader, bot, mcts")
+	maxRounds := flag.Int("max-rounds", 100, "rounds after which a game without winner is stopped")
+	maxAttempts := flag.Int("max-attempts", 20, "proposed moves tried before a phase is ended")
+	maxPhaseMoves := flag.Int("max-phase-moves", 5, "trades or builds allowed in one phase")
+	flag.Parse()
+
+	agentNames := strings.Split(*seats, ",")
+	cfg := Config{
+		Games:         *games,
+		Seed:          *seed,
+		MaxRounds:     *maxRounds,
+		MaxAttempts:   *maxAttempts,
+		MaxPhaseMoves: *maxPhaseMoves,
+	}
+	for _, name := range agentNames {
+		newAgent, ok := agents[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown agent <%v>\n", name)
+			os.Exit(2)
+		}
+		cfg.Seats = append(cfg.Seats, newAgent())
+	}
+
+	stats, err := Run(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulation failed: %s\n", err)
+		os.Exit(1)
+	}
+	printReport(os.Stdout, agentNames, stats)
+}
+
+func printReport(w io.Writer, agentNames []string, stats *Stats) {
+	games := float64(stats.Games)
+	fmt.Fprintf(w, "games: %v, unfinished: %v\n", stats.Games, stats.Unfinished)
+	fmt.Fprintf(w, "average length: %.1f rounds, %.1f moves\n\n",
+		float64(stats.Rounds)/games, float64(stats.Moves)/games)
+
+	fmt.Fprintf(w, "%-6s %-8s %8s %8s %8s %8s %8s %8s\n",
+		"seat", "agent", "win %", "points", "roads", "settles", "traded", "spent")
+	for i, p := range engine.Players {
+		seat := stats.Seats[p]
+		fmt.Fprintf(w, "%-6v %-8s %8.1f %8.1f %8.1f %8.1f %8.1f %8.1f\n",
+			p, agentNames[i],
+			100*float64(seat.Wins)/games,
+			float64(seat.Points)/games,
+			float64(seat.Builds[engine.ROAD_BUILT])/games,
+			float64(seat.Builds[engine.SETTLEMENT_BUILT])/games,
+			float64(total(seat.Traded))/games,
+			float64(total(seat.Spent))/games)
+	}
+
+	fmt.Fprintf(w, "\nresource flow, per game\n")
+	fmt.Fprintf(w, "%-10s %8s %8s\n", "resource", "traded", "spent")
+	for _, r := range engine.Resources {
+		traded, spent := 0, 0
+		for _, seat := range stats.Seats {
+			traded += seat.Traded[r]
+			spent += seat.Spent[r]
+		}
+		fmt.Fprintf(w, "%-10v %8.1f %8.1f\n", r, float64(traded)/games, float64(spent)/games)
+	}
+
+	fmt.Fprintf(w, "\nblocked moves, per game\n")
+	rules := []string{}
+	for rule := range stats.Blocked {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		fmt.Fprintf(w, "%-20s %8.1f\n", rule, float64(stats.Blocked[rule])/games)
+	}
+}
+
+func total(resources map[tfcPb.Resource]int) int {
+	sum := 0
+	for _, amount := range resources {
+		sum += amount
+	}
+	return sum
+}
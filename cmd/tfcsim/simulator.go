@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// Config sets up a batch of simulated games.
+type Config struct {
+	Games int
+	Seed  int64
+	// Seats holds the agent of each player, in turn order.
+	Seats []Agent
+	// MaxRounds ends games which nobody wins.
+	MaxRounds int
+	// MaxAttempts is how many proposed moves are tried before
+	// the player is made to end the phase.
+	MaxAttempts int
+	// MaxPhaseMoves caps the trades or builds made in a single phase.
+	MaxPhaseMoves int
+}
+
+// SeatStats holds the results of one seat over all games.
+type SeatStats struct {
+	Wins int
+	// Points is the sum of the final points over all games.
+	Points int
+	// Traded and Spent count resources given away and used for builds.
+	Traded map[tfcPb.Resource]int
+	Spent  map[tfcPb.Resource]int
+	Builds map[engine.EventType]int
+}
+
+// Stats holds the results of a batch of games.
+type Stats struct {
+	Games      int
+	Unfinished int
+	Rounds     int
+	Moves      int
+	Seats      map[tfcPb.Player]*SeatStats
+	// Blocked counts the proposed moves rejected by each rule.
+	Blocked map[string]int
+}
+
+func newStats() *Stats {
+	stats := &Stats{
+		Seats:   make(map[tfcPb.Player]*SeatStats),
+		Blocked: make(map[string]int),
+	}
+	for _, p := range engine.Players {
+		stats.Seats[p] = &SeatStats{
+			Traded: make(map[tfcPb.Resource]int),
+			Spent:  make(map[tfcPb.Resource]int),
+			Builds: make(map[engine.EventType]int),
+		}
+	}
+	return stats
+}
+
+// blockingRule names the rule behind an engine error.
+func blockingRule(err error) string {
+	if rule, ok := engine.BrokenRule(err); ok {
+		return string(rule)
+	}
+	return "other"
+}
+
+// Run plays all the games of the batch.
+func Run(cfg Config) (*Stats, error) {
+	if len(cfg.Seats) != len(engine.Players) {
+		return nil, fmt.Errorf("expected %v seats, got %v", len(engine.Players), len(cfg.Seats))
+	}
+
+	stats := newStats()
+	for g := 0; g < cfg.Games; g++ {
+		err := playGame(cfg, cfg.Seed+int64(g), stats)
+		if err != nil {
+			return nil, fmt.Errorf("game %v failed: %s", g, err)
+		}
+	}
+	return stats, nil
+}
+
+func playGame(cfg Config, seed int64, stats *Stats) error {
+	rnd := rand.New(rand.NewSource(seed))
+	gameData, err := engine.NewGameData(seed)
+	if err != nil {
+		return err
+	}
+
+	state := *gameData
+	seats := make(map[tfcPb.Player]Agent)
+	for i, p := range engine.Players {
+		seats[p] = cfg.Seats[i]
+		state, _, err = engine.Apply(state, p, tfcPb.GameContractTrxArgs{
+			Type:           tfcPb.GameTrxType_JOIN,
+			JoinTrxPayload: &tfcPb.JoinTrxPayload{Player: p},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	stats.Games++
+	rounds, phaseMoves := 0, 0
+	for rounds < cfg.MaxRounds {
+		player, ok := engine.TurnOf(state.State)
+		if !ok {
+			break
+		}
+
+		legal := engine.LegalMoves(state, player)
+		if len(legal) == 0 {
+			return fmt.Errorf("no legal moves for %v in state %v", player, state.State)
+		}
+
+		// NEXT or ROLL always ends the phase
+		endPhase := legal[len(legal)-1]
+		proposed := []tfcPb.GameContractTrxArgs{endPhase}
+		if phaseMoves < cfg.MaxPhaseMoves {
+			proposed = seats[player].Moves(Turn{State: state, Player: player, Legal: legal, Rnd: rnd})
+		}
+		if len(proposed) > cfg.MaxAttempts {
+			proposed = proposed[:cfg.MaxAttempts]
+		}
+		proposed = append(proposed, endPhase)
+
+		applied := false
+		for _, move := range proposed {
+			newState, events, err := engine.Apply(state, player, move)
+			if err != nil {
+				stats.Blocked[blockingRule(err)]++
+				continue
+			}
+
+			stats.Moves++
+			phaseMoves++
+			for _, event := range events {
+				recordEvent(stats, move.Type, event)
+				if event.Type == engine.STATE_CHANGED {
+					phaseMoves = 0
+					if event.State == tfcPb.GameState_RROLL {
+						rounds++
+					}
+				}
+			}
+			state = newState
+			applied = true
+			break
+		}
+		if !applied {
+			return fmt.Errorf("%v could not end the phase in state %v", player, state.State)
+		}
+	}
+
+	if _, won := engine.Winner(state.State); !won {
+		stats.Unfinished++
+	}
+	stats.Rounds += rounds
+	for pID, profile := range state.Profiles {
+		stats.Seats[tfcPb.Player(pID)].Points += int(profile.WinningPoints)
+	}
+	return nil
+}
+
+func recordEvent(stats *Stats, trxType tfcPb.GameTrxType, event engine.Event) {
+	seat, ok := stats.Seats[event.Player]
+	if !ok {
+		return
+	}
+
+	switch event.Type {
+	case engine.GAME_WON:
+		seat.Wins++
+	case engine.ROAD_BUILT, engine.SETTLEMENT_BUILT:
+		seat.Builds[event.Type]++
+	case engine.RESOURCES_MOVED:
+		for rID, amount := range event.Resources {
+			switch {
+			case amount >= 0:
+				continue
+			case trxType == tfcPb.GameTrxType_TRADE:
+				seat.Traded[tfcPb.Resource(rID)] -= int(amount)
+			default:
+				seat.Spent[tfcPb.Resource(rID)] -= int(amount)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	cfg := Config{
+		Games:         10,
+		Seed:          1,
+		Seats:         []Agent{randomAgent{}, greedyAgent{}, traderAgent{}},
+		MaxRounds:     100,
+		MaxAttempts:   20,
+		MaxPhaseMoves: 5,
+	}
+	stats, err := Run(cfg)
+	require.NoError(t, err)
+	require.Equal(t, 10, stats.Games)
+
+	wins := 0
+	for _, p := range engine.Players {
+		wins += stats.Seats[p].Wins
+	}
+	require.Equal(t, stats.Games, wins+stats.Unfinished)
+	require.NotZero(t, stats.Blocked["settlement distance"],
+		"expected the greedy agent to be blocked by the distance rule")
+
+	again, err := Run(cfg)
+	require.NoError(t, err)
+	require.Equal(t, stats, again, "expected the same seed to play the same games")
+}
+
+func TestRunNeedsEverySeat(t *testing.T) {
+	_, err := Run(Config{Games: 1, Seats: []Agent{randomAgent{}}})
+	require.Error(t, err)
+}
+
+func TestBlockingRule(t *testing.T) {
+	state, err := engine.NewGameData(1)
+	require.NoError(t, err)
+	_, _, err = engine.Apply(*state, tfcPb.Player_RED, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT})
+	require.Equal(t, "turn order", blockingRule(err))
+	require.Equal(t, "other", blockingRule(errors.New("something else")))
+}
+
+func TestTraderTradesWithOthers(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, p := range engine.Players {
+		turn := Turn{State: tfcPb.GameData{State: tfcPb.GameState_RTRADE}, Player: p, Rnd: rnd}
+		for i := 0; i < 20; i++ {
+			trade := traderAgent{}.Moves(turn)[0].TradeTrxPayload
+			require.NotNil(t, trade)
+			require.NotEqual(t, p, trade.Dest)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package mcts implements Monte Carlo tree search over any turn based game.
+// It only depends on the standard library, so that every game contract
+// can vendor it.
+package mcts
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Move is a move of the game. The search only hands moves back to the
+// state which listed them.
+type Move interface{}
+
+// State is a position of the game, as seen by the search.
+// Implementations must not change the state in Apply.
+type State interface {
+	// Player returns the player to move.
+	Player() int
+	// LegalMoves lists the moves the player to move can make.
+	LegalMoves() []Move
+	// Apply returns the state reached by the move.
+	Apply(move Move) (State, error)
+	// Terminal tells if the game is over.
+	Terminal() bool
+	// Reward returns the value of the state for the player, between 0 and 1.
+	// On states which are not terminal it is an estimate, used when
+	// a rollout runs out of depth.
+	Reward(player int) float64
+}
+
+// DEFAULT_EXPLORATION is the UCT exploration constant, sqrt(2).
+const DEFAULT_EXPLORATION = math.Sqrt2
+
+// Config sets the budget and the tuning of a search. The search stops at
+// whichever of Iterations and Duration is reached first; at least one of
+// them must be set.
+type Config struct {
+	Iterations int
+	Duration   time.Duration
+	// Exploration is the UCT constant. It defaults to DEFAULT_EXPLORATION.
+	Exploration float64
+	// RolloutDepth caps the moves of a random playout. Zero means
+	// playing until the game is over.
+	RolloutDepth int
+	Rnd          *rand.Rand
+}
+
+// Result is the outcome of a search.
+type Result struct {
+	Move Move
+	// Iterations is the number of playouts run.
+	Iterations int
+	// Visits and Value are the statistics of the chosen move.
+	// Value is the average reward for the player to move.
+	Visits int
+	Value  float64
+}
+
+type node struct {
+	state    State
+	move     Move
+	parent   *node
+	children []*node
+	untried  []Move
+	// player made the move leading to this node; value is from their side.
+	player int
+	visits int
+	value  float64
+}
+
+func newNode(state State, move Move, parent *node, player int) *node {
+	n := &node{state: state, move: move, parent: parent, player: player}
+	if !state.Terminal() {
+		n.untried = state.LegalMoves()
+	}
+	return n
+}
+
+func (n *node) selectChild(exploration float64) *node {
+	var best *node
+	bestScore := math.Inf(-1)
+	logVisits := math.Log(float64(n.visits))
+	for _, c := range n.children {
+		score := c.value/float64(c.visits) +
+			exploration*math.Sqrt(logVisits/float64(c.visits))
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+// Search looks for the best move of the player to move in the root state.
+func Search(root State, cfg Config) (Result, error) {
+	if root.Terminal() {
+		return Result{}, fmt.Errorf("the game is already over")
+	}
+	if cfg.Iterations <= 0 && cfg.Duration <= 0 {
+		return Result{}, fmt.Errorf("the search needs an iteration or time budget")
+	}
+	if cfg.Exploration == 0 {
+		cfg.Exploration = DEFAULT_EXPLORATION
+	}
+	if cfg.Rnd == nil {
+		cfg.Rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	rootNode := newNode(root, nil, nil, -1)
+	if len(rootNode.untried) == 0 {
+		return Result{}, fmt.Errorf("player %v has no legal moves", root.Player())
+	}
+
+	deadline := time.Now().Add(cfg.Duration)
+	iterations := 0
+	for ; cfg.Iterations <= 0 || iterations < cfg.Iterations; iterations++ {
+		if cfg.Duration > 0 && !time.Now().Before(deadline) {
+			break
+		}
+
+		// Selection
+		n := rootNode
+		for len(n.untried) == 0 && len(n.children) > 0 {
+			n = n.selectChild(cfg.Exploration)
+		}
+
+		// Expansion
+		if len(n.untried) > 0 {
+			i := cfg.Rnd.Intn(len(n.untried))
+			move := n.untried[i]
+			n.untried = append(n.untried[:i], n.untried[i+1:]...)
+
+			state, err := n.state.Apply(move)
+			if err != nil {
+				return Result{}, fmt.Errorf("could not apply legal move %v: %s", move, err)
+			}
+			child := newNode(state, move, n, n.state.Player())
+			n.children = append(n.children, child)
+			n = child
+		}
+
+		// Rollout
+		final, err := rollout(n.state, cfg)
+		if err != nil {
+			return Result{}, err
+		}
+
+		// Backpropagation
+		rewards := make(map[int]float64)
+		for ; n != nil; n = n.parent {
+			n.visits++
+			if n.parent == nil {
+				continue
+			}
+			if _, ok := rewards[n.player]; !ok {
+				rewards[n.player] = final.Reward(n.player)
+			}
+			n.value += rewards[n.player]
+		}
+	}
+
+	var best *node
+	for _, c := range rootNode.children {
+		if best == nil || c.visits > best.visits {
+			best = c
+		}
+	}
+	if best == nil {
+		return Result{}, fmt.Errorf("the budget did not allow a single iteration")
+	}
+
+	return Result{
+		Move:       best.move,
+		Iterations: iterations,
+		Visits:     best.visits,
+		Value:      best.value / float64(best.visits),
+	}, nil
+}
+
+func rollout(state State, cfg Config) (State, error) {
+	for depth := 0; !state.Terminal(); depth++ {
+		if cfg.RolloutDepth > 0 && depth >= cfg.RolloutDepth {
+			break
+		}
+
+		moves := state.LegalMoves()
+		if len(moves) == 0 {
+			break
+		}
+
+		move := moves[cfg.Rnd.Intn(len(moves))]
+		next, err := state.Apply(move)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply legal move %v: %s", move, err)
+		}
+		state = next
+	}
+	return state, nil
+}
@@ -0,0 +1,77 @@
+package mcts
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// nim is a pile of stones. Players take 1 to 3 stones in turns,
+// and whoever takes the last stone wins.
+type nim struct {
+	stones int
+	player int
+}
+
+func (n nim) Player() int { return n.player }
+
+func (n nim) LegalMoves() []Move {
+	moves := []Move{}
+	for take := 1; take <= 3 && take <= n.stones; take++ {
+		moves = append(moves, take)
+	}
+	return moves
+}
+
+func (n nim) Apply(move Move) (State, error) {
+	take := move.(int)
+	if take < 1 || take > 3 || take > n.stones {
+		return nil, fmt.Errorf("can not take %v stones out of %v", take, n.stones)
+	}
+	return nim{stones: n.stones - take, player: 1 - n.player}, nil
+}
+
+func (n nim) Terminal() bool { return n.stones == 0 }
+
+// The player who would move next lost, since the other one took the last stone.
+func (n nim) Reward(player int) float64 {
+	if !n.Terminal() {
+		return 0.5
+	}
+	if player == n.player {
+		return 0
+	}
+	return 1
+}
+
+func TestSearchFindsTheWinningMove(t *testing.T) {
+	for stones, take := range map[int]int{5: 1, 6: 2, 7: 3, 10: 2} {
+		result, err := Search(nim{stones: stones}, Config{
+			Iterations: 3000,
+			Rnd:        rand.New(rand.NewSource(1)),
+		})
+		require.NoError(t, err)
+		require.Equal(t, take, result.Move, "expected to take %v out of %v stones", take, stones)
+		require.True(t, result.Value > 0.5)
+	}
+}
+
+func TestSearchTimeBudget(t *testing.T) {
+	start := time.Now()
+	result, err := Search(nim{stones: 21}, Config{Duration: 50 * time.Millisecond})
+	require.NoError(t, err)
+	require.NotNil(t, result.Move)
+	require.NotZero(t, result.Iterations)
+	require.True(t, time.Since(start) < time.Second)
+}
+
+func TestSearchNeedsABudget(t *testing.T) {
+	_, err := Search(nim{stones: 3}, Config{})
+	require.Error(t, err)
+
+	_, err = Search(nim{stones: 0}, Config{Iterations: 10})
+	require.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package ratings
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// RATINGS_CHAINCODE is the name of the ratings chaincode, which must run
+// on the same channel as the games it rates.
+const RATINGS_CHAINCODE = "ratings"
+
+// RECORD_FCN is the function name used by the game contracts to record
+// the standings of a finished game, given as JSON.
+const RECORD_FCN = "record"
+
+// GAMES_KEY holds the names of the game chaincodes allowed to record
+// results, as given to the init of the ratings chaincode.
+const GAMES_KEY = "ratings.games"
+
+// HandleInit saves the names of the game chaincodes, which are the
+// arguments following the function name.
+func HandleInit(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	if len(args) < 2 {
+		return shim.Error("expected the names of the game chaincodes")
+	}
+
+	games := []string{}
+	for _, arg := range args[1:] {
+		games = append(games, string(arg))
+	}
+	jsonData, err := json.Marshal(games)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the game chaincodes: %s", err))
+	}
+
+	err = APIstub.PutState(GAMES_KEY, jsonData)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not save the game chaincodes: %s", err))
+	}
+	return shim.Success(nil)
+}
+
+// HandleInvoke dispatches the functions of the ratings chaincode.
+func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	switch string(APIstub.GetArgs()[0]) {
+	case RECORD_FCN:
+		return HandleRecord(APIstub)
+	case LEADERBOARD_FCN:
+		return HandleLeaderboard(APIstub)
+	}
+	return shim.Error(fmt.Sprintf("unknown ratings function <%s>", APIstub.GetArgs()[0]))
+}
+
+// HandleRecord rates a finished game. Chaincodes called by another one
+// get the proposal sent to the caller, so the proposal names the game
+// chaincode when a game records its result. Results sent by clients
+// directly to the ratings chaincode are rejected.
+func HandleRecord(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	if len(args) != 2 {
+		return shim.Error("expected the standings of the game")
+	}
+
+	caller, err := proposalChaincode(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	games, err := getGames(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !contains(games, caller) {
+		return shim.Error(fmt.Sprintf("only the game chaincodes %v can record results, not <%s>",
+			games, caller))
+	}
+
+	standings := Standings{}
+	err = json.Unmarshal(args[1], &standings)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not unmarshal the standings: %s", err))
+	}
+
+	err = RecordResult(APIstub, standings)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// Record sends the standings of a finished game to the ratings chaincode.
+// It is called by the game contracts, in the transaction ending the game.
+func Record(APIstub shim.ChaincodeStubInterface, standings Standings) error {
+	jsonData, err := json.Marshal(standings)
+	if err != nil {
+		return fmt.Errorf("could not marshal the standings: %s", err)
+	}
+
+	resp := APIstub.InvokeChaincode(RATINGS_CHAINCODE, [][]byte{[]byte(RECORD_FCN), jsonData}, "")
+	if resp.Status != shim.OK {
+		return fmt.Errorf("could not record the result of the game: %s", resp.Message)
+	}
+	return nil
+}
+
+// QueryLeaderboard answers the leaderboard query of a game contract from
+// the ratings chaincode. Only the limit is passed on, so that callers of
+// the game cannot reach other functions of the ratings chaincode.
+func QueryLeaderboard(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := [][]byte{[]byte(LEADERBOARD_FCN)}
+	if gameArgs := APIstub.GetArgs(); len(gameArgs) > 1 {
+		args = append(args, gameArgs[1])
+	}
+	return APIstub.InvokeChaincode(RATINGS_CHAINCODE, args, "")
+}
+
+// proposalChaincode returns the name of the chaincode the transaction
+// proposal was sent to.
+func proposalChaincode(APIstub shim.ChaincodeStubInterface) (string, error) {
+	signedProposal, err := APIstub.GetSignedProposal()
+	if err != nil || signedProposal == nil {
+		return "", fmt.Errorf("could not get the signed proposal: %v", err)
+	}
+
+	proposal := &pb.Proposal{}
+	if err = proto.Unmarshal(signedProposal.ProposalBytes, proposal); err != nil {
+		return "", fmt.Errorf("could not unmarshal the proposal: %s", err)
+	}
+	header := &common.Header{}
+	if err = proto.Unmarshal(proposal.Header, header); err != nil {
+		return "", fmt.Errorf("could not unmarshal the proposal header: %s", err)
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err = proto.Unmarshal(header.ChannelHeader, channelHeader); err != nil {
+		return "", fmt.Errorf("could not unmarshal the channel header: %s", err)
+	}
+	extension := &pb.ChaincodeHeaderExtension{}
+	if err = proto.Unmarshal(channelHeader.Extension, extension); err != nil {
+		return "", fmt.Errorf("could not unmarshal the chaincode header: %s", err)
+	}
+	if extension.ChaincodeId == nil {
+		return "", fmt.Errorf("the proposal names no chaincode")
+	}
+	return extension.ChaincodeId.Name, nil
+}
+
+func getGames(APIstub shim.ChaincodeStubInterface) ([]string, error) {
+	jsonData, err := APIstub.GetState(GAMES_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the game chaincodes: %s", err)
+	}
+
+	games := []string{}
+	if jsonData == nil {
+		return games, nil
+	}
+	if err = json.Unmarshal(jsonData, &games); err != nil {
+		return nil, fmt.Errorf("could not unmarshal the game chaincodes: %s", err)
+	}
+	return games, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
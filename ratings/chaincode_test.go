@@ -0,0 +1,80 @@
+package ratings
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// callerContract runs the ratings chaincode for transactions proposed to
+// the caller chaincode.
+type callerContract struct {
+	caller string
+}
+
+func (cc *callerContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return HandleInit(APIstub)
+}
+
+func (cc *callerContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return HandleInvoke(proposalStub{APIstub, ChaincodeProposal(cc.caller)})
+}
+
+func recordFrom(t *testing.T, stub *shim.MockStub, contract *callerContract, caller string,
+	standings Standings) pb.Response {
+
+	jsonData, err := json.Marshal(standings)
+	require.NoError(t, err)
+
+	contract.caller = caller
+	return stub.MockInvoke("record", [][]byte{[]byte(RECORD_FCN), jsonData})
+}
+
+func TestRecordFromGames(t *testing.T) {
+	contract := &callerContract{}
+	stub := shim.NewMockStub(RATINGS_CHAINCODE, contract)
+	r := stub.MockInit("init", [][]byte{[]byte("init"), []byte("tfc"), []byte("tictactoe")})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	r = recordFrom(t, stub, contract, "tfc", Standings{{"a"}, {"b"}, {"c"}})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	r = recordFrom(t, stub, contract, "tictactoe", Standings{{"a"}, {"b"}})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	// Both games rate the same players
+	rating, ok, err := GetRating(stub, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2, rating.Games)
+
+	// Clients calling the ratings chaincode, or other chaincodes, cannot
+	// make up results
+	for _, caller := range []string{RATINGS_CHAINCODE, "alliance"} {
+		r = recordFrom(t, stub, contract, caller, Standings{{"c"}, {"a"}})
+		require.EqualValues(t, shim.ERROR, r.Status, "recorded from %v", caller)
+		require.Contains(t, r.Message, "only the game chaincodes")
+	}
+
+	r = stub.MockInvoke("record", [][]byte{[]byte(RECORD_FCN), []byte("not standings")})
+	require.EqualValues(t, shim.ERROR, r.Status)
+
+	rating, _, err = GetRating(stub, "c")
+	require.NoError(t, err)
+	require.Equal(t, 1, rating.Games)
+}
+
+func TestRecordNeedsProposal(t *testing.T) {
+	stub := shim.NewMockStub(RATINGS_CHAINCODE, new(leaderboardContract))
+	stub.MockTransactionStart("init")
+	r := HandleInit(stub)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected the game chaincodes")
+	stub.MockTransactionEnd("init")
+
+	stub.MockTransactionStart("record")
+	defer stub.MockTransactionEnd("record")
+	_, err := proposalChaincode(stub)
+	require.Error(t, err)
+}
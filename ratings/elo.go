@@ -0,0 +1,105 @@
+// Package ratings keeps the Elo ratings of the players, shared by every
+// game. Players are keyed by the identity the game contracts bind them to,
+// which is the checksum of their creator signature, so a player has one
+// rating across the games. The ratings live in the namespace of the ratings
+// chaincode, which the game contracts call when their games are over, and
+// which only records results from the game chaincodes it was instantiated
+// with. Besides the standard library, it only depends on the chaincode shim
+// and the fabric protos, so that every game contract can vendor it.
+package ratings
+
+import (
+	"fmt"
+	"math"
+)
+
+// INITIAL_RATING is the rating of a player before their first game.
+const INITIAL_RATING = 1500.0
+
+// K_FACTOR is the most a rating can change by in a two player game.
+const K_FACTOR = 32.0
+
+// Rating is the rating of a player, and the number of games it is based on.
+type Rating struct {
+	Player string  `json:"player"`
+	Rating float64 `json:"rating"`
+	Games  int     `json:"games"`
+}
+
+// Standings are the final ranks of a game, best first. Players sharing
+// a rank tied with each other.
+type Standings [][]string
+
+// Players lists the players of the standings, best first.
+func (s Standings) Players() []string {
+	players := []string{}
+	for _, rank := range s {
+		players = append(players, rank...)
+	}
+	return players
+}
+
+// Expected returns the expected score of a player rated ra against one rated rb.
+func Expected(ra, rb float64) float64 {
+	return 1 / (1 + math.Pow(10, (rb-ra)/400))
+}
+
+// Update rates a game from the standings. Every pair of players is scored
+// as a two player game, 1 for the better rank and 0.5 for a tie. With more
+// than two players, the K factor is split between the opponents, so that
+// a game moves a rating at most by K_FACTOR. All pairs are scored against
+// the ratings from before the game.
+// Players missing from the ratings start at INITIAL_RATING.
+func Update(ratings map[string]Rating, standings Standings) (map[string]Rating, error) {
+	players := standings.Players()
+	if len(players) < 2 {
+		return nil, fmt.Errorf("a rated game needs at least two players, got %v", players)
+	}
+
+	rank := make(map[string]int)
+	for r, tied := range standings {
+		for _, p := range tied {
+			if _, ok := rank[p]; ok || p == "" {
+				return nil, fmt.Errorf("invalid player <%v> in the standings", p)
+			}
+			rank[p] = r
+		}
+	}
+
+	before := make(map[string]Rating)
+	for _, p := range players {
+		rating, ok := ratings[p]
+		if !ok {
+			rating = Rating{Player: p, Rating: INITIAL_RATING}
+		}
+		before[p] = rating
+	}
+
+	k := K_FACTOR / float64(len(players)-1)
+	updated := make(map[string]Rating)
+	for _, p := range players {
+		delta := 0.0
+		for _, o := range players {
+			if o == p {
+				continue
+			}
+			delta += k * (score(rank[p], rank[o]) - Expected(before[p].Rating, before[o].Rating))
+		}
+
+		rating := before[p]
+		rating.Rating += delta
+		rating.Games++
+		updated[p] = rating
+	}
+	return updated, nil
+}
+
+func score(rank, opponentRank int) float64 {
+	switch {
+	case rank < opponentRank:
+		return 1
+	case rank > opponentRank:
+		return 0
+	}
+	return 0.5
+}
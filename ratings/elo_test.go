@@ -0,0 +1,60 @@
+package ratings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpected(t *testing.T) {
+	require.InDelta(t, 0.5, Expected(1500, 1500), 1e-9)
+	require.InDelta(t, 1, Expected(1900, 1500)+Expected(1500, 1900), 1e-9)
+	require.InDelta(t, 0.909, Expected(1900, 1500), 1e-3)
+}
+
+func TestUpdateTwoPlayers(t *testing.T) {
+	updated, err := Update(map[string]Rating{}, Standings{{"a"}, {"b"}})
+	require.NoError(t, err)
+	require.InDelta(t, INITIAL_RATING+K_FACTOR/2, updated["a"].Rating, 1e-9)
+	require.InDelta(t, INITIAL_RATING-K_FACTOR/2, updated["b"].Rating, 1e-9)
+	require.Equal(t, 1, updated["a"].Games)
+
+	// A tie moves the ratings towards each other
+	updated, err = Update(updated, Standings{{"a", "b"}})
+	require.NoError(t, err)
+	require.True(t, updated["a"].Rating < INITIAL_RATING+K_FACTOR/2)
+	require.True(t, updated["b"].Rating > INITIAL_RATING-K_FACTOR/2)
+	require.InDelta(t, 2*INITIAL_RATING, updated["a"].Rating+updated["b"].Rating, 1e-9)
+	require.Equal(t, 2, updated["b"].Games)
+}
+
+func TestUpdateThreePlayers(t *testing.T) {
+	ratings := map[string]Rating{
+		"r": {Player: "r", Rating: 1600},
+		"g": {Player: "g", Rating: 1500},
+		"b": {Player: "b", Rating: 1400},
+	}
+	updated, err := Update(ratings, Standings{{"b"}, {"r", "g"}})
+	require.NoError(t, err)
+
+	total := 0.0
+	for _, p := range []string{"r", "g", "b"} {
+		total += updated[p].Rating - ratings[p].Rating
+	}
+	require.InDelta(t, 0, total, 1e-9, "expected the pairwise updates to be zero sum")
+	require.True(t, updated["b"].Rating-ratings["b"].Rating <= K_FACTOR)
+	require.True(t, updated["r"].Rating < ratings["r"].Rating)
+	require.True(t, updated["r"].Rating-ratings["r"].Rating < updated["g"].Rating-ratings["g"].Rating,
+		"expected the favourite to lose more on a tie with the weaker player")
+}
+
+func TestUpdateInvalidStandings(t *testing.T) {
+	for _, standings := range []Standings{
+		{{"a"}},
+		{{"a"}, {"a"}},
+		{{"a"}, {""}},
+	} {
+		_, err := Update(map[string]Rating{}, standings)
+		require.Error(t, err, "standings %v", standings)
+	}
+}
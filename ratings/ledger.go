@@ -0,0 +1,143 @@
+package ratings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// LEADERBOARD_FCN is the function name of the leaderboard query. It takes
+// an optional limit on the number of players as second argument.
+const LEADERBOARD_FCN = "leaderboard"
+
+// RATING_INDEX is the object type of the rating composite keys.
+// Ratings are keyed by player identity.
+const RATING_INDEX = "ratings.player"
+
+// RecordResult updates the ratings of the players from the standings
+// of a finished game.
+func RecordResult(APIstub shim.ChaincodeStubInterface, standings Standings) error {
+	ratings := make(map[string]Rating)
+	for _, p := range standings.Players() {
+		rating, ok, err := GetRating(APIstub, p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ratings[p] = rating
+		}
+	}
+
+	updated, err := Update(ratings, standings)
+	if err != nil {
+		return err
+	}
+
+	for p, rating := range updated {
+		jsonData, err := json.Marshal(rating)
+		if err != nil {
+			return fmt.Errorf("could not marshal the rating of <%v>: %s", p, err)
+		}
+
+		key, err := ratingKey(APIstub, p)
+		if err != nil {
+			return err
+		}
+		if err = APIstub.PutState(key, jsonData); err != nil {
+			return fmt.Errorf("could not save the rating of <%v>: %s", p, err)
+		}
+	}
+	return nil
+}
+
+// GetRating returns the rating of the player, and whether they have one.
+func GetRating(APIstub shim.ChaincodeStubInterface, player string) (Rating, bool, error) {
+	key, err := ratingKey(APIstub, player)
+	if err != nil {
+		return Rating{}, false, err
+	}
+
+	jsonData, err := APIstub.GetState(key)
+	if err != nil {
+		return Rating{}, false, fmt.Errorf("could not get the rating of <%v>: %s", player, err)
+	}
+	if jsonData == nil {
+		return Rating{}, false, nil
+	}
+
+	rating := Rating{}
+	if err = json.Unmarshal(jsonData, &rating); err != nil {
+		return Rating{}, false, fmt.Errorf("could not unmarshal the rating of <%v>: %s", player, err)
+	}
+	return rating, true, nil
+}
+
+// Leaderboard returns the rated players, best first. A limit above zero
+// caps the number of players returned.
+func Leaderboard(APIstub shim.ChaincodeStubInterface, limit int) ([]Rating, error) {
+	iter, err := APIstub.GetStateByPartialCompositeKey(RATING_INDEX, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("could not query the ratings: %s", err)
+	}
+	defer iter.Close()
+
+	board := []Rating{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("could not iterate the ratings: %s", err)
+		}
+
+		rating := Rating{}
+		if err = json.Unmarshal(kv.Value, &rating); err != nil {
+			return nil, fmt.Errorf("could not unmarshal rating %v: %s", kv.Key, err)
+		}
+		board = append(board, rating)
+	}
+
+	// Ties keep the key order, so every endorser returns the same board
+	sort.SliceStable(board, func(i, j int) bool {
+		return board[i].Rating > board[j].Rating
+	})
+	if limit > 0 && len(board) > limit {
+		board = board[:limit]
+	}
+	return board, nil
+}
+
+// HandleLeaderboard answers the leaderboard query.
+func HandleLeaderboard(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+
+	limit := 0
+	if len(args) > 1 && len(args[1]) > 0 {
+		l, err := strconv.Atoi(string(args[1]))
+		if err != nil || l <= 0 {
+			return shim.Error(fmt.Sprintf("invalid leaderboard limit <%s>", args[1]))
+		}
+		limit = l
+	}
+
+	board, err := Leaderboard(APIstub, limit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(board)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the leaderboard: %s", err))
+	}
+	return shim.Success(jsonData)
+}
+
+func ratingKey(APIstub shim.ChaincodeStubInterface, player string) (string, error) {
+	key, err := APIstub.CreateCompositeKey(RATING_INDEX, []string{player})
+	if err != nil {
+		return "", fmt.Errorf("could not create the rating key of <%v>: %s", player, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,62 @@
+package ratings
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stretchr/testify/require"
+)
+
+type leaderboardContract struct{}
+
+func (lc *leaderboardContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (lc *leaderboardContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return HandleLeaderboard(APIstub)
+}
+
+func recordResult(t *testing.T, stub *shim.MockStub, standings Standings) {
+	stub.MockTransactionStart("result")
+	defer stub.MockTransactionEnd("result")
+	require.NoError(t, RecordResult(stub, standings))
+}
+
+func TestLeaderboard(t *testing.T) {
+	stub := shim.NewMockStub("ratings", new(leaderboardContract))
+	recordResult(t, stub, Standings{{"a"}, {"b"}})
+	recordResult(t, stub, Standings{{"a"}, {"c"}})
+	recordResult(t, stub, Standings{{"c"}, {"b"}})
+
+	rating, ok, err := GetRating(stub, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2, rating.Games)
+
+	_, ok, err = GetRating(stub, "d")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	r := stub.MockInvoke("board", [][]byte{[]byte(LEADERBOARD_FCN)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	board := []Rating{}
+	require.NoError(t, json.Unmarshal(r.Payload, &board))
+
+	players := []string{}
+	for _, rating := range board {
+		players = append(players, rating.Player)
+	}
+	require.Equal(t, []string{"a", "c", "b"}, players)
+
+	r = stub.MockInvoke("board", [][]byte{[]byte(LEADERBOARD_FCN), []byte("1")})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	require.NoError(t, json.Unmarshal(r.Payload, &board))
+	require.Len(t, board, 1)
+	require.Equal(t, "a", board[0].Player)
+
+	r = stub.MockInvoke("board", [][]byte{[]byte(LEADERBOARD_FCN), []byte("none")})
+	require.EqualValues(t, shim.ERROR, r.Status)
+}
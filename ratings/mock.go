@@ -0,0 +1,55 @@
+package ratings
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// MockLedger runs the ratings chaincode behind the mock stub of a game.
+// The mock stub does not pass the signed proposal on to the chaincodes it
+// calls, so the ledger sees the proposal of a transaction sent to Game.
+type MockLedger struct {
+	Game string
+}
+
+func (ml *MockLedger) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return HandleInit(APIstub)
+}
+
+func (ml *MockLedger) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return HandleInvoke(proposalStub{APIstub, ChaincodeProposal(ml.Game)})
+}
+
+// NewMockLedger adds a ratings chaincode for the game to the mock stub of
+// the game, and returns the stub of the ratings chaincode.
+func NewMockLedger(gameStub *shim.MockStub, game string) *shim.MockStub {
+	stub := shim.NewMockStub(RATINGS_CHAINCODE, &MockLedger{Game: game})
+	stub.MockInit(RATINGS_CHAINCODE, [][]byte{[]byte("init"), []byte(game)})
+	gameStub.MockPeerChaincode(RATINGS_CHAINCODE, stub)
+	return stub
+}
+
+// ChaincodeProposal returns a signed proposal sent to the chaincode.
+func ChaincodeProposal(chaincode string) *pb.SignedProposal {
+	extension, _ := proto.Marshal(&pb.ChaincodeHeaderExtension{
+		ChaincodeId: &pb.ChaincodeID{Name: chaincode},
+	})
+	channelHeader, _ := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		Extension: extension,
+	})
+	header, _ := proto.Marshal(&common.Header{ChannelHeader: channelHeader})
+	proposal, _ := proto.Marshal(&pb.Proposal{Header: header})
+	return &pb.SignedProposal{ProposalBytes: proposal}
+}
+
+type proposalStub struct {
+	shim.ChaincodeStubInterface
+	signedProposal *pb.SignedProposal
+}
+
+func (ps proposalStub) GetSignedProposal() (*pb.SignedProposal, error) {
+	return ps.signedProposal, nil
+}
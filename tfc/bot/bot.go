@@ -0,0 +1,207 @@
+// Package bot implements a computer player for TFC. The bot scores the
+// state reached by every legal move with a heuristic, and plays the best
+// one. Its moves are built with the tfc ArgsBuilder, so the same bot can
+// drive a real network or the mock stub.
+package bot
+
+import (
+	"fmt"
+
+	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// Heuristic rates a game state from the point of view of the player.
+// Higher is better.
+type Heuristic func(gameData tfcPb.GameData, player tfcPb.Player) float64
+
+// Weights configures the weighted heuristic.
+type Weights struct {
+	// Points weighs the winning points, scaled by how close they are
+	// to the win threshold.
+	Points float64
+	// Production weighs the expected production of the player's
+	// settlements, from the roll probabilities of the tiles around them.
+	Production float64
+	// Diversity weighs the number of resource types the settlements produce.
+	Diversity float64
+	// Hand weighs every resource card held. It keeps the bot from giving
+	// away resources for nothing.
+	Hand float64
+}
+
+// DefaultWeights builds whenever it can, and prefers settlements on
+// productive spots which add new resource types.
+var DefaultWeights = Weights{
+	Points:     10,
+	Production: 5,
+	Diversity:  0.5,
+	Hand:       0.05,
+}
+
+// WeightedHeuristic combines the production, diversity and win proximity
+// of the player with the given weights.
+func WeightedHeuristic(w Weights) Heuristic {
+	return func(gameData tfcPb.GameData, player tfcPb.Player) float64 {
+		profile, ok := gameData.Profiles[engine.GetPlayerId(player)]
+		if !ok {
+			return 0
+		}
+
+		if winner, won := engine.Winner(gameData.State); won {
+			if winner == player {
+				return w.Points * engine.WINNING_POINTS * 10
+			}
+		}
+
+		// Each point is worth more the closer it gets the player to a win
+		proximity := float64(profile.WinningPoints) / engine.WINNING_POINTS
+		score := w.Points * proximity * (1 + proximity)
+
+		production, resources := settlementYield(*gameData.Board, player)
+		score += w.Production * production
+		score += w.Diversity * float64(len(resources))
+
+		for _, amount := range profile.Resources {
+			score += w.Hand * float64(amount)
+		}
+		return score
+	}
+}
+
+// settlementYield returns the expected production of the player's
+// settlements, and the resource types they produce.
+func settlementYield(gb tfcPb.GameBoard, player tfcPb.Player) (float64, map[tfcPb.Resource]bool) {
+	production := engine.IntersectionProduction(gb)
+	tiles := engine.IntersectionTiles(gb)
+	settlement := playerSettlement(player)
+
+	total := 0.0
+	resources := make(map[tfcPb.Resource]bool)
+	for iID, I := range gb.Intersections {
+		if I.Attributes.Settlement != settlement {
+			continue
+		}
+		total += production[iID]
+		for _, tID := range tiles[iID] {
+			if T, ok := gb.Tiles[tID]; ok {
+				resources[T.Attributes.Resource] = true
+			}
+		}
+	}
+	return total, resources
+}
+
+func playerSettlement(player tfcPb.Player) tfcPb.Settlement {
+	switch player {
+	case tfcPb.Player_RED:
+		return tfcPb.Settlement_REDSETTLE
+	case tfcPb.Player_GREEN:
+		return tfcPb.Settlement_GREENSETTLE
+	case tfcPb.Player_BLUE:
+		return tfcPb.Settlement_BLUESETTLE
+	}
+	return tfcPb.Settlement_NOSETTLE
+}
+
+// Bot plays one seat of the game.
+type Bot struct {
+	Player    tfcPb.Player
+	Heuristic Heuristic
+}
+
+// New creates a bot for the player, using the weighted heuristic.
+func New(player tfcPb.Player, w Weights) *Bot {
+	return &Bot{Player: player, Heuristic: WeightedHeuristic(w)}
+}
+
+// NextMove picks the legal move leading to the best scored state.
+// Ties go to the move listed first, unless ending the phase is
+// among them.
+// While joining, the bot only takes its own seat.
+func (b *Bot) NextMove(gameData tfcPb.GameData) (*tfc.ArgsBuilder, error) {
+	if gameData.State == tfcPb.GameState_JOINING {
+		for _, move := range engine.LegalMoves(gameData, b.Player) {
+			if move.JoinTrxPayload.Player == b.Player {
+				return tfc.NewArgsBuilder().WithJoinArgs(b.Player), nil
+			}
+		}
+		return nil, fmt.Errorf("seat %v is already taken", b.Player)
+	}
+
+	moves := engine.LegalMoves(gameData, b.Player)
+	if len(moves) == 0 {
+		return nil, fmt.Errorf("%v has no legal moves in state %v", b.Player, gameData.State)
+	}
+
+	var best *tfcPb.GameContractTrxArgs
+	bestScore := 0.0
+	for i, move := range moves {
+		next, _, err := engine.Apply(gameData, b.Player, move)
+		if err != nil {
+			return nil, fmt.Errorf("legal move %v was rejected: %s", move, err)
+		}
+
+		score := b.Heuristic(next, b.Player)
+		if best == nil || score > bestScore || (score == bestScore && endsPhase(move)) {
+			best, bestScore = &moves[i], score
+		}
+	}
+	return argsFor(*best)
+}
+
+func endsPhase(move tfcPb.GameContractTrxArgs) bool {
+	return move.Type == tfcPb.GameTrxType_NEXT || move.Type == tfcPb.GameTrxType_ROLL
+}
+
+// argsFor rebuilds the move with the ArgsBuilder.
+func argsFor(move tfcPb.GameContractTrxArgs) (*tfc.ArgsBuilder, error) {
+	ab := tfc.NewArgsBuilder()
+	switch move.Type {
+	case tfcPb.GameTrxType_JOIN:
+		return ab.WithJoinArgs(move.JoinTrxPayload.Player), nil
+	case tfcPb.GameTrxType_ROLL:
+		return ab.WithRollArgs(), nil
+	case tfcPb.GameTrxType_NEXT:
+		return ab.WithNextArgs(), nil
+	case tfcPb.GameTrxType_TRADE:
+		p := move.TradeTrxPayload
+		return ab.WithTradeArgs(p.Source, p.Dest, p.Resource, p.Amount), nil
+	case tfcPb.GameTrxType_DEV:
+		switch move.BuildTrxPayload.Type {
+		case tfcPb.BuildType_ROAD:
+			p := move.BuildTrxPayload.BuildRoadPayload
+			return ab.WithBuildRoadArgs(p.Player, p.EdgeID), nil
+		case tfcPb.BuildType_SETTLE:
+			p := move.BuildTrxPayload.BuildSettlePayload
+			return ab.WithBuildSettleArgs(p.Player, p.SettleID), nil
+		}
+	}
+	return nil, fmt.Errorf("unkown move type %v", move.Type)
+}
+
+// GameDataFromView rebuilds the game data from a player's view of the game.
+// The hidden hands of the other players are left empty, which is all the
+// rules need to check the moves of the viewer.
+func GameDataFromView(view tfc.GameView) tfcPb.GameData {
+	profiles := make(map[int32]*tfcPb.PlayerProfile)
+	for pID, pView := range view.Profiles {
+		resources := make(map[int32]int32)
+		for rID, amount := range pView.Resources {
+			resources[rID] = amount
+		}
+		profiles[pID] = &tfcPb.PlayerProfile{
+			Resources:     resources,
+			WinningPoints: pView.WinningPoints,
+			Settlements:   pView.Settlements,
+			Roads:         pView.Roads,
+		}
+	}
+
+	return tfcPb.GameData{
+		Board:    view.Board,
+		State:    view.State,
+		Profiles: profiles,
+	}
+}
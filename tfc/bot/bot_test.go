@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func startedGame(t *testing.T) tfcPb.GameData {
+	gameData, err := engine.NewGameData(1010101)
+	require.NoError(t, err)
+
+	state := *gameData
+	for _, p := range engine.Players {
+		state, _, err = engine.Apply(state, p, *tfc.NewArgsBuilder().WithJoinArgs(p).Args())
+		require.NoError(t, err)
+	}
+	return state
+}
+
+func playMove(t *testing.T, state tfcPb.GameData, b *Bot) (tfcPb.GameData, tfcPb.GameContractTrxArgs) {
+	ab, err := b.NextMove(state)
+	require.NoError(t, err)
+	move := *ab.Args()
+
+	state, _, err = engine.Apply(state, b.Player, move)
+	require.NoError(t, err)
+	return state, move
+}
+
+func TestBotKeepsItsResources(t *testing.T) {
+	red := New(tfcPb.Player_RED, DefaultWeights)
+	state := startedGame(t)
+
+	state, move := playMove(t, state, red)
+	require.Equal(t, tfcPb.GameTrxType_ROLL, move.Type)
+
+	_, move = playMove(t, state, red)
+	require.Equal(t, tfcPb.GameTrxType_NEXT, move.Type,
+		"expected the bot not to give away resources")
+}
+
+func TestBotBuildsOnTheBestSpot(t *testing.T) {
+	red := New(tfcPb.Player_RED, DefaultWeights)
+	state := startedGame(t)
+	state, _ = playMove(t, state, red)
+	state, _ = playMove(t, state, red)
+	require.Equal(t, tfcPb.GameState_RDEV, state.State)
+
+	state, move := playMove(t, state, red)
+	require.Equal(t, tfcPb.GameTrxType_DEV, move.Type)
+	require.Equal(t, tfcPb.BuildType_SETTLE, move.BuildTrxPayload.Type)
+
+	production := engine.IntersectionProduction(*state.Board)
+	average := 0.0
+	for _, p := range production {
+		average += p / float64(len(production))
+	}
+	require.True(t, production[move.BuildTrxPayload.BuildSettlePayload.SettleID] > average,
+		"expected the bot to pick a productive spot")
+}
+
+func TestBotTakesTheWin(t *testing.T) {
+	red := New(tfcPb.Player_RED, DefaultWeights)
+	state := startedGame(t)
+	state, _ = playMove(t, state, red)
+	state, _ = playMove(t, state, red)
+
+	state.Profiles[engine.GetPlayerId(tfcPb.Player_RED)].WinningPoints = engine.WINNING_POINTS
+	state, move := playMove(t, state, red)
+	require.Equal(t, tfcPb.GameTrxType_NEXT, move.Type)
+	require.Equal(t, tfcPb.GameState_RWON, state.State)
+}
+
+func TestCustomHeuristic(t *testing.T) {
+	// A bot which loves giving away resources
+	generous := &Bot{
+		Player: tfcPb.Player_RED,
+		Heuristic: func(gameData tfcPb.GameData, player tfcPb.Player) float64 {
+			return -float64(gameData.Profiles[engine.GetPlayerId(player)].Resources[0])
+		},
+	}
+	state := startedGame(t)
+	state, _ = playMove(t, state, generous)
+
+	_, move := playMove(t, state, generous)
+	require.Equal(t, tfcPb.GameTrxType_TRADE, move.Type)
+	require.EqualValues(t, 5, move.TradeTrxPayload.Amount)
+}
+
+type mockContract struct{}
+
+func (mc *mockContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return tfc.HandleInit(APIstub)
+}
+
+func (mc *mockContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return tfc.HandleInvoke(saltedStub{APIstub})
+}
+
+// saltedStub adds the hand salt of the bots to the transient data, which
+// the mock stub does not implement.
+type saltedStub struct {
+	shim.ChaincodeStubInterface
+}
+
+func (ss saltedStub) GetTransient() (map[string][]byte, error) {
+	return map[string][]byte{tfc.HAND_SALT_KEY: []byte("the secret salt of a bot")}, nil
+}
+
+// The bots play on the mock stub, seeing the game only through their view.
+func TestBotsDriveTheContract(t *testing.T) {
+	stub := shim.NewMockStub("mockGameContract", new(mockContract))
+	r := stub.MockInit("01010101", [][]byte{})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	proposals := make(map[tfcPb.Player]*pb.SignedProposal)
+	bots := make(map[tfcPb.Player]*Bot)
+	for _, p := range engine.Players {
+		proposals[p] = &pb.SignedProposal{ProposalBytes: []byte{}, Signature: []byte(p.String())}
+		bots[p] = New(p, DefaultWeights)
+	}
+
+	for i, p := range engine.Players {
+		invoke(t, stub, proposals[p], bots[p], i)
+	}
+
+	for i := 0; i < 30; i++ {
+		view := queryView(t, stub, proposals[tfcPb.Player_RED])
+		player, ok := engine.TurnOf(view.State)
+		require.True(t, ok)
+		invoke(t, stub, proposals[player], bots[player], 3+i)
+	}
+
+	view := queryView(t, stub, proposals[tfcPb.Player_RED])
+	for _, p := range engine.Players {
+		require.NotZero(t, view.Profiles[engine.GetPlayerId(p)].WinningPoints,
+			"expected %v to have built something", p)
+	}
+}
+
+func invoke(t *testing.T, stub *shim.MockStub, sp *pb.SignedProposal, b *Bot, n int) {
+	view := queryView(t, stub, sp)
+	ab, err := b.NextMove(GameDataFromView(view))
+	require.NoError(t, err)
+
+	args, err := ab.Build()
+	require.NoError(t, err)
+	resp := stub.MockInvokeWithSignedProposal(strconv.Itoa(n), [][]byte{[]byte("Bot"), args[0]}, sp)
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+}
+
+func queryView(t *testing.T, stub *shim.MockStub, sp *pb.SignedProposal) tfc.GameView {
+	resp := stub.MockInvokeWithSignedProposal("view", [][]byte{[]byte(tfc.VIEW_FCN)}, sp)
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+
+	view := tfc.GameView{}
+	err := json.Unmarshal(resp.Payload, &view)
+	require.NoError(t, err)
+	return view
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/stefanprisca/strategy-code/mcts"
+	"github.com/stefanprisca/strategy-code/tfc"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// SearchState adapts a started TFC game to the tree search.
+// The search sees every hand, so it is meant for offline play,
+// or for a bot which was given the full game data.
+type SearchState struct {
+	GameData tfcPb.GameData
+}
+
+// Player returns the player whose turn it is.
+func (s SearchState) Player() int {
+	player, _ := engine.TurnOf(s.GameData.State)
+	return int(player)
+}
+
+func (s SearchState) LegalMoves() []mcts.Move {
+	player, _ := engine.TurnOf(s.GameData.State)
+	moves := []mcts.Move{}
+	for _, move := range engine.LegalMoves(s.GameData, player) {
+		moves = append(moves, move)
+	}
+	return moves
+}
+
+func (s SearchState) Apply(move mcts.Move) (mcts.State, error) {
+	player, _ := engine.TurnOf(s.GameData.State)
+	next, _, err := engine.Apply(s.GameData, player, move.(tfcPb.GameContractTrxArgs))
+	if err != nil {
+		return nil, err
+	}
+	return SearchState{next}, nil
+}
+
+func (s SearchState) Terminal() bool {
+	_, won := engine.Winner(s.GameData.State)
+	return won
+}
+
+// Reward is 1 for the winner. Before the game is over, the players
+// share the reward by their winning points.
+func (s SearchState) Reward(player int) float64 {
+	if winner, won := engine.Winner(s.GameData.State); won {
+		if int(winner) == player {
+			return 1
+		}
+		return 0
+	}
+
+	total := 0.0
+	for _, profile := range s.GameData.Profiles {
+		total += float64(profile.WinningPoints) + 1
+	}
+	profile, ok := s.GameData.Profiles[engine.GetPlayerId(tfcPb.Player(player))]
+	if !ok || total == 0 {
+		return 0
+	}
+	return (float64(profile.WinningPoints) + 1) / total
+}
+
+// SearchMove runs the tree search from the game data, and returns
+// the best move of the player whose turn it is.
+func SearchMove(gameData tfcPb.GameData, cfg mcts.Config) (*tfc.ArgsBuilder, error) {
+	if _, ok := engine.TurnOf(gameData.State); !ok {
+		return nil, fmt.Errorf("no player can move in state %v", gameData.State)
+	}
+
+	result, err := mcts.Search(SearchState{gameData}, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return argsFor(result.Move.(tfcPb.GameContractTrxArgs))
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stefanprisca/strategy-code/mcts"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func searchConfig(iterations int) mcts.Config {
+	return mcts.Config{
+		Iterations:   iterations,
+		RolloutDepth: 10,
+		Rnd:          rand.New(rand.NewSource(1)),
+	}
+}
+
+func TestSearchTakesTheWin(t *testing.T) {
+	state := startedGame(t)
+	red := New(tfcPb.Player_RED, DefaultWeights)
+	state, _ = playMove(t, state, red)
+	state, _ = playMove(t, state, red)
+	require.Equal(t, tfcPb.GameState_RDEV, state.State)
+
+	// One settlement away from winning
+	state.Profiles[engine.GetPlayerId(tfcPb.Player_RED)].WinningPoints = engine.WINNING_POINTS - 2
+
+	ab, err := SearchMove(state, searchConfig(200))
+	require.NoError(t, err)
+	move := *ab.Args()
+	require.Equal(t, tfcPb.GameTrxType_DEV, move.Type)
+	require.Equal(t, tfcPb.BuildType_SETTLE, move.BuildTrxPayload.Type)
+}
+
+func TestSearchPlaysLegalMoves(t *testing.T) {
+	state := startedGame(t)
+	for i := 0; i < 10; i++ {
+		player, ok := engine.TurnOf(state.State)
+		require.True(t, ok)
+
+		ab, err := SearchMove(state, searchConfig(20))
+		require.NoError(t, err)
+		state, _, err = engine.Apply(state, player, *ab.Args())
+		require.NoError(t, err)
+	}
+}
+
+func TestSearchNeedsAStartedGame(t *testing.T) {
+	gameData, err := engine.NewGameData(1010101)
+	require.NoError(t, err)
+	_, err = SearchMove(*gameData, searchConfig(20))
+	require.Error(t, err)
+}
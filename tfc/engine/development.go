@@ -1,20 +1,18 @@
-package tfc
+package engine
 
 import (
 	"fmt"
 	"regexp"
 
-	"github.com/hyperledger/fabric/core/chaincode/shim"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 )
 
-func handleDev(APIstub shim.ChaincodeStubInterface, creatorSign []byte,
-	gameData tfcPb.GameData, payload tfcPb.BuildTrxPayload) (tfcPb.GameData, error) {
+func handleDev(gameData tfcPb.GameData, creator tfcPb.Player,
+	payload tfcPb.BuildTrxPayload) (tfcPb.GameData, error) {
 
-	err := assertDevelopmentPrecond(APIstub, gameData, creatorSign, payload)
+	err := assertDevelopmentPrecond(gameData, creator, payload)
 	if err != nil {
-		return gameData, fmt.Errorf(
-			"development preconditions not met: %s", err)
+		return gameData, withContext("development preconditions not met", err)
 	}
 
 	switch payload.Type {
@@ -33,8 +31,7 @@ var devStateValidationRegexp = regexp.MustCompile(
 		fmt.Sprintf("|%vGDEV", tfcPb.Player_GREEN))
 
 // TODO: implement this
-func assertDevelopmentPrecond(APIstub shim.ChaincodeStubInterface,
-	gameData tfcPb.GameData, creatorSign []byte, payload tfcPb.BuildTrxPayload) error {
+func assertDevelopmentPrecond(gameData tfcPb.GameData, creator tfcPb.Player, payload tfcPb.BuildTrxPayload) error {
 
 	/*
 		1) correct state
@@ -43,17 +40,28 @@ func assertDevelopmentPrecond(APIstub shim.ChaincodeStubInterface,
 	*/
 
 	state := gameData.State
-	creator, err := getCreator(APIstub, creatorSign)
-	if err != nil {
-		return err
+	if creator == Spectator {
+		return ruleErrorf(RULE_CREATOR, "unkown trx creator, only players can build")
 	}
 
 	stateValidationStr := stateValidationString(creator, state)
 	if !devStateValidationRegexp.MatchString(stateValidationStr) {
-		return fmt.Errorf("expected state to match one of %v, got %v",
+		return ruleErrorf(RULE_TURN_ORDER, "expected state to match one of %v, got %v",
 			devStateValidationRegexp, stateValidationStr)
 	}
 
+	switch {
+	case payload.Type == tfcPb.BuildType_ROAD && payload.BuildRoadPayload == nil:
+		return fmt.Errorf("missing road payload")
+	case payload.Type == tfcPb.BuildType_SETTLE && payload.BuildSettlePayload == nil:
+		return fmt.Errorf("missing settlement payload")
+	}
+
+	err := assertCanAfford(gameData, creator, payload.Type)
+	if err != nil {
+		return err
+	}
+
 	switch payload.Type {
 	case tfcPb.BuildType_ROAD:
 		return assertBuildRoadPrecond(gameData, creator, *payload.BuildRoadPayload)
@@ -64,6 +72,38 @@ func assertDevelopmentPrecond(APIstub shim.ChaincodeStubInterface,
 	return fmt.Errorf("Unkown build type %v", payload.Type)
 }
 
+func assertCanAfford(gameData tfcPb.GameData, player tfcPb.Player, buildType tfcPb.BuildType) error {
+	profile, ok := gameData.Profiles[GetPlayerId(player)]
+	if !ok {
+		return fmt.Errorf("player %v has not joined the game", player)
+	}
+
+	for rID, amount := range BuildCost(buildType) {
+		if profile.Resources[rID] < amount {
+			return ruleErrorf(RULE_BUILD_COST, "player %v can not afford %v: needs %v %v, has %v",
+				player, buildType, amount, tfcPb.Resource(rID), profile.Resources[rID])
+		}
+	}
+	return nil
+}
+
+// roadAt returns the road on the edge, or no road for missing edges.
+func roadAt(gb tfcPb.GameBoard, eID uint32) tfcPb.Road {
+	if E, ok := gb.Edges[eID]; ok {
+		return E.Attributes.Road
+	}
+	return tfcPb.Road_NOROAD
+}
+
+// settlementAt returns the settlement on the intersection,
+// or no settlement for missing intersections.
+func settlementAt(gb tfcPb.GameBoard, iID uint32) tfcPb.Settlement {
+	if I, ok := gb.Intersections[iID]; ok {
+		return I.Attributes.Settlement
+	}
+	return tfcPb.Settlement_NOSETTLE
+}
+
 var canBuildRoad = regexp.MustCompile(
 	fmt.Sprintf("(%s)|(%s)|(%s)",
 		fmt.Sprintf("%v%v.*(%v|%v)+.*",
@@ -82,32 +122,36 @@ func buildRoadValidString(p tfcPb.Player, r tfcPb.Road, s1, s2 tfcPb.Settlement,
 
 func assertBuildRoadPrecond(gameData tfcPb.GameData, creator tfcPb.Player, payload tfcPb.BuildRoadPayload) error {
 	if creator != payload.Player {
-		return fmt.Errorf("expected creator to match trx player. expected %v, got %v", creator, payload.Player)
+		return ruleErrorf(RULE_CREATOR, "expected creator to match trx player. expected %v, got %v",
+			creator, payload.Player)
 	}
 
 	eID := uint32(payload.EdgeID)
 	E, exists := gameData.Board.Edges[eID]
 	if !exists {
-		return fmt.Errorf("gameboard edge %v does not exist", eID)
+		return ruleErrorf(RULE_BOARD, "gameboard edge %v does not exist", eID)
 	}
 
 	r := E.Attributes.Road
 	nE := gameData.Board.Edges[E.Next]
 
-	s1 := gameData.Board.Intersections[E.Origin].Attributes.Settlement
-	s2 := gameData.Board.Intersections[nE.Origin].Attributes.Settlement
+	s1 := settlementAt(*gameData.Board, E.Origin)
+	s2 := settlementAt(*gameData.Board, nE.Origin)
 
 	r1 := nE.Attributes.Road
-	r2 := gameData.Board.Edges[E.Prev].Attributes.Road
+	r2 := roadAt(*gameData.Board, E.Prev)
 
-	twin := gameData.Board.Edges[E.Twin]
-	r3 := gameData.Board.Edges[twin.Prev].Attributes.Road
-	r4 := gameData.Board.Edges[twin.Next].Attributes.Road
+	// Edges on the border of the board have no twin
+	r3, r4 := tfcPb.Road_NOROAD, tfcPb.Road_NOROAD
+	if twin, ok := gameData.Board.Edges[E.Twin]; ok {
+		r3 = roadAt(*gameData.Board, twin.Prev)
+		r4 = roadAt(*gameData.Board, twin.Next)
+	}
 
 	validationS := buildRoadValidString(creator, r, s1, s2, r1, r2, r3, r4)
 
 	if !canBuildRoad.MatchString(validationS) {
-		return fmt.Errorf("could not build road for player %v, conditions not fulfilled: %s", creator,
+		return ruleErrorf(RULE_ROAD_PLACEMENT, "could not build road for player %v, conditions not fulfilled: %s", creator,
 			fmt.Sprintf("existing road %v; surrounding settlements [%v, %v]; surrounding edges [%v, %v, %v, %v]",
 				r, s1, s2, r1, r2, r3, r4))
 	}
@@ -126,29 +170,32 @@ func buildSettleValidString(s, s1, s2, s3 tfcPb.Settlement) string {
 
 func assertBuildSettlePrecond(gameData tfcPb.GameData, creator tfcPb.Player, payload tfcPb.BuildSettlePayload) error {
 	if creator != payload.Player {
-		return fmt.Errorf("expected creator to match trx player. expected %v, got %v", creator, payload.Player)
+		return ruleErrorf(RULE_CREATOR, "expected creator to match trx player. expected %v, got %v",
+			creator, payload.Player)
 	}
 
 	sID := uint32(payload.SettleID)
-	I := gameData.Board.Intersections[sID]
+	I, exists := gameData.Board.Intersections[sID]
+	if !exists {
+		return ruleErrorf(RULE_BOARD, "gameboard intersection %v does not exist", sID)
+	}
 	s := I.Attributes.Settlement
 
 	iE := gameData.Board.Edges[I.IncidentEdge]
-	iID1 := gameData.Board.Edges[iE.Next].Origin
-	s1 := gameData.Board.Intersections[iID1].Attributes.Settlement
-
-	iID2 := gameData.Board.Edges[iE.Prev].Origin
-	s2 := gameData.Board.Intersections[iID2].Attributes.Settlement
-
-	iETwin := gameData.Board.Edges[iE.Twin]
-	iETwinNext := gameData.Board.Edges[iETwin.Next]
-	iID3 := gameData.Board.Edges[iETwinNext.Next].Origin
-	s3 := gameData.Board.Intersections[iID3].Attributes.Settlement
+	s1 := settlementAt(*gameData.Board, gameData.Board.Edges[iE.Next].Origin)
+	s2 := settlementAt(*gameData.Board, gameData.Board.Edges[iE.Prev].Origin)
+
+	// Intersections on the border of the board have no third neighbour
+	s3 := tfcPb.Settlement_NOSETTLE
+	if iETwin, ok := gameData.Board.Edges[iE.Twin]; ok {
+		iETwinNext := gameData.Board.Edges[iETwin.Next]
+		s3 = settlementAt(*gameData.Board, gameData.Board.Edges[iETwinNext.Next].Origin)
+	}
 
 	validationS := buildSettleValidString(s, s1, s2, s3)
 
 	if !canBuildSettle.MatchString(validationS) {
-		return fmt.Errorf("could not build settlement for player %v, conditions not fulfilled: %s", creator,
+		return ruleErrorf(RULE_SETTLEMENT_DISTANCE, "could not build settlement for player %v, conditions not fulfilled: %s", creator,
 			fmt.Sprintf("existing settle %v; surrounding settlements [%v, %v, %v]: %s", s, s1, s2, s3,
 				fmt.Sprintf("expected to match %v, got %v", canBuildSettle, validationS)))
 	}
@@ -162,13 +209,13 @@ func buildRoad(
 	playerID := GetPlayerId(payload.Player)
 	profile := gameData.Profiles[playerID]
 
-	profile.Resources[GetResourceId(tfcPb.Resource_HILL)]--
-	profile.Resources[GetResourceId(tfcPb.Resource_FOREST)]--
+	payCost(profile, tfcPb.BuildType_ROAD)
 	profile.Roads--
 	profile.WinningPoints++
 
 	eID := uint32(payload.EdgeID)
-	edge := gameData.Board.Edges[eID]
+	edge := copyEdge(gameData.Board.Edges[eID])
+	gameData.Board.Edges[eID] = edge
 
 	switch payload.Player {
 	case tfcPb.Player_RED:
@@ -181,7 +228,9 @@ func buildRoad(
 
 	twin, hasTwin := gameData.Board.Edges[edge.Twin]
 	if hasTwin {
+		twin = copyEdge(twin)
 		twin.Attributes = edge.Attributes
+		gameData.Board.Edges[edge.Twin] = twin
 	}
 
 	return gameData, nil
@@ -193,15 +242,14 @@ func buildSettlement(
 	playerID := GetPlayerId(payload.Player)
 	profile := gameData.Profiles[playerID]
 
-	for rID := range profile.Resources {
-		profile.Resources[rID]--
-	}
-
+	payCost(profile, tfcPb.BuildType_SETTLE)
 	profile.Settlements--
 	profile.WinningPoints += 2
 
 	posID := uint32(payload.SettleID)
-	settleIntersection := gameData.Board.Intersections[posID]
+	settleIntersection := copyIntersection(gameData.Board.Intersections[posID])
+	gameData.Board.Intersections[posID] = settleIntersection
+
 	switch payload.Player {
 	case tfcPb.Player_RED:
 		settleIntersection.Attributes.Settlement = tfcPb.Settlement_REDSETTLE
@@ -213,3 +261,9 @@ func buildSettlement(
 
 	return gameData, nil
 }
+
+func payCost(profile *tfcPb.PlayerProfile, buildType tfcPb.BuildType) {
+	for rID, amount := range BuildCost(buildType) {
+		profile.Resources[rID] -= amount
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2019 Stefan Prisca
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// 	http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package engine holds the rules of the TFC game. It has no ledger
+// dependency, so the chaincode, simulators, bots and clients all share
+// the same rules.
+package engine
+
+import (
+	"fmt"
+
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// Spectator is the player assigned to callers which did not join the game.
+// The rules reject it wherever a player is required.
+const Spectator = tfcPb.Player(-1)
+
+// WINNING_POINTS is the score a player needs to win the game.
+const WINNING_POINTS = 11
+
+// EventType names what changed in the game.
+type EventType string
+
+const (
+	PLAYER_JOINED    EventType = "PLAYER_JOINED"
+	RESOURCES_MOVED  EventType = "RESOURCES_MOVED"
+	ROAD_BUILT       EventType = "ROAD_BUILT"
+	SETTLEMENT_BUILT EventType = "SETTLEMENT_BUILT"
+	STATE_CHANGED    EventType = "STATE_CHANGED"
+	GAME_WON         EventType = "GAME_WON"
+	POINTS_CHANGED   EventType = "POINTS_CHANGED"
+)
+
+// Event describes one change made by an action. Resources holds the
+// change in the player's hand, by resource ID. ID is the edge or
+// intersection of a build. Points is the change in winning points.
+type Event struct {
+	Type      EventType       `json:"type"`
+	Player    tfcPb.Player    `json:"player"`
+	State     tfcPb.GameState `json:"state,omitempty"`
+	Resources map[int32]int32 `json:"resources,omitempty"`
+	ID        uint32          `json:"id,omitempty"`
+	Points    int32           `json:"points,omitempty"`
+}
+
+// NewGameData creates a new game, with the board generated from the seed.
+func NewGameData(seed int64) (*tfcPb.GameData, error) {
+	gameBoard, err := NewSeededGameBoard(seed)
+	if err != nil {
+		return nil, fmt.Errorf("could not create game board: %s", err)
+	}
+
+	return &tfcPb.GameData{
+		Board: gameBoard,
+		State: tfcPb.GameState_JOINING,
+	}, nil
+}
+
+// Apply applies an action made by the player, and moves the game to its
+// next state. The given state is not modified.
+func Apply(state tfcPb.GameData, player tfcPb.Player,
+	action tfcPb.GameContractTrxArgs) (tfcPb.GameData, []Event, error) {
+
+	gameData := copyGameData(state)
+
+	var err error
+	switch action.Type {
+	case tfcPb.GameTrxType_JOIN:
+		if action.JoinTrxPayload == nil {
+			return state, nil, fmt.Errorf("missing join payload")
+		}
+		gameData, err = handleJoin(gameData, *action.JoinTrxPayload)
+	case tfcPb.GameTrxType_ROLL:
+		// TODO: rolls do not hand out resources yet
+	case tfcPb.GameTrxType_NEXT:
+	case tfcPb.GameTrxType_TRADE:
+		if action.TradeTrxPayload == nil {
+			return state, nil, fmt.Errorf("missing trade payload")
+		}
+		gameData, err = handleTrade(gameData, player, *action.TradeTrxPayload)
+	case tfcPb.GameTrxType_DEV:
+		if action.BuildTrxPayload == nil {
+			return state, nil, fmt.Errorf("missing build payload")
+		}
+		gameData, err = handleDev(gameData, player, *action.BuildTrxPayload)
+	default:
+		return state, nil, fmt.Errorf("Unkown transaction type <%v>", action.Type)
+	}
+	if err != nil {
+		return state, nil, err
+	}
+
+	newGameState, err := computeNextState(gameData, action.Type)
+	if err != nil {
+		return state, nil, err
+	}
+	gameData.State = newGameState
+
+	return gameData, actionEvents(state, gameData, action), nil
+}
+
+func actionEvents(prev, next tfcPb.GameData, action tfcPb.GameContractTrxArgs) []Event {
+	events := []Event{}
+
+	switch action.Type {
+	case tfcPb.GameTrxType_JOIN:
+		events = append(events, Event{Type: PLAYER_JOINED, Player: action.JoinTrxPayload.Player})
+	case tfcPb.GameTrxType_TRADE:
+		payload := action.TradeTrxPayload
+		rID := GetResourceId(payload.Resource)
+		events = append(events,
+			Event{Type: RESOURCES_MOVED, Player: payload.Source,
+				Resources: map[int32]int32{rID: -payload.Amount}},
+			Event{Type: RESOURCES_MOVED, Player: payload.Dest,
+				Resources: map[int32]int32{rID: payload.Amount}})
+	case tfcPb.GameTrxType_DEV:
+		payload := action.BuildTrxPayload
+		var build Event
+		switch payload.Type {
+		case tfcPb.BuildType_ROAD:
+			build = Event{Type: ROAD_BUILT, Player: payload.BuildRoadPayload.Player,
+				ID: payload.BuildRoadPayload.EdgeID}
+		case tfcPb.BuildType_SETTLE:
+			build = Event{Type: SETTLEMENT_BUILT, Player: payload.BuildSettlePayload.Player,
+				ID: payload.BuildSettlePayload.SettleID}
+		}
+
+		cost := make(map[int32]int32)
+		for rID, amount := range BuildCost(payload.Type) {
+			cost[rID] = -amount
+		}
+		events = append(events,
+			Event{Type: RESOURCES_MOVED, Player: build.Player, Resources: cost},
+			build)
+	}
+
+	if prev.State != next.State {
+		events = append(events, Event{Type: STATE_CHANGED, State: next.State})
+		if winner, ok := Winner(next.State); ok {
+			events = append(events, Event{Type: GAME_WON, Player: winner, State: next.State})
+		}
+	}
+	return events
+}
+
+// Winner returns the player who won, if the game is over.
+func Winner(state tfcPb.GameState) (tfcPb.Player, bool) {
+	switch state {
+	case tfcPb.GameState_RWON:
+		return tfcPb.Player_RED, true
+	case tfcPb.GameState_GWON:
+		return tfcPb.Player_GREEN, true
+	case tfcPb.GameState_BWON:
+		return tfcPb.Player_BLUE, true
+	}
+	return Spectator, false
+}
+
+// RoundEnded tells whether moving between the states ends a round, which
+// is when the turn passes from the last player back to the first one.
+func RoundEnded(prev, next tfcPb.GameState) bool {
+	return prev == tfcPb.GameState_BDEV && next == tfcPb.GameState_RROLL
+}
+
+// copyGameData copies everything an action may change, so that the
+// caller's game data stays untouched. Edges and intersections are copied
+// by the builds themselves, only when they change.
+func copyGameData(gameData tfcPb.GameData) tfcPb.GameData {
+	if gameData.Profiles != nil {
+		profiles := make(map[int32]*tfcPb.PlayerProfile, len(gameData.Profiles))
+		for pID, profile := range gameData.Profiles {
+			profileCopy := *profile
+			if profile.Resources != nil {
+				profileCopy.Resources = make(map[int32]int32, len(profile.Resources))
+				for rID, amount := range profile.Resources {
+					profileCopy.Resources[rID] = amount
+				}
+			}
+			profiles[pID] = &profileCopy
+		}
+		gameData.Profiles = profiles
+	}
+
+	if gameData.Board != nil {
+		board := *gameData.Board
+		board.Edges = make(map[uint32]*tfcPb.Edge, len(gameData.Board.Edges))
+		for eID, edge := range gameData.Board.Edges {
+			board.Edges[eID] = edge
+		}
+		board.Intersections = make(map[uint32]*tfcPb.Intersection, len(gameData.Board.Intersections))
+		for iID, intersection := range gameData.Board.Intersections {
+			board.Intersections[iID] = intersection
+		}
+		gameData.Board = &board
+	}
+	return gameData
+}
+
+func copyEdge(edge *tfcPb.Edge) *tfcPb.Edge {
+	edgeCopy := *edge
+	attributes := *edge.Attributes
+	edgeCopy.Attributes = &attributes
+	return &edgeCopy
+}
+
+func copyIntersection(intersection *tfcPb.Intersection) *tfcPb.Intersection {
+	intersectionCopy := *intersection
+	attributes := *intersection.Attributes
+	intersectionCopy.Attributes = &attributes
+	return &intersectionCopy
+}
+
+func assertJoinPrecond(gameData tfcPb.GameData, payload tfcPb.JoinTrxPayload) error {
+	if gameData.State != tfcPb.GameState_JOINING {
+		return ruleErrorf(RULE_JOIN, "unexpected game state. expected %v, got %v",
+			tfcPb.GameState_JOINING, gameData.State)
+	}
+
+	playerID := GetPlayerId(payload.Player)
+	if _, ok := gameData.Profiles[playerID]; ok {
+		return ruleErrorf(RULE_JOIN, "player <%v> already taken", payload.Player)
+	}
+	return nil
+}
+
+func handleJoin(gameData tfcPb.GameData, payload tfcPb.JoinTrxPayload) (tfcPb.GameData, error) {
+
+	err := assertJoinPrecond(gameData, payload)
+	if err != nil {
+		return gameData, withContext("join preconditions not met", err)
+	}
+
+	playerID := GetPlayerId(payload.Player)
+
+	// If there was no other player that joined until now
+	// the profiles will be nil
+	if gameData.Profiles == nil {
+		gameData.Profiles = make(map[int32]*tfcPb.PlayerProfile)
+	}
+	gameData.Profiles[playerID] = InitPlayerProfile()
+
+	return gameData, nil
+}
+
+func computeNextState(gameData tfcPb.GameData, txType tfcPb.GameTrxType) (tfcPb.GameState, error) {
+	st := gameData.State
+	switch {
+	// A player just joined, move to RROLL if all are in
+	case txType == tfcPb.GameTrxType_JOIN:
+		if len(gameData.Profiles) == 3 {
+			return tfcPb.GameState_RROLL, nil
+		}
+		return tfcPb.GameState_JOINING, nil
+
+	case txType == tfcPb.GameTrxType_ROLL:
+		switch st {
+		case tfcPb.GameState_RROLL:
+			return tfcPb.GameState_RTRADE, nil
+		case tfcPb.GameState_GROLL:
+			return tfcPb.GameState_GTRADE, nil
+		case tfcPb.GameState_BROLL:
+			return tfcPb.GameState_BTRADE, nil
+		}
+
+	case txType == tfcPb.GameTrxType_NEXT:
+		switch st {
+		case tfcPb.GameState_RTRADE:
+			return tfcPb.GameState_RDEV, nil
+		case tfcPb.GameState_RDEV:
+			if won(tfcPb.Player_RED, gameData) {
+				return tfcPb.GameState_RWON, nil
+			}
+			return tfcPb.GameState_GROLL, nil
+		case tfcPb.GameState_GTRADE:
+			return tfcPb.GameState_GDEV, nil
+		case tfcPb.GameState_GDEV:
+			if won(tfcPb.Player_GREEN, gameData) {
+				return tfcPb.GameState_GWON, nil
+			}
+			return tfcPb.GameState_BROLL, nil
+		case tfcPb.GameState_BTRADE:
+			return tfcPb.GameState_BDEV, nil
+		case tfcPb.GameState_BDEV:
+			if won(tfcPb.Player_BLUE, gameData) {
+				return tfcPb.GameState_BWON, nil
+			}
+			return tfcPb.GameState_RROLL, nil
+		}
+	case txType == tfcPb.GameTrxType_TRADE:
+		return st, nil
+	case txType == tfcPb.GameTrxType_DEV:
+		return st, nil
+	case txType == tfcPb.GameTrxType_BATTLE:
+		return st, nil
+	}
+	return st, ruleErrorf(RULE_TURN_ORDER,
+		"could not compute next state from st %v and trx type %v", st, txType)
+}
+
+func won(player tfcPb.Player, gameData tfcPb.GameData) bool {
+	id := GetPlayerId(player)
+	profile := gameData.Profiles[id]
+	return profile.WinningPoints >= WINNING_POINTS
+}
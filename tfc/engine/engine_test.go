@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"testing"
+
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func joinAction(p tfcPb.Player) tfcPb.GameContractTrxArgs {
+	return tfcPb.GameContractTrxArgs{
+		Type:           tfcPb.GameTrxType_JOIN,
+		JoinTrxPayload: &tfcPb.JoinTrxPayload{Player: p},
+	}
+}
+
+func newStartedGame(t *testing.T) tfcPb.GameData {
+	gameData, err := NewGameData(1010101)
+	require.NoError(t, err)
+
+	state := *gameData
+	for _, p := range []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE} {
+		state, _, err = Apply(state, p, joinAction(p))
+		require.NoError(t, err)
+	}
+	require.Equal(t, tfcPb.GameState_RROLL, state.State)
+	return state
+}
+
+func TestApplyGameFlow(t *testing.T) {
+	state := newStartedGame(t)
+	red := tfcPb.Player_RED
+
+	state, events, err := Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_ROLL})
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.GameState_RTRADE, state.State)
+	require.Equal(t, []Event{{Type: STATE_CHANGED, State: tfcPb.GameState_RTRADE}}, events)
+
+	trade := tfcPb.GameContractTrxArgs{
+		Type: tfcPb.GameTrxType_TRADE,
+		TradeTrxPayload: &tfcPb.TradeTrxPayload{
+			Source: red, Dest: tfcPb.Player_BLUE,
+			Resource: tfcPb.Resource_HILL, Amount: 2,
+		},
+	}
+	state, events, err = Apply(state, red, trade)
+	require.NoError(t, err)
+	hillID := GetResourceId(tfcPb.Resource_HILL)
+	require.EqualValues(t, 3, state.Profiles[GetPlayerId(red)].Resources[hillID])
+	require.EqualValues(t, 7, state.Profiles[GetPlayerId(tfcPb.Player_BLUE)].Resources[hillID])
+	require.Len(t, events, 2)
+	require.Equal(t, RESOURCES_MOVED, events[0].Type)
+	require.EqualValues(t, -2, events[0].Resources[hillID])
+
+	state, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT})
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.GameState_RDEV, state.State)
+
+	sID := PointHash(tfcPb.Coord{X: 0, Y: 0})
+	settle := tfcPb.GameContractTrxArgs{
+		Type: tfcPb.GameTrxType_DEV,
+		BuildTrxPayload: &tfcPb.BuildTrxPayload{
+			Type:               tfcPb.BuildType_SETTLE,
+			BuildSettlePayload: &tfcPb.BuildSettlePayload{Player: red, SettleID: sID},
+		},
+	}
+	state, events, err = Apply(state, red, settle)
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.Settlement_REDSETTLE, state.Board.Intersections[sID].Attributes.Settlement)
+	require.EqualValues(t, 2, state.Profiles[GetPlayerId(red)].WinningPoints)
+	require.Equal(t, SETTLEMENT_BUILT, events[len(events)-1].Type)
+	require.Equal(t, sID, events[len(events)-1].ID)
+
+	state, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT})
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.GameState_GROLL, state.State)
+}
+
+func TestRoundEnded(t *testing.T) {
+	state := newStartedGame(t)
+	next := tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT}
+	roll := tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_ROLL}
+
+	// Only passing on from blue to red ends the round
+	ended := []tfcPb.GameState{}
+	for _, p := range []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE} {
+		for _, action := range []tfcPb.GameContractTrxArgs{roll, next, next} {
+			prev := state.State
+			var err error
+			state, _, err = Apply(state, p, action)
+			require.NoError(t, err)
+			if RoundEnded(prev, state.State) {
+				ended = append(ended, prev)
+			}
+		}
+	}
+	require.Equal(t, []tfcPb.GameState{tfcPb.GameState_BDEV}, ended)
+	require.Equal(t, tfcPb.GameState_RROLL, state.State)
+
+	require.False(t, RoundEnded(tfcPb.GameState_JOINING, tfcPb.GameState_RROLL))
+	require.False(t, RoundEnded(tfcPb.GameState_BDEV, tfcPb.GameState_BWON))
+}
+
+func TestApplyRejectsSpectator(t *testing.T) {
+	state := newStartedGame(t)
+	state, _, err := Apply(state, tfcPb.Player_RED, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_ROLL})
+	require.NoError(t, err)
+
+	trade := tfcPb.GameContractTrxArgs{
+		Type: tfcPb.GameTrxType_TRADE,
+		TradeTrxPayload: &tfcPb.TradeTrxPayload{
+			Source: tfcPb.Player_RED, Dest: tfcPb.Player_BLUE,
+			Resource: tfcPb.Resource_HILL, Amount: 1,
+		},
+	}
+	_, _, err = Apply(state, Spectator, trade)
+	require.Error(t, err)
+}
+
+func TestApplyRejectsMalformedActions(t *testing.T) {
+	red, blue := tfcPb.Player_RED, tfcPb.Player_BLUE
+	state := newStartedGame(t)
+	state, _, err := Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_ROLL})
+	require.NoError(t, err)
+
+	trade := tfcPb.GameContractTrxArgs{
+		Type: tfcPb.GameTrxType_TRADE,
+		TradeTrxPayload: &tfcPb.TradeTrxPayload{
+			Source: red, Dest: blue, Resource: tfcPb.Resource_HILL, Amount: 1,
+		},
+	}
+
+	// Trading with a player who has not joined
+	missing := copyGameData(state)
+	delete(missing.Profiles, GetPlayerId(blue))
+	_, _, err = Apply(missing, red, trade)
+	require.Error(t, err)
+
+	// Trading with a player whose hand is hidden
+	hidden := copyGameData(state)
+	hidden.Profiles[GetPlayerId(blue)].Resources = nil
+	_, _, err = Apply(hidden, red, trade)
+	require.Error(t, err)
+
+	state, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT})
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.GameState_RDEV, state.State)
+
+	for _, buildType := range []tfcPb.BuildType{tfcPb.BuildType_ROAD, tfcPb.BuildType_SETTLE} {
+		_, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{
+			Type:            tfcPb.GameTrxType_DEV,
+			BuildTrxPayload: &tfcPb.BuildTrxPayload{Type: buildType},
+		})
+		require.Error(t, err, "build %v", buildType)
+	}
+}
+
+func TestApplyReportsBrokenRules(t *testing.T) {
+	red, blue := tfcPb.Player_RED, tfcPb.Player_BLUE
+	state := newStartedGame(t)
+	tradeAction := func(amount int32) tfcPb.GameContractTrxArgs {
+		return tfcPb.GameContractTrxArgs{
+			Type: tfcPb.GameTrxType_TRADE,
+			TradeTrxPayload: &tfcPb.TradeTrxPayload{
+				Source: red, Dest: blue, Resource: tfcPb.Resource_HILL, Amount: amount,
+			},
+		}
+	}
+	brokenRule := func(state tfcPb.GameData, p tfcPb.Player, action tfcPb.GameContractTrxArgs) Rule {
+		_, _, err := Apply(state, p, action)
+		require.Error(t, err)
+		rule, ok := BrokenRule(err)
+		require.True(t, ok, "expected a rule error, got %s", err)
+		return rule
+	}
+
+	require.Equal(t, RULE_JOIN, brokenRule(state, red, joinAction(red)))
+	require.Equal(t, RULE_TURN_ORDER, brokenRule(state, red, tradeAction(1)))
+
+	state, _, err := Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_ROLL})
+	require.NoError(t, err)
+	require.Equal(t, RULE_CREATOR, brokenRule(state, Spectator, tradeAction(1)))
+	require.Equal(t, RULE_TRADE_AMOUNT, brokenRule(state, red, tradeAction(100)))
+
+	// The context is added to the message, without losing the rule
+	_, _, err = Apply(state, Spectator, tradeAction(1))
+	require.Contains(t, err.Error(), "trade preconditions not met: invalid trx creator")
+
+	state, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT})
+	require.NoError(t, err)
+	require.Equal(t, RULE_BOARD, brokenRule(state, red, tfcPb.GameContractTrxArgs{
+		Type: tfcPb.GameTrxType_DEV,
+		BuildTrxPayload: &tfcPb.BuildTrxPayload{
+			Type:               tfcPb.BuildType_SETTLE,
+			BuildSettlePayload: &tfcPb.BuildSettlePayload{Player: red, SettleID: 1},
+		},
+	}))
+
+	// Malformed actions break no rule
+	_, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_DEV})
+	require.Error(t, err)
+	_, ok := BrokenRule(err)
+	require.False(t, ok)
+}
+
+func TestApplyDoesNotChangeItsInput(t *testing.T) {
+	state := newStartedGame(t)
+	red := tfcPb.Player_RED
+	for _, trxType := range []tfcPb.GameTrxType{tfcPb.GameTrxType_ROLL, tfcPb.GameTrxType_NEXT} {
+		var err error
+		state, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{Type: trxType})
+		require.NoError(t, err)
+	}
+
+	eID := EdgeHash(tfcPb.Coord{X: 0, Y: 0}, N)
+	sID := PointHash(tfcPb.Coord{X: 0, Y: 0})
+	settled, _, err := Apply(state, red, tfcPb.GameContractTrxArgs{
+		Type: tfcPb.GameTrxType_DEV,
+		BuildTrxPayload: &tfcPb.BuildTrxPayload{
+			Type:               tfcPb.BuildType_SETTLE,
+			BuildSettlePayload: &tfcPb.BuildSettlePayload{Player: red, SettleID: sID},
+		},
+	})
+	require.NoError(t, err)
+
+	built, _, err := Apply(settled, red, tfcPb.GameContractTrxArgs{
+		Type: tfcPb.GameTrxType_DEV,
+		BuildTrxPayload: &tfcPb.BuildTrxPayload{
+			Type:             tfcPb.BuildType_ROAD,
+			BuildRoadPayload: &tfcPb.BuildRoadPayload{Player: red, EdgeID: eID},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.Road_REDROAD, built.Board.Edges[eID].Attributes.Road)
+
+	require.Equal(t, tfcPb.Settlement_NOSETTLE, state.Board.Intersections[sID].Attributes.Settlement)
+	require.Equal(t, tfcPb.Road_NOROAD, state.Board.Edges[eID].Attributes.Road)
+	require.Equal(t, tfcPb.Road_NOROAD, settled.Board.Edges[eID].Attributes.Road)
+	for _, amount := range state.Profiles[GetPlayerId(red)].Resources {
+		require.EqualValues(t, 5, amount)
+	}
+	require.Zero(t, state.Profiles[GetPlayerId(red)].WinningPoints)
+}
+
+func TestSettle(t *testing.T) {
+	red, green := GetPlayerId(tfcPb.Player_RED), GetPlayerId(tfcPb.Player_GREEN)
+
+	gameData, err := NewGameData(1010101)
+	require.NoError(t, err)
+	_, _, err = Settle(*gameData, Settlement{Points: map[int32]int32{red: 1}})
+	require.Error(t, err)
+
+	state := newStartedGame(t)
+	state.Profiles[green].WinningPoints = 1
+
+	settled, events, err := Settle(state, Settlement{
+		AllianceID: 1,
+		Points:     map[int32]int32{red: 2, green: -3},
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, settled.Profiles[red].WinningPoints)
+	require.Zero(t, settled.Profiles[green].WinningPoints)
+	require.Equal(t, []Event{
+		{Type: POINTS_CHANGED, Player: tfcPb.Player_RED, Points: 2},
+		{Type: POINTS_CHANGED, Player: tfcPb.Player_GREEN, Points: -1},
+	}, events)
+
+	// The given state is untouched
+	require.Zero(t, state.Profiles[red].WinningPoints)
+	require.EqualValues(t, 1, state.Profiles[green].WinningPoints)
+
+	_, _, err = Settle(state, Settlement{Points: map[int32]int32{7: 1}})
+	require.Error(t, err)
+
+	// Alliances cannot bring more than the maximum stake
+	_, _, err = Settle(state, Settlement{Points: map[int32]int32{red: MAX_STAKE + 1}})
+	require.Error(t, err)
+	_, _, err = Settle(state, Settlement{Points: map[int32]int32{green: -MAX_STAKE - 1}})
+	require.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"fmt"
+)
+
+// Rule names a game rule which an action can break.
+type Rule string
+
+const (
+	RULE_TURN_ORDER          Rule = "turn order"
+	RULE_CREATOR             Rule = "creator"
+	RULE_TRADE_AMOUNT        Rule = "trade amount"
+	RULE_BUILD_COST          Rule = "build cost"
+	RULE_ROAD_PLACEMENT      Rule = "road placement"
+	RULE_SETTLEMENT_DISTANCE Rule = "settlement distance"
+	RULE_BOARD               Rule = "board"
+	RULE_JOIN                Rule = "join"
+)
+
+// RuleError is the error Apply returns for actions breaking a game rule.
+// Malformed actions, such as ones missing their payload, break no rule
+// and get plain errors.
+type RuleError struct {
+	Rule Rule
+	msg  string
+}
+
+func (e *RuleError) Error() string {
+	return e.msg
+}
+
+func ruleErrorf(rule Rule, format string, args ...interface{}) error {
+	return &RuleError{Rule: rule, msg: fmt.Sprintf(format, args...)}
+}
+
+// withContext prefixes the message of the error, keeping the rule it breaks.
+func withContext(context string, err error) error {
+	if ruleErr, ok := err.(*RuleError); ok {
+		return &RuleError{Rule: ruleErr.Rule, msg: fmt.Sprintf("%s: %s", context, ruleErr.msg)}
+	}
+	return fmt.Errorf("%s: %s", context, err)
+}
+
+// BrokenRule returns the rule an error of Apply reports, if any.
+func BrokenRule(err error) (Rule, bool) {
+	ruleErr, ok := err.(*RuleError)
+	if !ok {
+		return "", false
+	}
+	return ruleErr.Rule, true
+}
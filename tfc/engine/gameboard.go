@@ -1,9 +1,10 @@
-package tfc
+package engine
 
 import (
 	"fmt"
 	"hash/crc32"
 	"math/rand"
+	"sort"
 
 	"github.com/golang-collections/collections/stack"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
@@ -20,11 +21,14 @@ const (
 	SIZE = 2
 )
 
-func pointHash(c tfcPb.Coord) uint32 {
+// PointHash returns the ID of the intersection at the given coordinates.
+func PointHash(c tfcPb.Coord) uint32 {
 	return crc32.ChecksumIEEE([]byte(c.String()))
 }
 
-func edgeHash(c tfcPb.Coord, o string) uint32 {
+// EdgeHash returns the ID of the edge starting at the given coordinates,
+// with the given orientation.
+func EdgeHash(c tfcPb.Coord, o string) uint32 {
 	return crc32.ChecksumIEEE([]byte(c.String() + o))
 }
 
@@ -34,6 +38,12 @@ type tileAttributeStacks struct {
 }
 
 func NewGameBoard() (*tfcPb.GameBoard, error) {
+	return NewSeededGameBoard(rand.Int63())
+}
+
+// NewSeededGameBoard generates the game board from a seed.
+// The same seed always results in the same board.
+func NewSeededGameBoard(seed int64) (*tfcPb.GameBoard, error) {
 	c0 := tfcPb.Coord{X: 0, Y: 0}
 	o0 := N
 	gb := &tfcPb.GameBoard{
@@ -43,7 +53,7 @@ func NewGameBoard() (*tfcPb.GameBoard, error) {
 	}
 
 	resourceStack := newResourceStack()
-	rollStack := newRollStack()
+	rollStack := newRollStack(rand.New(rand.NewSource(seed)))
 	tileAttrStacks := tileAttributeStacks{resourceStack, rollStack}
 
 	err := generateTile(gb, c0, o0, tileAttrStacks)
@@ -73,10 +83,10 @@ func newResourceStack() *stack.Stack {
 	return resStack
 }
 
-func newRollStack() *stack.Stack {
+func newRollStack(rnd *rand.Rand) *stack.Stack {
 	rollStack := stack.New()
 	for i := 0; i < 5; i++ {
-		for _, rn := range rand.Perm(10) {
+		for _, rn := range rnd.Perm(10) {
 			rollStack.Push(int32(rn + 2))
 		}
 	}
@@ -91,6 +101,10 @@ func expandGameBoard(gb *tfcPb.GameBoard, tileAttrStacks tileAttributeStacks) er
 		}
 	}
 
+	// Expand in a fixed order, so that the tiles get the same attributes
+	// regardless of the map iteration order.
+	sort.Slice(edgeIDs, func(i, j int) bool { return edgeIDs[i] < edgeIDs[j] })
+
 	// log.Printf("####\n\n Expanding gb \n\n")
 
 	for _, eID := range edgeIDs {
@@ -163,8 +177,8 @@ func generateTile(gb *tfcPb.GameBoard, c tfcPb.Coord, o string, attrStacks tileA
 func newIEPair(gb *tfcPb.GameBoard, c tfcPb.Coord, o string) (
 	I *tfcPb.Intersection, E *tfcPb.Edge) {
 
-	iID := pointHash(c)
-	eID := edgeHash(c, o)
+	iID := PointHash(c)
+	eID := EdgeHash(c, o)
 	I, ok := gb.Intersections[iID]
 	if !ok {
 		I = &tfcPb.Intersection{
@@ -195,7 +209,7 @@ func updateTwins(gb *tfcPb.GameBoard, e0 *tfcPb.Edge) {
 	for {
 		twinC := *gb.Intersections[nextE.Origin].Coordinates
 		twinO := twinOrientation(currE.Orientation)
-		twinID := edgeHash(twinC, twinO)
+		twinID := EdgeHash(twinC, twinO)
 		if twin, ok := gb.Edges[twinID]; ok {
 			currE.Twin = twinID
 			twin.Twin = currE.Id
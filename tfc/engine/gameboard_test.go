@@ -1,4 +1,4 @@
-package tfc
+package engine
 
 import (
 	"testing"
@@ -16,6 +16,22 @@ func TestGenerateGameBoard(t *testing.T) {
 	// fmt.Println(boardPrettyString)
 }
 
+func TestSeededGameBoard(t *testing.T) {
+	seed := int64(1010101)
+	gb1, err := NewSeededGameBoard(seed)
+	require.NoError(t, err)
+	gb2, err := NewSeededGameBoard(seed)
+	require.NoError(t, err)
+
+	for tID, T := range gb1.Tiles {
+		require.Contains(t, gb2.Tiles, tID)
+		require.Equal(t, T.Attributes.Resource, gb2.Tiles[tID].Attributes.Resource,
+			"expected the same resource for tile %v", tID)
+		require.Equal(t, T.Attributes.RollNumber, gb2.Tiles[tID].Attributes.RollNumber,
+			"expected the same roll number for tile %v", tID)
+	}
+}
+
 func assertGameBoard(t *testing.T, gb tfcPb.GameBoard) {
 	require.NotZero(t, len(gb.Intersections),
 		"expected to have intersections initialized")
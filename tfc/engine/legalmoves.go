@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"sort"
+
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// Players lists the seats of the game, in turn order.
+var Players = []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE}
+
+// TurnOf returns the player whose turn it is in the given state.
+// It returns false while joining, and once the game is over.
+func TurnOf(state tfcPb.GameState) (tfcPb.Player, bool) {
+	switch state {
+	case tfcPb.GameState_RROLL, tfcPb.GameState_RTRADE, tfcPb.GameState_RDEV:
+		return tfcPb.Player_RED, true
+	case tfcPb.GameState_GROLL, tfcPb.GameState_GTRADE, tfcPb.GameState_GDEV:
+		return tfcPb.Player_GREEN, true
+	case tfcPb.GameState_BROLL, tfcPb.GameState_BTRADE, tfcPb.GameState_BDEV:
+		return tfcPb.Player_BLUE, true
+	}
+	return Spectator, false
+}
+
+// LegalMoves lists every action the player can make in the given state.
+// The hand of the player must be filled in, since it decides which trades
+// and builds are affordable. While joining, anyone who has not joined yet
+// can take any free seat.
+func LegalMoves(gameData tfcPb.GameData, player tfcPb.Player) []tfcPb.GameContractTrxArgs {
+	moves := []tfcPb.GameContractTrxArgs{}
+
+	if gameData.State == tfcPb.GameState_JOINING {
+		if _, joined := gameData.Profiles[GetPlayerId(player)]; joined {
+			return moves
+		}
+		for _, p := range Players {
+			if _, taken := gameData.Profiles[GetPlayerId(p)]; !taken {
+				moves = append(moves, joinMove(p))
+			}
+		}
+		return moves
+	}
+
+	turn, ok := TurnOf(gameData.State)
+	if !ok || turn != player {
+		return moves
+	}
+
+	switch gameData.State {
+	case tfcPb.GameState_RROLL, tfcPb.GameState_GROLL, tfcPb.GameState_BROLL:
+		moves = append(moves, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_ROLL})
+	case tfcPb.GameState_RTRADE, tfcPb.GameState_GTRADE, tfcPb.GameState_BTRADE:
+		moves = append(moves, legalTrades(gameData, player)...)
+		moves = append(moves, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT})
+	case tfcPb.GameState_RDEV, tfcPb.GameState_GDEV, tfcPb.GameState_BDEV:
+		moves = append(moves, legalBuilds(gameData, player)...)
+		moves = append(moves, tfcPb.GameContractTrxArgs{Type: tfcPb.GameTrxType_NEXT})
+	}
+	return moves
+}
+
+func joinMove(p tfcPb.Player) tfcPb.GameContractTrxArgs {
+	return tfcPb.GameContractTrxArgs{
+		Type:           tfcPb.GameTrxType_JOIN,
+		JoinTrxPayload: &tfcPb.JoinTrxPayload{Player: p},
+	}
+}
+
+// legalTrades lists every amount of every resource the player holds,
+// given to every other player.
+func legalTrades(gameData tfcPb.GameData, player tfcPb.Player) []tfcPb.GameContractTrxArgs {
+	moves := []tfcPb.GameContractTrxArgs{}
+	profile, ok := gameData.Profiles[GetPlayerId(player)]
+	if !ok {
+		return moves
+	}
+
+	for _, dest := range Players {
+		if _, joined := gameData.Profiles[GetPlayerId(dest)]; dest == player || !joined {
+			continue
+		}
+		for _, r := range Resources {
+			for amount := int32(1); amount <= profile.Resources[GetResourceId(r)]; amount++ {
+				moves = append(moves, tfcPb.GameContractTrxArgs{
+					Type: tfcPb.GameTrxType_TRADE,
+					TradeTrxPayload: &tfcPb.TradeTrxPayload{
+						Source:   player,
+						Dest:     dest,
+						Resource: r,
+						Amount:   amount,
+					},
+				})
+			}
+		}
+	}
+	return moves
+}
+
+// legalBuilds checks every edge and intersection of the board against
+// the development preconditions, so it always agrees with the rules.
+func legalBuilds(gameData tfcPb.GameData, player tfcPb.Player) []tfcPb.GameContractTrxArgs {
+	moves := []tfcPb.GameContractTrxArgs{}
+
+	if assertCanAfford(gameData, player, tfcPb.BuildType_ROAD) == nil {
+		for _, eID := range edgeIDs(*gameData.Board) {
+			payload := tfcPb.BuildTrxPayload{
+				Type:             tfcPb.BuildType_ROAD,
+				BuildRoadPayload: &tfcPb.BuildRoadPayload{Player: player, EdgeID: eID},
+			}
+			if assertDevelopmentPrecond(gameData, player, payload) == nil {
+				moves = append(moves, tfcPb.GameContractTrxArgs{
+					Type: tfcPb.GameTrxType_DEV, BuildTrxPayload: &payload})
+			}
+		}
+	}
+
+	if assertCanAfford(gameData, player, tfcPb.BuildType_SETTLE) == nil {
+		for _, iID := range intersectionIDs(*gameData.Board) {
+			payload := tfcPb.BuildTrxPayload{
+				Type:               tfcPb.BuildType_SETTLE,
+				BuildSettlePayload: &tfcPb.BuildSettlePayload{Player: player, SettleID: iID},
+			}
+			if assertDevelopmentPrecond(gameData, player, payload) == nil {
+				moves = append(moves, tfcPb.GameContractTrxArgs{
+					Type: tfcPb.GameTrxType_DEV, BuildTrxPayload: &payload})
+			}
+		}
+	}
+	return moves
+}
+
+// edgeIDs and intersectionIDs return the board IDs in order,
+// so that the moves are listed the same way on every call.
+func edgeIDs(gb tfcPb.GameBoard) []uint32 {
+	ids := []uint32{}
+	for id := range gb.Edges {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func intersectionIDs(gb tfcPb.GameBoard) []uint32 {
+	ids := []uint32{}
+	for id := range gb.Intersections {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
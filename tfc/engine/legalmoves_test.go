@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegalMovesWhileJoining(t *testing.T) {
+	gameData, err := NewGameData(1010101)
+	require.NoError(t, err)
+
+	moves := LegalMoves(*gameData, Spectator)
+	require.Len(t, moves, 3)
+
+	state, _, err := Apply(*gameData, tfcPb.Player_RED, joinAction(tfcPb.Player_RED))
+	require.NoError(t, err)
+	require.Empty(t, LegalMoves(state, tfcPb.Player_RED))
+	require.Len(t, LegalMoves(state, Spectator), 2)
+}
+
+func TestLegalMovesFollowTheTurn(t *testing.T) {
+	state := newStartedGame(t)
+
+	require.Equal(t, []tfcPb.GameContractTrxArgs{{Type: tfcPb.GameTrxType_ROLL}},
+		LegalMoves(state, tfcPb.Player_RED))
+	require.Empty(t, LegalMoves(state, tfcPb.Player_GREEN))
+	require.Empty(t, LegalMoves(state, Spectator))
+}
+
+func TestLegalBuildsAreAffordable(t *testing.T) {
+	state := newStartedGame(t)
+	red := tfcPb.Player_RED
+	for _, trxType := range []tfcPb.GameTrxType{tfcPb.GameTrxType_ROLL, tfcPb.GameTrxType_NEXT} {
+		var err error
+		state, _, err = Apply(state, red, tfcPb.GameContractTrxArgs{Type: trxType})
+		require.NoError(t, err)
+	}
+	require.Len(t, LegalMoves(state, red), 1+len(state.Board.Intersections),
+		"expected every spot to be free for a settlement, and no roads without settlements")
+
+	state.Profiles[GetPlayerId(red)].Resources[GetResourceId(tfcPb.Resource_CAMP)] = 0
+	require.Equal(t, []tfcPb.GameContractTrxArgs{{Type: tfcPb.GameTrxType_NEXT}},
+		LegalMoves(state, red))
+}
+
+// Every listed move must be accepted by the rules, all over the board.
+func TestLegalMovesAreAccepted(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	state := newStartedGame(t)
+
+	for i := 0; i < 300; i++ {
+		player, ok := TurnOf(state.State)
+		if !ok {
+			break
+		}
+
+		moves := LegalMoves(state, player)
+		require.NotEmpty(t, moves, "no legal moves in state %v", state.State)
+		for _, move := range moves {
+			_, _, err := Apply(state, player, move)
+			require.NoError(t, err, "listed move %v was rejected", move)
+		}
+
+		var err error
+		state, _, err = Apply(state, player, moves[rnd.Intn(len(moves))])
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+func GetPlayerId(player tfcPb.Player) int32 {
+	return int32(player)
+}
+
+func GetResourceId(r tfcPb.Resource) int32 {
+	return int32(r)
+}
+
+// Resources lists every resource a player can hold.
+var Resources = []tfcPb.Resource{tfcPb.Resource_CAMP, tfcPb.Resource_FIELD, tfcPb.Resource_FOREST,
+	tfcPb.Resource_MOUNTAIN, tfcPb.Resource_PASTURE, tfcPb.Resource_HILL}
+
+func InitPlayerProfile() *tfcPb.PlayerProfile {
+
+	startingResources := make(map[int32]int32)
+	for _, r := range Resources {
+		id := GetResourceId(r)
+		startingResources[id] = 5
+	}
+
+	return &tfcPb.PlayerProfile{
+		Resources:     startingResources,
+		WinningPoints: 0,
+		Settlements:   2,
+		Roads:         2,
+	}
+}
+
+// BuildCost returns the resources, by resource ID, consumed by a build.
+func BuildCost(buildType tfcPb.BuildType) map[int32]int32 {
+	cost := make(map[int32]int32)
+	switch buildType {
+	case tfcPb.BuildType_ROAD:
+		cost[GetResourceId(tfcPb.Resource_HILL)] = 1
+		cost[GetResourceId(tfcPb.Resource_FOREST)] = 1
+	case tfcPb.BuildType_SETTLE:
+		for _, r := range Resources {
+			cost[GetResourceId(r)] = 1
+		}
+	}
+	return cost
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"sort"
+
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// RollProbability returns the chance of rolling the number with two dice.
+func RollProbability(rollNumber int32) float64 {
+	if rollNumber < 2 || rollNumber > 12 {
+		return 0
+	}
+	distance := rollNumber - 7
+	if distance < 0 {
+		distance = -distance
+	}
+	return float64(6-distance) / 36
+}
+
+// IntersectionTiles maps every intersection to the tiles around it, in order.
+func IntersectionTiles(gb tfcPb.GameBoard) map[uint32][]uint32 {
+	tiles := make(map[uint32][]uint32)
+	for _, E := range gb.Edges {
+		tiles[E.Origin] = append(tiles[E.Origin], E.IncidentTile)
+	}
+	for _, tileIDs := range tiles {
+		sort.Slice(tileIDs, func(i, j int) bool { return tileIDs[i] < tileIDs[j] })
+	}
+	return tiles
+}
+
+// IntersectionProduction returns the expected production of a settlement
+// on every intersection: the summed roll probabilities of the tiles around it.
+func IntersectionProduction(gb tfcPb.GameBoard) map[uint32]float64 {
+	production := make(map[uint32]float64)
+	for iID, tileIDs := range IntersectionTiles(gb) {
+		for _, tID := range tileIDs {
+			if T, ok := gb.Tiles[tID]; ok {
+				production[iID] += RollProbability(T.Attributes.RollNumber)
+			}
+		}
+	}
+	return production
+}
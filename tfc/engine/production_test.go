@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollProbability(t *testing.T) {
+	total := 0.0
+	for r := int32(2); r <= 12; r++ {
+		total += RollProbability(r)
+	}
+	require.InDelta(t, 1, total, 1e-9)
+	require.InDelta(t, 6.0/36, RollProbability(7), 1e-9)
+	require.Zero(t, RollProbability(0))
+}
+
+func TestIntersectionProduction(t *testing.T) {
+	gb, err := NewSeededGameBoard(1010101)
+	require.NoError(t, err)
+
+	production := IntersectionProduction(*gb)
+	require.Len(t, production, len(gb.Intersections))
+	for iID, tiles := range IntersectionTiles(*gb) {
+		require.True(t, len(tiles) >= 1 && len(tiles) <= 3,
+			"expected 1 to 3 tiles around %v, got %v", iID, len(tiles))
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"fmt"
+
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// MAX_STAKE bounds the winning points an alliance brings, or costs, each
+// player. It is well below the winning score, so that alliances cannot
+// decide the game on their own.
+const MAX_STAKE = 3
+
+// Settlement is the outcome of an alliance for the game. Points holds the
+// winning points each player gains, or loses, keyed by player ID. GameID
+// is the game the alliance was formed in.
+type Settlement struct {
+	AllianceID uint32          `json:"allianceID"`
+	GameID     string          `json:"gameID"`
+	Points     map[int32]int32 `json:"points"`
+}
+
+// Settle applies the settlement of an alliance to the player profiles.
+// Winning points never drop below zero. A player reaching the winning
+// score wins at the end of their next development round, as with builds.
+// The given state is not modified.
+func Settle(state tfcPb.GameData, settlement Settlement) (tfcPb.GameData, []Event, error) {
+	if _, won := Winner(state.State); won || state.State == tfcPb.GameState_JOINING {
+		return state, nil, fmt.Errorf("alliances cannot be settled in state %v", state.State)
+	}
+
+	gameData := copyGameData(state)
+	events := []Event{}
+	for pID := int32(0); pID < int32(len(tfcPb.Player_name)); pID++ {
+		points, ok := settlement.Points[pID]
+		if !ok {
+			continue
+		}
+
+		if points > MAX_STAKE || points < -MAX_STAKE {
+			return state, nil, fmt.Errorf("settlement of %v points for %v is over the maximum stake %v",
+				points, tfcPb.Player(pID), MAX_STAKE)
+		}
+
+		profile, ok := gameData.Profiles[pID]
+		if !ok {
+			return state, nil, fmt.Errorf("player %v is not in the game", tfcPb.Player(pID))
+		}
+
+		before := profile.WinningPoints
+		profile.WinningPoints += points
+		if profile.WinningPoints < 0 {
+			profile.WinningPoints = 0
+		}
+		events = append(events, Event{Type: POINTS_CHANGED, Player: tfcPb.Player(pID),
+			Points: profile.WinningPoints - before})
+	}
+
+	if len(events) != len(settlement.Points) {
+		return state, nil, fmt.Errorf("invalid players in the settlement %v", settlement.Points)
+	}
+	return gameData, events, nil
+}
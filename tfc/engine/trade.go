@@ -1,20 +1,18 @@
-package tfc
+package engine
 
 import (
 	"fmt"
 	"regexp"
 
-	"github.com/hyperledger/fabric/core/chaincode/shim"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 )
 
-func handleTrade(APIstub shim.ChaincodeStubInterface, creatorSign []byte,
-	gameData tfcPb.GameData, payload tfcPb.TradeTrxPayload) (tfcPb.GameData, error) {
+func handleTrade(gameData tfcPb.GameData, creator tfcPb.Player,
+	payload tfcPb.TradeTrxPayload) (tfcPb.GameData, error) {
 
-	err := assertTradePrecond(APIstub, gameData, creatorSign, payload)
+	err := assertTradePrecond(gameData, creator, payload)
 	if err != nil {
-		return gameData, fmt.Errorf(
-			"trade preconditions not met: %s", err)
+		return gameData, withContext("trade preconditions not met", err)
 	}
 
 	srcID := GetPlayerId(payload.Source)
@@ -40,21 +38,28 @@ var tradeStateValidationRegexp = regexp.MustCompile(
 		fmt.Sprintf("|%vGTRADE", tfcPb.Player_GREEN))
 
 // TODO: implement this
-func assertTradePrecond(APIstub shim.ChaincodeStubInterface,
-	gameData tfcPb.GameData, creatorSign []byte, payload tfcPb.TradeTrxPayload) error {
+func assertTradePrecond(gameData tfcPb.GameData, creator tfcPb.Player, payload tfcPb.TradeTrxPayload) error {
 	state := gameData.State
-	creator, err := getCreator(APIstub, creatorSign)
-	if err != nil || creator != payload.Source {
-		return fmt.Errorf("invalid trx creator, or creator not identified (<0): expected %v, got %v",
+	if creator != payload.Source {
+		return ruleErrorf(RULE_CREATOR, "invalid trx creator, or creator not identified (<0): expected %v, got %v",
 			creator, payload.Source)
 	}
 
 	stateValidationStr := stateValidationString(creator, state)
 	if !tradeStateValidationRegexp.MatchString(stateValidationStr) {
-		return fmt.Errorf("expected state to match one of %v, got %v",
+		return ruleErrorf(RULE_TURN_ORDER, "expected state to match one of %v, got %v",
 			tradeStateValidationRegexp, stateValidationStr)
 	}
 
+	for _, p := range []tfcPb.Player{payload.Source, payload.Dest} {
+		profile, ok := gameData.Profiles[GetPlayerId(p)]
+		if !ok || profile == nil {
+			return fmt.Errorf("player %v has not joined the game", p)
+		}
+		if profile.Resources == nil {
+			return fmt.Errorf("the resources of %v are not available", p)
+		}
+	}
 	return nil
 }
 
@@ -75,7 +80,7 @@ func hasValidPostTradeAmount(p tfcPb.Player, gameData tfcPb.GameData, r tfcPb.Re
 	pP := *gameData.Profiles[GetPlayerId(p)]
 	available := pP.Resources[rID]
 	if available < 0 {
-		return fmt.Errorf("player %v does not have required %v resources: %s",
+		return ruleErrorf(RULE_TRADE_AMOUNT, "player %v does not have required %v resources: %s",
 			p, r,
 			fmt.Sprintf("available: %v", available))
 	}
@@ -26,27 +26,36 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/ratings"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 )
 
 const CONTRACT_STATE_KEY = "contract.tfc.com"
 const IDENTITY_MAP_KEY = "contract.tfc.com.idmap"
 
+// PLAYER_FCN is the function name used to query the player joined with
+// a creator signature.
+const PLAYER_FCN = "player"
+
+// GAME_FCN is the function name used to query the ID of the game.
+const GAME_FCN = "game"
+
 var ContractID = int32(binary.LittleEndian.Uint16([]byte(CONTRACT_STATE_KEY)))
 
 func HandleInit(APIstub shim.ChaincodeStubInterface) pb.Response {
 	// The first argument is the function name!
 	// Second will be our protobuf payload.
 
-	gameBoard, err := NewGameBoard()
+	// The board is generated from the game ID, so that every endorser
+	// and the replayer build the same board.
+	var contractUUID = []byte(APIstub.GetTxID())
+	gameData, err := engine.NewGameData(GameSeed(string(contractUUID)))
 	if err != nil {
-		errStr := fmt.Sprintf("could not create game board: %s", err)
-		return shim.Error(errStr)
+		return shim.Error(err.Error())
 	}
 
 	identityMap := make(map[int32][]byte)
-
-	var contractUUID = []byte(APIstub.GetTxID())
 	identityMap[ContractID] = contractUUID
 
 	jsonData, err := json.Marshal(identityMap)
@@ -56,10 +65,9 @@ func HandleInit(APIstub shim.ChaincodeStubInterface) pb.Response {
 
 	APIstub.PutState(IDENTITY_MAP_KEY, jsonData)
 
-	gameData := &tfcPb.GameData{
-		Board: gameBoard,
-		State: tfcPb.GameState_JOINING,
-	}
+	// The hands of a previous game stay in the private collections until
+	// the players join again, only their digests are dropped.
+	APIstub.PutState(HAND_DIGESTS_KEY, []byte("{}"))
 
 	protoData, err := proto.Marshal(gameData)
 	if err != nil {
@@ -72,14 +80,25 @@ func HandleInit(APIstub shim.ChaincodeStubInterface) pb.Response {
 
 func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 
-	// fcn := string(APIstub.GetArgs()[0])
-	// if fcn == "query" {
-	// 	protoData, err := APIstub.GetState(CONTRACT_STATE_KEY)
-	// 	if err != nil {
-	// 		return shim.Error(err.Error())
-	// 	}
-	// 	return shim.Success(protoData)
-	// }
+	fcn := string(APIstub.GetArgs()[0])
+	switch fcn {
+	case VIEW_FCN:
+		return HandleView(APIstub)
+	case MOVES_FCN:
+		return HandleMoves(APIstub)
+	case HISTORY_FCN:
+		return HandleHistory(APIstub)
+	case LEGAL_FCN:
+		return HandleLegalMoves(APIstub)
+	case ratings.LEADERBOARD_FCN:
+		return ratings.QueryLeaderboard(APIstub)
+	case SETTLE_FCN:
+		return HandleSettle(APIstub)
+	case PLAYER_FCN:
+		return HandlePlayer(APIstub)
+	case GAME_FCN:
+		return HandleGame(APIstub)
+	}
 
 	protoArgs := APIstub.GetArgs()[1]
 	trxArgs := &tfcPb.GameContractTrxArgs{}
@@ -89,54 +108,93 @@ func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 			fmt.Sprintf("could not unmarshal arguments proto message <%v>: %s", protoArgs, err))
 	}
 
-	gameData, err := getLedgerData(APIstub)
+	hands, err := trxHands(*trxArgs)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	creatorSign, err := APIstub.GetCreator()
+	gameData, err := getGameData(APIstub)
 	if err != nil {
-		return shim.Error(fmt.Sprintf(
-			"could not retrieve transaction creator: %s", err))
+		return shim.Error(err.Error())
 	}
 
-	creatorCS := crc32.ChecksumIEEE(creatorSign)
-	creatorCSBytes := []byte(fmt.Sprintf("%d", creatorCS))
+	preDigests, err := getHandDigests(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	log.Printf("Handling transaction from state %s", gameData.State)
+	err = assertHandsAvailable(*gameData, hands...)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	// Handle transaction logic
-	var newGameData tfcPb.GameData
-	switch trxArgs.Type {
-	case tfcPb.GameTrxType_JOIN:
-		newGameData, err = handleJoin(APIstub, creatorCSBytes, *gameData, *trxArgs.JoinTrxPayload)
-	case tfcPb.GameTrxType_ROLL:
-		// TODO
-		log.Println("ROLL is not yet implemented.")
-		newGameData = *gameData
-	case tfcPb.GameTrxType_NEXT:
-		log.Println("NEXT trx. Nothing to do here")
-		newGameData = *gameData
-	case tfcPb.GameTrxType_TRADE:
-		newGameData, err = handleTrade(APIstub, creatorCSBytes, *gameData, *trxArgs.TradeTrxPayload)
-	case tfcPb.GameTrxType_DEV:
-		newGameData, err = handleDev(APIstub, creatorCSBytes, *gameData, *trxArgs.BuildTrxPayload)
-	default:
-		return shim.Error(fmt.Sprint("Unkown transaction type <>"))
+	// The changed hands take their pending credits first, and the player
+	// taking the resources of a trade is credited in its digest, since
+	// only the peers of its own org hold its hand.
+	postDigests := make(map[int32]HandDigest, len(preDigests))
+	for pID, digest := range preDigests {
+		postDigests[pID] = digest
+	}
+	claimCredits(gameData, postDigests, hands...)
+	if trxArgs.Type == tfcPb.GameTrxType_TRADE {
+		standInTaker(gameData, *trxArgs.TradeTrxPayload)
 	}
+
+	creatorCSBytes, err := getCreatorSign(APIstub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// Compute the next game state
-	newGameState, err := computeNextState(newGameData, trxArgs.Type)
+	// Only the join transaction names its player, everything else
+	// is attributed to the creator. Unknown creators are spectators,
+	// which the rules reject wherever a player is required.
+	player := engine.Spectator
+	if trxArgs.Type == tfcPb.GameTrxType_JOIN && trxArgs.JoinTrxPayload != nil {
+		player = trxArgs.JoinTrxPayload.Player
+		// A creator plays a single colour, the ratings would otherwise
+		// see the same identity on several ranks and never settle the game.
+		if joined, err := getCreator(APIstub, creatorCSBytes); err == nil {
+			return shim.Error(fmt.Sprintf("creator already joined as %v", joined))
+		}
+	} else if creator, err := getCreator(APIstub, creatorCSBytes); err == nil {
+		player = creator
+	}
+
+	log.Printf("Handling transaction from state %s", gameData.State)
+	prevState := gameData.State
+
+	newGameData, events, err := engine.Apply(*gameData, player, *trxArgs)
 	if err != nil {
-		// Disable during testing until all components are working
 		return shim.Error(err.Error())
 	}
+	for _, event := range events {
+		log.Printf("Game event: %+v", event)
+	}
+
+	if trxArgs.Type == tfcPb.GameTrxType_JOIN {
+		err = putIdentity(APIstub, player, creatorCSBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 
-	newGameData.State = newGameState
 	log.Printf("Finished processing transaction, with state %v", newGameData.State)
+
+	if trxArgs.Type == tfcPb.GameTrxType_TRADE {
+		deferCredit(&newGameData, postDigests, *trxArgs.TradeTrxPayload)
+	}
+
+	// Move the hands to the private collections, only digests stay public
+	err = putPrivateHands(APIstub, &newGameData, postDigests)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = AssertHandTotals(preDigests, postDigests, *trxArgs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Put the state back on the ledger and return a result
 	protoData, err := proto.Marshal(&newGameData)
 	if err != nil {
@@ -144,117 +202,38 @@ func HandleInvoke(APIstub shim.ChaincodeStubInterface) pb.Response {
 	}
 	APIstub.PutState(CONTRACT_STATE_KEY, protoData)
 	log.Printf("Saved state on the ledger. ")
-	return shim.Success(protoData)
-
-}
 
-func assertJoinPrecond(gameData tfcPb.GameData, payload tfcPb.JoinTrxPayload) error {
-	if gameData.State != tfcPb.GameState_JOINING {
-		return fmt.Errorf("unexpected game state. expected %v, got %v",
-			tfcPb.GameState_JOINING, gameData.State)
+	err = appendMove(APIstub, player, *trxArgs, prevState, newGameData)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	playerID := GetPlayerId(payload.Player)
-	if _, ok := gameData.Profiles[playerID]; ok {
-		return fmt.Errorf("player <%v> already taken", payload.Player)
+	_, wasWon := engine.Winner(prevState)
+	if _, won := engine.Winner(newGameData.State); won && !wasWon {
+		err = recordRatings(APIstub, newGameData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
-	return nil
-}
-
-func handleJoin(APIstub shim.ChaincodeStubInterface, creatorSign []byte,
-	gameData tfcPb.GameData, payload tfcPb.JoinTrxPayload) (tfcPb.GameData, error) {
+	return shim.Success(protoData)
 
-	err := assertJoinPrecond(gameData, payload)
-	if err != nil {
-		return gameData, fmt.Errorf(
-			"join preconditions not met: %s", err)
-	}
+}
 
-	log.Printf("Joining player %v with sign %v", payload.Player, creatorSign)
-	playerID := GetPlayerId(payload.Player)
+func putIdentity(APIstub shim.ChaincodeStubInterface, player tfcPb.Player, creatorSign []byte) error {
+	log.Printf("Joining player %v with sign %v", player, creatorSign)
 
 	idMap, err := getIdentityMap(APIstub)
 	if err != nil {
-		return gameData, err
+		return err
 	}
 
-	idMap[playerID] = creatorSign
+	idMap[engine.GetPlayerId(player)] = creatorSign
 	jsonData, err := json.Marshal(idMap)
 	if err != nil {
-		return gameData, fmt.Errorf("could not marshal id map: %s", err)
+		return fmt.Errorf("could not marshal id map: %s", err)
 	}
 
-	APIstub.PutState(IDENTITY_MAP_KEY, jsonData)
-
-	// If there was no other player that joined until now
-	// the profiles will be nil
-	if gameData.Profiles == nil {
-		gameData.Profiles = make(map[int32]*tfcPb.PlayerProfile)
-	}
-	gameData.Profiles[playerID] = InitPlayerProfile()
-
-	return gameData, nil
-}
-
-func computeNextState(gameData tfcPb.GameData, txType tfcPb.GameTrxType) (tfcPb.GameState, error) {
-	st := gameData.State
-	switch {
-	// A player just joined, move to RROLL if all are in
-	case txType == tfcPb.GameTrxType_JOIN:
-		if len(gameData.Profiles) == 3 {
-			return tfcPb.GameState_RROLL, nil
-		}
-		return tfcPb.GameState_JOINING, nil
-
-	case txType == tfcPb.GameTrxType_ROLL:
-		switch st {
-		case tfcPb.GameState_RROLL:
-			return tfcPb.GameState_RTRADE, nil
-		case tfcPb.GameState_GROLL:
-			return tfcPb.GameState_GTRADE, nil
-		case tfcPb.GameState_BROLL:
-			return tfcPb.GameState_BTRADE, nil
-		}
-
-	case txType == tfcPb.GameTrxType_NEXT:
-		switch st {
-		case tfcPb.GameState_RTRADE:
-			return tfcPb.GameState_RDEV, nil
-		case tfcPb.GameState_RDEV:
-			if won(tfcPb.Player_RED, gameData) {
-				return tfcPb.GameState_RWON, nil
-			}
-			return tfcPb.GameState_GROLL, nil
-		case tfcPb.GameState_GTRADE:
-			return tfcPb.GameState_GDEV, nil
-		case tfcPb.GameState_GDEV:
-			if won(tfcPb.Player_GREEN, gameData) {
-				return tfcPb.GameState_GWON, nil
-			}
-			return tfcPb.GameState_BROLL, nil
-		case tfcPb.GameState_BTRADE:
-			return tfcPb.GameState_BDEV, nil
-		case tfcPb.GameState_BDEV:
-			if won(tfcPb.Player_BLUE, gameData) {
-				return tfcPb.GameState_BWON, nil
-			}
-			return tfcPb.GameState_RROLL, nil
-		}
-	case txType == tfcPb.GameTrxType_TRADE:
-		return st, nil
-	case txType == tfcPb.GameTrxType_DEV:
-		return st, nil
-	case txType == tfcPb.GameTrxType_BATTLE:
-		return st, nil
-	}
-	return st, fmt.Errorf(
-		"could not compute next state from st %v and trx type %v", st, txType)
-}
-
-func won(player tfcPb.Player, gameData tfcPb.GameData) bool {
-	id := GetPlayerId(player)
-	profile := gameData.Profiles[id]
-	return profile.WinningPoints > 10
+	return APIstub.PutState(IDENTITY_MAP_KEY, jsonData)
 }
 
 func getLedgerData(APIstub shim.ChaincodeStubInterface) (*tfcPb.GameData, error) {
@@ -285,6 +264,49 @@ func getIdentityMap(APIstub shim.ChaincodeStubInterface) (map[int32][]byte, erro
 	return idMap, nil
 }
 
+// getCreatorSign returns the checksum of the transaction creator, which is
+// the signature stored in the identity map when a player joins.
+func getCreatorSign(APIstub shim.ChaincodeStubInterface) ([]byte, error) {
+	creatorSign, err := APIstub.GetCreator()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"could not retrieve transaction creator: %s", err)
+	}
+
+	return CreatorSign(creatorSign), nil
+}
+
+// CreatorSign returns the checksum identifying the creator in the game.
+func CreatorSign(creator []byte) []byte {
+	creatorCS := crc32.ChecksumIEEE(creator)
+	return []byte(fmt.Sprintf("%d", creatorCS))
+}
+
+// HandlePlayer returns the player joined with the creator signature
+// given as argument, so that other chaincodes can identify the players.
+func HandlePlayer(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	if len(args) != 2 {
+		return shim.Error("expected a creator signature")
+	}
+
+	player, err := getCreator(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(player.String()))
+}
+
+// HandleGame returns the ID of the game, so that other chaincodes can
+// tell the games apart.
+func HandleGame(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID, err := getGameID(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(gameID))
+}
+
 var playerExists = regexp.MustCompile(fmt.Sprintf("%v|%v|%v",
 	tfcPb.Player_BLUE, tfcPb.Player_GREEN, tfcPb.Player_RED))
 
@@ -9,13 +9,16 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
 	"github.com/stefanprisca/strategy-protobufs/tfc"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 	"github.com/stretchr/testify/require"
 )
 
-// Dummy struct for hyperledger
+// Dummy struct for hyperledger. Unless told otherwise, the clients send
+// a hand salt along with every transaction.
 type MockContract struct {
+	noSalt bool
 }
 
 func (gc *MockContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
@@ -23,7 +26,10 @@ func (gc *MockContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
 }
 
 func (gc *MockContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
-	return HandleInvoke(APIstub)
+	if gc.noSalt {
+		return HandleInvoke(APIstub)
+	}
+	return HandleInvoke(saltedStub{APIstub})
 }
 
 func initContract(t *testing.T, cUUID string) *shim.MockStub {
@@ -51,7 +57,15 @@ func TestInitGameContract(t *testing.T) {
 	gameData, err := getLedgerData(stub)
 	require.NoError(t, err, "could not get ledger data")
 
-	assertGameBoard(t, *gameData.Board)
+	// The board must be the one generated from the game seed
+	expectedBoard, err := engine.NewSeededGameBoard(GameSeed(cUUID))
+	require.NoError(t, err)
+	require.Equal(t, len(expectedBoard.Tiles), len(gameData.Board.Tiles))
+	for tID, T := range expectedBoard.Tiles {
+		require.Contains(t, gameData.Board.Tiles, tID)
+		require.Equal(t, T.Attributes.Resource, gameData.Board.Tiles[tID].Attributes.Resource)
+		require.Equal(t, T.Attributes.RollNumber, gameData.Board.Tiles[tID].Attributes.RollNumber)
+	}
 
 	require.Empty(t, gameData.Profiles,
 		"expected profiles to be empty")
@@ -83,7 +97,7 @@ func TestJoinGame(t *testing.T) {
 
 	idMap, err := getIdentityMap(stub)
 	require.NoError(t, err)
-	expectedId := GetPlayerId(tfcPb.Player_RED)
+	expectedId := engine.GetPlayerId(tfcPb.Player_RED)
 	_, ok := idMap[expectedId]
 	require.True(t, ok,
 		fmt.Sprintf("expected to find player id for %v after join operation.", tfcPb.Player_RED))
@@ -99,6 +113,28 @@ func TestJoinGame(t *testing.T) {
 
 }
 
+func TestJoinTwiceFails(t *testing.T) {
+	stub := initContract(t, "01010101")
+	pP := playerSignedProposals[tfcPb.Player_RED]
+	_, err := NewArgsBuilder().
+		WithJoinArgs(tfcPb.Player_RED).
+		invokeSignedMock(stub, pP)
+	require.NoError(t, err)
+
+	_, err = NewArgsBuilder().
+		WithJoinArgs(tfcPb.Player_BLUE).
+		invokeSignedMock(stub, pP)
+	require.Error(t, err, "expected a creator not to join twice")
+
+	idMap, err := getIdentityMap(stub)
+	require.NoError(t, err)
+	require.NotContains(t, idMap, engine.GetPlayerId(tfcPb.Player_BLUE))
+
+	gameData, err := getLedgerData(stub)
+	require.NoError(t, err)
+	require.Len(t, gameData.Profiles, 1)
+}
+
 func TestRGBJoinGame(t *testing.T) {
 	cUUID := "01010101"
 	stub := initContract(t, cUUID)
@@ -110,7 +146,7 @@ func TestRGBJoinGame(t *testing.T) {
 	require.Equal(t, tfcPb.GameState_RROLL, gameData.State,
 		"unexpected state after one player joined")
 
-	redID := GetPlayerId(tfcPb.Player_RED)
+	redID := engine.GetPlayerId(tfcPb.Player_RED)
 	sign := playerSignedProposals[tfcPb.Player_RED].Signature
 	signCs := crc32.ChecksumIEEE(sign)
 	expectedSign := []byte(fmt.Sprintf("%d", signCs))
@@ -121,6 +157,29 @@ func TestRGBJoinGame(t *testing.T) {
 	require.Equal(t, expectedSign, actualSign)
 }
 
+func TestPlayerQuery(t *testing.T) {
+	stub := initContract(t, "01010101")
+	err := newSI(stub).joinRGB(playerSignedProposals).getError()
+	require.NoError(t, err)
+
+	for p, sp := range playerSignedProposals {
+		resp := stub.MockInvoke("player", [][]byte{[]byte(PLAYER_FCN), CreatorSign(sp.Signature)})
+		require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+		require.Equal(t, p.String(), string(resp.Payload))
+	}
+
+	resp := stub.MockInvoke("player", [][]byte{[]byte(PLAYER_FCN), CreatorSign([]byte("nobody"))})
+	require.EqualValues(t, shim.ERROR, resp.Status)
+}
+
+func TestGameQuery(t *testing.T) {
+	stub := initContract(t, "01010101")
+
+	resp := stub.MockInvoke("game", [][]byte{[]byte(GAME_FCN)})
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+	require.Equal(t, "01010101", string(resp.Payload))
+}
+
 func TestTrade(t *testing.T) {
 	cUUID := "01010101"
 	stub := initContract(t, cUUID)
@@ -141,31 +200,19 @@ func TestTrade(t *testing.T) {
 func assertCorrectTrade(t *testing.T, stub *shim.MockStub,
 	src, dest tfcPb.Player, resource tfcPb.Resource, amount int32) {
 
-	gameData, err := getLedgerData(stub)
-	require.NoError(t, err)
-
-	preSrcProfile := gameData.Profiles[GetPlayerId(src)]
-	preDestProfile := gameData.Profiles[GetPlayerId(dest)]
+	rID := engine.GetResourceId(resource)
 
-	rID := GetResourceId(resource)
+	expectedSrcA := heldResources(t, stub, src)[rID] - amount
+	expectedDestA := heldResources(t, stub, dest)[rID] + amount
 
-	expectedSrcA := preSrcProfile.Resources[rID] - amount
-	expectedDestA := preDestProfile.Resources[rID] + amount
-
-	_, err = NewArgsBuilder().
+	_, err := NewArgsBuilder().
 		WithTradeArgs(src, dest,
 			resource, amount).
 		invokeSignedMock(stub, playerSignedProposals[src])
 	require.NoError(t, err)
 
-	gameData, err = getLedgerData(stub)
-	require.NoError(t, err)
-
-	postSrcProfile := gameData.Profiles[GetPlayerId(src)]
-	postDestProfile := gameData.Profiles[GetPlayerId(dest)]
-
-	actualSrcA := postSrcProfile.Resources[rID]
-	actualDestA := postDestProfile.Resources[rID]
+	actualSrcA := heldResources(t, stub, src)[rID]
+	actualDestA := heldResources(t, stub, dest)[rID]
 
 	require.Equal(t, expectedSrcA, actualSrcA,
 		"source amount invalid after trade")
@@ -173,6 +220,17 @@ func assertCorrectTrade(t *testing.T, stub *shim.MockStub,
 		"source amount invalid after trade")
 }
 
+// heldResources returns the hand of the player along with its pending credits.
+func heldResources(t *testing.T, stub *shim.MockStub, p tfcPb.Player) map[int32]int32 {
+	gameData, err := getGameData(stub)
+	require.NoError(t, err)
+	digests, err := getHandDigests(stub)
+	require.NoError(t, err)
+
+	claimCredits(gameData, digests, p)
+	return gameData.Profiles[engine.GetPlayerId(p)].Resources
+}
+
 func TestBuildSettle(t *testing.T) {
 	cUUID := "01010101"
 	stub := initContract(t, cUUID)
@@ -185,8 +243,8 @@ func TestBuildSettle(t *testing.T) {
 
 	require.NoError(t, err)
 
-	sID := pointHash(tfc.Coord{X: 0, Y: 0})
-	eID := edgeHash(tfc.Coord{X: 0, Y: 0}, N)
+	sID := engine.PointHash(tfc.Coord{X: 0, Y: 0})
+	eID := engine.EdgeHash(tfc.Coord{X: 0, Y: 0}, engine.N)
 
 	player := tfcPb.Player_RED
 	proposal := playerSignedProposals[player]
@@ -200,7 +258,7 @@ func TestBuildSettle(t *testing.T) {
 		invokeSignedMock(stub, proposal)
 	require.NoError(t, err)
 
-	gameData, err := getLedgerData(stub)
+	gameData, err := getGameData(stub)
 	require.NoError(t, err)
 
 	I := gameData.Board.Intersections[sID]
@@ -215,7 +273,7 @@ func TestBuildSettle(t *testing.T) {
 	require.Equal(t, expectedRoad, actualRoad,
 		"unexpected road found after building red road")
 
-	profile := gameData.Profiles[GetPlayerId(tfcPb.Player_RED)]
+	profile := gameData.Profiles[engine.GetPlayerId(tfcPb.Player_RED)]
 	for _, r := range profile.Resources {
 		require.NotEqual(t, 5, r,
 			"expected build to consume resources")
@@ -0,0 +1,166 @@
+package tfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// HISTORY_FCN is the function name used to query the history of the game.
+// It takes an optional page size and bookmark as arguments.
+const HISTORY_FCN = "history"
+
+const DEFAULT_HISTORY_PAGE_SIZE = 100
+
+// INIT_TRX_TYPE is the transaction type reported for the game creation.
+const INIT_TRX_TYPE = "INIT"
+
+// SETTLE_TRX_TYPE is the transaction type reported for alliance settlements.
+const SETTLE_TRX_TYPE = "SETTLE"
+
+// HistoryEntry is one version of the game state.
+type HistoryEntry struct {
+	TxID      string          `json:"txID"`
+	Timestamp time.Time       `json:"timestamp"`
+	State     tfcPb.GameState `json:"state"`
+	TrxType   string          `json:"trxType"`
+	Points    map[int32]int32 `json:"points"`
+}
+
+// HistoryPage is a page of the game timeline. The bookmark is the
+// tx ID the next page starts with, and it is empty on the last page.
+type HistoryPage struct {
+	Entries  []HistoryEntry `json:"entries"`
+	Bookmark string         `json:"bookmark"`
+}
+
+// HandleHistory returns a page of the game timeline, oldest first.
+func HandleHistory(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+
+	pageSize := DEFAULT_HISTORY_PAGE_SIZE
+	if len(args) > 1 && len(args[1]) > 0 {
+		size, err := strconv.Atoi(string(args[1]))
+		if err != nil || size <= 0 {
+			return shim.Error(fmt.Sprintf("invalid history page size <%s>", args[1]))
+		}
+		pageSize = size
+	}
+
+	bookmark := ""
+	if len(args) > 2 {
+		bookmark = string(args[2])
+	}
+
+	page, err := getHistoryPage(APIstub, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the history page: %s", err))
+	}
+	return shim.Success(jsonData)
+}
+
+func getHistoryPage(APIstub shim.ChaincodeStubInterface, pageSize int, bookmark string) (HistoryPage, error) {
+	page := HistoryPage{Entries: []HistoryEntry{}}
+
+	// The move log tells which transaction made each version
+	moves, err := getMoveLog(APIstub)
+	if err != nil {
+		return page, err
+	}
+	trxTypes := make(map[string]string)
+	for _, move := range moves {
+		if move.Settlement != nil {
+			trxTypes[move.TxID] = SETTLE_TRX_TYPE
+			continue
+		}
+
+		trxArgs, err := move.TrxArgs()
+		if err != nil {
+			return page, err
+		}
+		trxTypes[move.TxID] = trxArgs.Type.String()
+	}
+
+	iter, err := APIstub.GetHistoryForKey(CONTRACT_STATE_KEY)
+	if err != nil {
+		return page, fmt.Errorf("could not query the game history: %s", err)
+	}
+	defer iter.Close()
+
+	started := bookmark == ""
+	for iter.HasNext() {
+		km, err := iter.Next()
+		if err != nil {
+			return page, fmt.Errorf("could not iterate the game history: %s", err)
+		}
+
+		if !started && km.TxId != bookmark {
+			continue
+		}
+		started = true
+
+		if km.IsDelete {
+			continue
+		}
+
+		if len(page.Entries) == pageSize {
+			page.Bookmark = km.TxId
+			break
+		}
+
+		entry, err := newHistoryEntry(km.TxId, km.Timestamp, km.Value)
+		if err != nil {
+			return page, err
+		}
+
+		entry.TrxType = INIT_TRX_TYPE
+		if trxType, ok := trxTypes[km.TxId]; ok {
+			entry.TrxType = trxType
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+
+	if !started {
+		return page, fmt.Errorf("unknown history bookmark <%s>", bookmark)
+	}
+	return page, nil
+}
+
+func newHistoryEntry(txID string, ts *timestamp.Timestamp, protoData []byte) (HistoryEntry, error) {
+	gameData := &tfcPb.GameData{}
+	err := proto.Unmarshal(protoData, gameData)
+	if err != nil {
+		return HistoryEntry{}, fmt.Errorf("could not unmarshal the game data of tx %v: %s", txID, err)
+	}
+
+	entry := HistoryEntry{
+		TxID:   txID,
+		State:  gameData.State,
+		Points: make(map[int32]int32),
+	}
+
+	if ts != nil {
+		entry.Timestamp, err = ptypes.Timestamp(ts)
+		if err != nil {
+			return entry, fmt.Errorf("invalid timestamp for tx %v: %s", txID, err)
+		}
+	}
+
+	for pID, profile := range gameData.Profiles {
+		entry.Points[pID] = profile.WinningPoints
+	}
+	return entry, nil
+}
@@ -0,0 +1,146 @@
+package tfc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+// The mock stub does not implement history queries,
+// so this stub records every version written to the state.
+type historyStub struct {
+	*shim.MockStub
+	history map[string][]*queryresult.KeyModification
+}
+
+func (hs *historyStub) PutState(key string, value []byte) error {
+	hs.history[key] = append(hs.history[key], &queryresult.KeyModification{
+		TxId:      hs.TxID,
+		Value:     value,
+		Timestamp: hs.TxTimestamp,
+	})
+	return hs.MockStub.PutState(key, value)
+}
+
+func (hs *historyStub) GetTransient() (map[string][]byte, error) {
+	return saltedStub{hs.MockStub}.GetTransient()
+}
+
+func (hs *historyStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{hs.history[key]}, nil
+}
+
+type historyIterator struct {
+	mods []*queryresult.KeyModification
+}
+
+func (hi *historyIterator) HasNext() bool {
+	return len(hi.mods) > 0
+}
+
+func (hi *historyIterator) Close() error {
+	return nil
+}
+
+func (hi *historyIterator) Next() (*queryresult.KeyModification, error) {
+	km := hi.mods[0]
+	hi.mods = hi.mods[1:]
+	return km, nil
+}
+
+type historyContract struct {
+	stub *historyStub
+}
+
+func (hc *historyContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return HandleInit(hc.stub)
+}
+
+func (hc *historyContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return HandleInvoke(hc.stub)
+}
+
+func initHistoryContract(t *testing.T, cUUID string) *shim.MockStub {
+	hs := &historyStub{history: make(map[string][]*queryresult.KeyModification)}
+	hs.MockStub = shim.NewMockStub("mockGameContract", &historyContract{hs})
+
+	r := hs.MockInit(cUUID, [][]byte{})
+	if r.GetStatus() != shim.OK {
+		t.Fatalf("Could not init the contract. Error: %s", r.Message)
+	}
+	return hs.MockStub
+}
+
+func TestHistory(t *testing.T) {
+	cUUID := "01010101"
+	stub := initHistoryContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		next(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	page := queryHistory(t, stub, "", "")
+	require.Len(t, page.Entries, 6)
+	require.Empty(t, page.Bookmark)
+
+	init := page.Entries[0]
+	require.Equal(t, cUUID, init.TxID)
+	require.Equal(t, INIT_TRX_TYPE, init.TrxType)
+	require.Equal(t, tfcPb.GameState_JOINING, init.State)
+	require.False(t, init.Timestamp.IsZero())
+
+	expectedTypes := []tfcPb.GameTrxType{
+		tfcPb.GameTrxType_JOIN, tfcPb.GameTrxType_JOIN, tfcPb.GameTrxType_JOIN,
+		tfcPb.GameTrxType_ROLL, tfcPb.GameTrxType_NEXT}
+	for i, trxType := range expectedTypes {
+		require.Equal(t, trxType.String(), page.Entries[i+1].TrxType)
+	}
+
+	last := page.Entries[5]
+	require.Equal(t, tfcPb.GameState_RDEV, last.State)
+	require.Len(t, last.Points, 3)
+}
+
+func TestHistoryPagination(t *testing.T) {
+	cUUID := "01010101"
+	stub := initHistoryContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	firstPage := queryHistory(t, stub, "3", "")
+	require.Len(t, firstPage.Entries, 3)
+	require.NotEmpty(t, firstPage.Bookmark)
+
+	secondPage := queryHistory(t, stub, "3", firstPage.Bookmark)
+	require.Len(t, secondPage.Entries, 2)
+	require.Empty(t, secondPage.Bookmark)
+	require.Equal(t, firstPage.Bookmark, secondPage.Entries[0].TxID)
+	require.Equal(t, tfcPb.GameState_RTRADE, secondPage.Entries[1].State)
+
+	// Bookmarks which are not in the history are rejected, not answered
+	// with an empty page
+	resp := stub.MockInvoke("history", [][]byte{[]byte(HISTORY_FCN), []byte("3"), []byte("unknown")})
+	require.EqualValues(t, shim.ERROR, resp.Status)
+	require.Contains(t, resp.Message, "unknown history bookmark <unknown>")
+}
+
+func queryHistory(t *testing.T, stub *shim.MockStub, pageSize, bookmark string) HistoryPage {
+	args := [][]byte{[]byte(HISTORY_FCN), []byte(pageSize), []byte(bookmark)}
+	resp := stub.MockInvoke("history", args)
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+
+	page := HistoryPage{}
+	err := json.Unmarshal(resp.Payload, &page)
+	require.NoError(t, err)
+	return page
+}
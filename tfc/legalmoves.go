@@ -0,0 +1,66 @@
+package tfc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// LEGAL_FCN is the function name used to query the legal moves of the caller.
+const LEGAL_FCN = "legal"
+
+// LegalMovesResult lists the actions the caller can make next.
+type LegalMovesResult struct {
+	Player tfcPb.Player                `json:"player"`
+	State  tfcPb.GameState             `json:"state"`
+	Moves  []tfcPb.GameContractTrxArgs `json:"moves"`
+}
+
+// HandleLegalMoves returns every action the transaction creator can make
+// in the current state. Callers which did not join can only see the
+// free seats while the game is joining.
+func HandleLegalMoves(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameData, err := getGameData(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creatorSign, err := getCreatorSign(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	player, err := getCreator(APIstub, creatorSign)
+	if err != nil {
+		player = engine.Spectator
+	}
+
+	// Trades and builds depend on the caller's hand, pending credits included
+	if _, joined := gameData.Profiles[engine.GetPlayerId(player)]; joined {
+		err = assertHandsAvailable(*gameData, player)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		digests, err := getHandDigests(APIstub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		claimCredits(gameData, digests, player)
+	}
+
+	result := LegalMovesResult{
+		Player: player,
+		State:  gameData.State,
+		Moves:  engine.LegalMoves(*gameData, player),
+	}
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the legal moves: %s", err))
+	}
+	return shim.Success(jsonData)
+}
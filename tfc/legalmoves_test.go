@@ -0,0 +1,46 @@
+package tfc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegalMovesQuery(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+
+	result := queryLegalMoves(t, stub, spectatorProposal)
+	require.Len(t, result.Moves, 3, "expected every seat to be free")
+
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	result = queryLegalMoves(t, stub, playerSignedProposals[tfcPb.Player_RED])
+	require.Equal(t, tfcPb.Player_RED, result.Player)
+	require.Equal(t, tfcPb.GameState_RTRADE, result.State)
+	require.NotEmpty(t, result.Moves)
+	for _, move := range result.Moves {
+		require.Contains(t, []tfcPb.GameTrxType{tfcPb.GameTrxType_TRADE, tfcPb.GameTrxType_NEXT}, move.Type)
+	}
+
+	result = queryLegalMoves(t, stub, playerSignedProposals[tfcPb.Player_BLUE])
+	require.Empty(t, result.Moves)
+}
+
+func queryLegalMoves(t *testing.T, stub *shim.MockStub, sp *pb.SignedProposal) LegalMovesResult {
+	resp := stub.MockInvokeWithSignedProposal("legal", [][]byte{[]byte(LEGAL_FCN)}, sp)
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+
+	result := LegalMovesResult{}
+	err := json.Unmarshal(resp.Payload, &result)
+	require.NoError(t, err)
+	return result
+}
@@ -0,0 +1,218 @@
+package tfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// MOVES_FCN is the function name used to query the move log of the game.
+const MOVES_FCN = "moves"
+
+// MOVE_INDEX is the object type of the move log composite keys.
+// Moves are keyed by game ID and sequence number.
+const MOVE_INDEX = "tfc.move"
+
+// MOVE_COUNT_KEY is the object type of the move count composite keys.
+// Counts are keyed by game ID, so that every game counts from zero.
+const MOVE_COUNT_KEY = "contract.tfc.com.movecount"
+
+// ROUND_KEY is the object type of the round count composite keys, which
+// keep the number of rounds played in each game.
+const ROUND_KEY = "contract.tfc.com.round"
+
+// MoveRecord is an accepted transaction, as kept in the move log.
+// Alliance settlements are logged with their settlement instead of args.
+// Round is the number of rounds played once the move was made.
+type MoveRecord struct {
+	Seq        uint32             `json:"seq"`
+	TxID       string             `json:"txID"`
+	Player     tfcPb.Player       `json:"player"`
+	Args       []byte             `json:"args"`
+	Settlement *engine.Settlement `json:"settlement,omitempty"`
+	PrevState  tfcPb.GameState    `json:"prevState"`
+	State      tfcPb.GameState    `json:"state"`
+	StateHash  []byte             `json:"stateHash"`
+	Round      uint32             `json:"round"`
+}
+
+// TrxArgs decodes the transaction arguments of the move.
+func (m MoveRecord) TrxArgs() (*tfcPb.GameContractTrxArgs, error) {
+	trxArgs := &tfcPb.GameContractTrxArgs{}
+	err := proto.Unmarshal(m.Args, trxArgs)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal the args of move %v: %s", m.Seq, err)
+	}
+	return trxArgs, nil
+}
+
+// HandleMoves returns the move log of the game, in order.
+func HandleMoves(APIstub shim.ChaincodeStubInterface) pb.Response {
+	moves, err := getMoveLog(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(moves)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal the move log: %s", err))
+	}
+	return shim.Success(jsonData)
+}
+
+func appendMove(APIstub shim.ChaincodeStubInterface, player tfcPb.Player,
+	trxArgs tfcPb.GameContractTrxArgs, prevState tfcPb.GameState, gameData tfcPb.GameData) error {
+
+	protoArgs, err := proto.Marshal(&trxArgs)
+	if err != nil {
+		return fmt.Errorf("could not marshal the move args: %s", err)
+	}
+
+	move := MoveRecord{Player: player, Args: protoArgs, PrevState: prevState}
+	return putMove(APIstub, move, gameData)
+}
+
+func appendSettlement(APIstub shim.ChaincodeStubInterface, settlement engine.Settlement,
+	prevState tfcPb.GameState, gameData tfcPb.GameData) error {
+
+	move := MoveRecord{Player: engine.Spectator, Settlement: &settlement, PrevState: prevState}
+	return putMove(APIstub, move, gameData)
+}
+
+// putMove logs the move as the next one, leading to the game data.
+func putMove(APIstub shim.ChaincodeStubInterface, move MoveRecord, gameData tfcPb.GameData) error {
+	gameID, err := getGameID(APIstub)
+	if err != nil {
+		return err
+	}
+
+	seq, err := getGameCounter(APIstub, MOVE_COUNT_KEY, gameID)
+	if err != nil {
+		return err
+	}
+
+	stateHash, err := StateHash(gameData)
+	if err != nil {
+		return err
+	}
+
+	round, err := getGameCounter(APIstub, ROUND_KEY, gameID)
+	if err != nil {
+		return err
+	}
+	if engine.RoundEnded(move.PrevState, gameData.State) {
+		round++
+		err = putGameCounter(APIstub, ROUND_KEY, gameID, round)
+		if err != nil {
+			return err
+		}
+	}
+
+	move.Seq = seq
+	move.TxID = APIstub.GetTxID()
+	move.State = gameData.State
+	move.StateHash = stateHash
+	move.Round = round
+
+	jsonData, err := json.Marshal(move)
+	if err != nil {
+		return fmt.Errorf("could not marshal move %v: %s", seq, err)
+	}
+
+	key, err := moveKey(APIstub, gameID, seq)
+	if err != nil {
+		return err
+	}
+
+	err = APIstub.PutState(key, jsonData)
+	if err != nil {
+		return fmt.Errorf("could not save move %v: %s", seq, err)
+	}
+	return putGameCounter(APIstub, MOVE_COUNT_KEY, gameID, seq+1)
+}
+
+func getMoveLog(APIstub shim.ChaincodeStubInterface) ([]MoveRecord, error) {
+	gameID, err := getGameID(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := APIstub.GetStateByPartialCompositeKey(MOVE_INDEX, []string{gameID})
+	if err != nil {
+		return nil, fmt.Errorf("could not query the move log: %s", err)
+	}
+	defer iter.Close()
+
+	moves := []MoveRecord{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("could not iterate the move log: %s", err)
+		}
+
+		move := MoveRecord{}
+		err = json.Unmarshal(kv.Value, &move)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal move %v: %s", kv.Key, err)
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// getGameCounter returns the count of the game, zero until it is first saved.
+func getGameCounter(APIstub shim.ChaincodeStubInterface, counter, gameID string) (uint32, error) {
+	key, err := APIstub.CreateCompositeKey(counter, []string{gameID})
+	if err != nil {
+		return 0, fmt.Errorf("could not create the %s key: %s", counter, err)
+	}
+	countData, err := APIstub.GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("could not get the %s from state: %s", counter, err)
+	}
+	if countData == nil {
+		return 0, nil
+	}
+
+	count, err := strconv.ParseUint(string(countData), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the %s: %s", counter, err)
+	}
+	return uint32(count), nil
+}
+
+func putGameCounter(APIstub shim.ChaincodeStubInterface, counter, gameID string, count uint32) error {
+	key, err := APIstub.CreateCompositeKey(counter, []string{gameID})
+	if err != nil {
+		return fmt.Errorf("could not create the %s key: %s", counter, err)
+	}
+	err = APIstub.PutState(key, []byte(strconv.FormatUint(uint64(count), 10)))
+	if err != nil {
+		return fmt.Errorf("could not save the %s: %s", counter, err)
+	}
+	return nil
+}
+
+// The sequence number is zero padded, so the keys sort in move order.
+func moveKey(APIstub shim.ChaincodeStubInterface, gameID string, seq uint32) (string, error) {
+	key, err := APIstub.CreateCompositeKey(MOVE_INDEX, []string{gameID, fmt.Sprintf("%010d", seq)})
+	if err != nil {
+		return "", fmt.Errorf("could not create the key of move %v: %s", seq, err)
+	}
+	return key, nil
+}
+
+// getGameID returns the ID of the game, which is the ID of the init transaction.
+func getGameID(APIstub shim.ChaincodeStubInterface) (string, error) {
+	idMap, err := getIdentityMap(APIstub)
+	if err != nil {
+		return "", err
+	}
+	return string(idMap[ContractID]), nil
+}
@@ -0,0 +1,371 @@
+package tfc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// HAND_DIGESTS_KEY holds the public digests of the private player hands.
+const HAND_DIGESTS_KEY = "contract.tfc.com.hands"
+
+// HAND_SALT_KEY is the transient data key of the secret salt of the hand
+// of the joining player. The salt is hashed along with the hand, so that
+// the public digest cannot be reversed by enumerating the possible hands.
+// It is only kept in the private collection of the player.
+const HAND_SALT_KEY = "handSalt"
+
+// MIN_HAND_SALT is the minimum length of a hand salt, in bytes.
+const MIN_HAND_SALT = 16
+
+// PrivateHand is the hidden part of a player profile. It is stored in the
+// player's private data collection, under the contract state key, along
+// with the secret salt of its digest.
+type PrivateHand struct {
+	Resources map[int32]int32 `json:"resources"`
+	Salt      []byte          `json:"salt"`
+}
+
+// HandDigest is the public trace of a private hand. The hash lets endorsers
+// check the private data they read. Pending holds the resources traded to
+// the player, by resource ID, which are only added to the hand by the next
+// transaction the player's own peers endorse on it. The count and the
+// pending credits let anyone validate the totals moved by a transaction
+// from its public write set, without seeing the hand.
+type HandDigest struct {
+	Hash    []byte          `json:"hash"`
+	Count   int32           `json:"count"`
+	Pending map[int32]int32 `json:"pending,omitempty"`
+}
+
+// Total returns the resources of the player, pending credits included.
+func (d HandDigest) Total() int32 {
+	return d.Count + handCount(d.Pending)
+}
+
+// HandCollection returns the private data collection holding the hand of p.
+// The collections are defined in the network collection config,
+// one for each player org.
+func HandCollection(p tfcPb.Player) string {
+	return fmt.Sprintf("tfcHand%v", p)
+}
+
+func newHandDigest(hand PrivateHand) (HandDigest, []byte, error) {
+	jsonData, err := json.Marshal(hand)
+	if err != nil {
+		return HandDigest{}, nil, fmt.Errorf("could not marshal private hand: %s", err)
+	}
+
+	hash := sha256.Sum256(jsonData)
+	return HandDigest{Hash: hash[:], Count: handCount(hand.Resources)}, jsonData, nil
+}
+
+func handCount(resources map[int32]int32) int32 {
+	count := int32(0)
+	for _, amount := range resources {
+		count += amount
+	}
+	return count
+}
+
+// getGameData reads the public game data and fills in every private hand
+// which this peer can access. Hands which are not available are left nil.
+func getGameData(APIstub shim.ChaincodeStubInterface) (*tfcPb.GameData, error) {
+	gameData, err := getLedgerData(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	digests, err := getHandDigests(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	for pID, profile := range gameData.Profiles {
+		p := tfcPb.Player(pID)
+		jsonData, err := APIstub.GetPrivateData(HandCollection(p), CONTRACT_STATE_KEY)
+		if err != nil || jsonData == nil {
+			log.Printf("Private hand of %v is not available: %v", p, err)
+			continue
+		}
+
+		hand := PrivateHand{}
+		err = json.Unmarshal(jsonData, &hand)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal the private hand of %v: %s", p, err)
+		}
+
+		digest, _, err := newHandDigest(hand)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(digest.Hash, digests[pID].Hash) {
+			return nil, fmt.Errorf("private hand of %v does not match the public hash", p)
+		}
+
+		profile.Resources = hand.Resources
+	}
+	return gameData, nil
+}
+
+// putPrivateHands moves every changed hand into its private collection,
+// and leaves only the hand digests in the public game data. The digests
+// carry the pending credits of the transaction.
+func putPrivateHands(APIstub shim.ChaincodeStubInterface, gameData *tfcPb.GameData,
+	digests map[int32]HandDigest) error {
+
+	for pID, profile := range gameData.Profiles {
+		if profile.Resources == nil {
+			continue
+		}
+
+		p := tfcPb.Player(pID)
+		salt, err := handSalt(APIstub, p)
+		if err != nil {
+			return err
+		}
+		digest, jsonData, err := newHandDigest(PrivateHand{Resources: profile.Resources, Salt: salt})
+		if err != nil {
+			return err
+		}
+
+		profile.Resources = nil
+		if bytes.Equal(digest.Hash, digests[pID].Hash) {
+			continue
+		}
+
+		err = APIstub.PutPrivateData(HandCollection(p), CONTRACT_STATE_KEY, jsonData)
+		if err != nil {
+			return fmt.Errorf("could not save the private hand of %v: %s", p, err)
+		}
+		digest.Pending = digests[pID].Pending
+		digests[pID] = digest
+	}
+
+	jsonData, err := json.Marshal(digests)
+	if err != nil {
+		return fmt.Errorf("could not marshal hand digests: %s", err)
+	}
+	APIstub.PutState(HAND_DIGESTS_KEY, jsonData)
+	return nil
+}
+
+// handSalt returns the salt of the hand of p, kept along with the hand.
+// Hands saved for the first time take the salt given in the transient data.
+func handSalt(APIstub shim.ChaincodeStubInterface, p tfcPb.Player) ([]byte, error) {
+	jsonData, err := APIstub.GetPrivateData(HandCollection(p), CONTRACT_STATE_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the private hand of %v: %s", p, err)
+	}
+	if jsonData != nil {
+		hand := PrivateHand{}
+		err = json.Unmarshal(jsonData, &hand)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal the private hand of %v: %s", p, err)
+		}
+		return hand.Salt, nil
+	}
+
+	transient, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the transient data: %s", err)
+	}
+	salt := transient[HAND_SALT_KEY]
+	if len(salt) < MIN_HAND_SALT {
+		return nil, fmt.Errorf("expected a hand salt of at least %v bytes for %v in the transient data",
+			MIN_HAND_SALT, p)
+	}
+	return salt, nil
+}
+
+func getHandDigests(APIstub shim.ChaincodeStubInterface) (map[int32]HandDigest, error) {
+	jsonData, err := APIstub.GetState(HAND_DIGESTS_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get the hand digests from state. Error: %s", err.Error())
+	}
+
+	digests := make(map[int32]HandDigest)
+	if jsonData == nil {
+		return digests, nil
+	}
+
+	err = json.Unmarshal(jsonData, &digests)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the hand digests. Error: %s", err.Error())
+	}
+	return digests, nil
+}
+
+// trxHands returns the players whose private hands the transaction
+// changes, which must be available on the endorsing peer. A trade only
+// changes the hand of the player giving the resources: the Source, or the
+// Dest for negative amounts. The other player is credited in its digest.
+func trxHands(trxArgs tfcPb.GameContractTrxArgs) ([]tfcPb.Player, error) {
+	switch trxArgs.Type {
+	case tfcPb.GameTrxType_TRADE:
+		if trxArgs.TradeTrxPayload == nil {
+			return nil, fmt.Errorf("missing trade payload")
+		}
+		giver, _ := tradeParties(*trxArgs.TradeTrxPayload)
+		return []tfcPb.Player{giver}, nil
+	case tfcPb.GameTrxType_DEV:
+		builder, err := buildPlayer(trxArgs.BuildTrxPayload)
+		if err != nil || builder == engine.Spectator {
+			return nil, err
+		}
+		return []tfcPb.Player{builder}, nil
+	}
+	return []tfcPb.Player{}, nil
+}
+
+// tradeParties returns the player giving and the player taking the
+// resources of a trade.
+func tradeParties(payload tfcPb.TradeTrxPayload) (giver, taker tfcPb.Player) {
+	if payload.Amount < 0 {
+		return payload.Dest, payload.Source
+	}
+	return payload.Source, payload.Dest
+}
+
+// buildPlayer returns the player paying for a build, or the spectator
+// for builds without a cost.
+func buildPlayer(payload *tfcPb.BuildTrxPayload) (tfcPb.Player, error) {
+	switch {
+	case payload == nil:
+		return engine.Spectator, fmt.Errorf("missing build payload")
+	case payload.Type == tfcPb.BuildType_ROAD:
+		if payload.BuildRoadPayload == nil {
+			return engine.Spectator, fmt.Errorf("missing road payload")
+		}
+		return payload.BuildRoadPayload.Player, nil
+	case payload.Type == tfcPb.BuildType_SETTLE:
+		if payload.BuildSettlePayload == nil {
+			return engine.Spectator, fmt.Errorf("missing settlement payload")
+		}
+		return payload.BuildSettlePayload.Player, nil
+	}
+	return engine.Spectator, nil
+}
+
+func assertHandsAvailable(gameData tfcPb.GameData, players ...tfcPb.Player) error {
+	for _, p := range players {
+		profile, ok := gameData.Profiles[engine.GetPlayerId(p)]
+		if !ok || profile.Resources == nil {
+			return fmt.Errorf("the private hand of %v is not available on this peer", p)
+		}
+	}
+	return nil
+}
+
+// claimCredits adds the pending credits of the players to their hands,
+// and clears them from the digests. The hands must be available.
+func claimCredits(gameData *tfcPb.GameData, digests map[int32]HandDigest, players ...tfcPb.Player) {
+	for _, p := range players {
+		pID := engine.GetPlayerId(p)
+		digest := digests[pID]
+		for rID, amount := range digest.Pending {
+			gameData.Profiles[pID].Resources[rID] += amount
+		}
+		digest.Pending = nil
+		digests[pID] = digest
+	}
+}
+
+// standInTaker replaces the hand of the player taking the resources of a
+// trade with an empty one, so that the rules run the same on every peer,
+// whether or not it holds the taker's hand.
+func standInTaker(gameData *tfcPb.GameData, payload tfcPb.TradeTrxPayload) {
+	giver, taker := tradeParties(payload)
+	profile, ok := gameData.Profiles[engine.GetPlayerId(taker)]
+	if giver == taker || !ok {
+		return
+	}
+	profile.Resources = make(map[int32]int32)
+}
+
+// deferCredit moves the resources given to the stand-in hand of the
+// taker into its pending credits.
+func deferCredit(gameData *tfcPb.GameData, digests map[int32]HandDigest, payload tfcPb.TradeTrxPayload) {
+	giver, taker := tradeParties(payload)
+	if giver == taker {
+		return
+	}
+
+	takerID := engine.GetPlayerId(taker)
+	digest := digests[takerID]
+	pending := make(map[int32]int32)
+	for rID, amount := range digest.Pending {
+		pending[rID] = amount
+	}
+	for rID, amount := range gameData.Profiles[takerID].Resources {
+		pending[rID] += amount
+	}
+	digest.Pending = pending
+	digests[takerID] = digest
+	gameData.Profiles[takerID].Resources = nil
+}
+
+// handDeltas returns the change of the hand totals made by a transaction,
+// by player ID.
+func handDeltas(trxArgs tfcPb.GameContractTrxArgs) (map[int32]int32, error) {
+	deltas := make(map[int32]int32)
+	switch trxArgs.Type {
+	case tfcPb.GameTrxType_JOIN:
+		if trxArgs.JoinTrxPayload == nil {
+			return nil, fmt.Errorf("missing join payload")
+		}
+		deltas[engine.GetPlayerId(trxArgs.JoinTrxPayload.Player)] += handCount(engine.InitPlayerProfile().Resources)
+	case tfcPb.GameTrxType_TRADE:
+		payload := trxArgs.TradeTrxPayload
+		if payload == nil {
+			return nil, fmt.Errorf("missing trade payload")
+		}
+		deltas[engine.GetPlayerId(payload.Source)] -= payload.Amount
+		deltas[engine.GetPlayerId(payload.Dest)] += payload.Amount
+	case tfcPb.GameTrxType_DEV:
+		builder, err := buildPlayer(trxArgs.BuildTrxPayload)
+		if err != nil {
+			return nil, err
+		}
+		if builder != engine.Spectator {
+			deltas[engine.GetPlayerId(builder)] -= handCount(engine.BuildCost(trxArgs.BuildTrxPayload.Type))
+		}
+	}
+	return deltas, nil
+}
+
+// AssertHandTotals checks the hand totals moved by a transaction. It only
+// needs the hand digests of the public state before and after the
+// transaction, and the transaction arguments, so any peer or client can
+// check it without access to the private hands.
+func AssertHandTotals(pre, post map[int32]HandDigest, trxArgs tfcPb.GameContractTrxArgs) error {
+	deltas, err := handDeltas(trxArgs)
+	if err != nil {
+		return err
+	}
+
+	players := make(map[int32]bool)
+	for _, digests := range []map[int32]HandDigest{pre, post} {
+		for pID := range digests {
+			players[pID] = true
+		}
+	}
+	for pID := range deltas {
+		players[pID] = true
+	}
+
+	for pID := range players {
+		expected := pre[pID].Total() + deltas[pID]
+		if post[pID].Total() != expected {
+			return fmt.Errorf("unexpected hand total for %v: expected %v, got %v",
+				tfcPb.Player(pID), expected, post[pID].Total())
+		}
+	}
+	return nil
+}
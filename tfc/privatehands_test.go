@@ -0,0 +1,225 @@
+package tfc
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+// testHandSalt is the hand salt sent by the clients of the tests.
+var testHandSalt = []byte("the secret salt of a hand")
+
+// saltedStub adds the hand salt to the transient data, which the mock
+// stub does not implement.
+type saltedStub struct {
+	shim.ChaincodeStubInterface
+}
+
+func (ss saltedStub) GetTransient() (map[string][]byte, error) {
+	return map[string][]byte{HAND_SALT_KEY: testHandSalt}, nil
+}
+
+func TestHandsArePrivate(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).joinRGB(playerSignedProposals).getError()
+	require.NoError(t, err)
+
+	publicData, err := getLedgerData(stub)
+	require.NoError(t, err)
+	for pID, profile := range publicData.Profiles {
+		require.Empty(t, profile.Resources,
+			"expected the hand of %v to be removed from the public state", pID)
+	}
+
+	digests, err := getHandDigests(stub)
+	require.NoError(t, err)
+	require.Len(t, digests, 3)
+
+	for _, p := range []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE} {
+		jsonData, err := stub.GetPrivateData(HandCollection(p), CONTRACT_STATE_KEY)
+		require.NoError(t, err)
+
+		hand := PrivateHand{}
+		require.NoError(t, json.Unmarshal(jsonData, &hand))
+
+		digest, _, err := newHandDigest(hand)
+		require.NoError(t, err)
+		require.Equal(t, digests[engine.GetPlayerId(p)], digest)
+		require.EqualValues(t, 30, digest.Count)
+
+		// The salt stays private, so the hand cannot be guessed from its hash
+		require.Equal(t, testHandSalt, hand.Salt)
+		unsalted, err := json.Marshal(PrivateHand{Resources: hand.Resources})
+		require.NoError(t, err)
+		hash := sha256.Sum256(unsalted)
+		require.NotEqual(t, hash[:], digest.Hash)
+	}
+	require.NotContains(t, string(stub.State[HAND_DIGESTS_KEY]), string(testHandSalt))
+}
+
+func TestJoinRequiresHandSalt(t *testing.T) {
+	stub := shim.NewMockStub("mockGameContract", &MockContract{noSalt: true})
+	r := stub.MockInit("01010101", [][]byte{})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	_, err := NewArgsBuilder().
+		WithJoinArgs(tfcPb.Player_RED).
+		invokeSignedMock(stub, playerSignedProposals[tfcPb.Player_RED])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "hand salt")
+}
+
+func TestTamperedHandIsRejected(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	hand := PrivateHand{Resources: map[int32]int32{engine.GetResourceId(tfcPb.Resource_HILL): 100}}
+	jsonData, err := json.Marshal(hand)
+	require.NoError(t, err)
+	stub.PvtState[HandCollection(tfcPb.Player_RED)][CONTRACT_STATE_KEY] = jsonData
+
+	_, err = NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_BLUE, tfcPb.Resource_HILL, 50).
+		invokeSignedMock(stub, playerSignedProposals[tfcPb.Player_RED])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not match the public hash")
+}
+
+func TestTradeWithoutTakerHand(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	// Model a peer of the red org, outside of the blue org
+	blueCollection := HandCollection(tfcPb.Player_BLUE)
+	blueHand := stub.PvtState[blueCollection]
+	delete(stub.PvtState, blueCollection)
+
+	_, err = NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_BLUE, tfcPb.Resource_HILL, 2).
+		invokeSignedMock(stub, playerSignedProposals[tfcPb.Player_RED])
+	require.NoError(t, err)
+
+	hillID := engine.GetResourceId(tfcPb.Resource_HILL)
+	digests, err := getHandDigests(stub)
+	require.NoError(t, err)
+	blueDigest := digests[engine.GetPlayerId(tfcPb.Player_BLUE)]
+	require.EqualValues(t, 30, blueDigest.Count)
+	require.Equal(t, map[int32]int32{hillID: 2}, blueDigest.Pending)
+	require.EqualValues(t, 28, digests[engine.GetPlayerId(tfcPb.Player_RED)].Count)
+
+	// Taking resources from blue needs the blue hand
+	_, err = NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_BLUE, tfcPb.Resource_HILL, -1).
+		invokeSignedMock(stub, playerSignedProposals[tfcPb.Player_RED])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not available on this peer")
+
+	// Blue's own peers add the credit to the hand on its next trade
+	stub.PvtState[blueCollection] = blueHand
+	err = newSI(stub).
+		next(tfcPb.Player_RED).next(tfcPb.Player_RED).
+		roll(tfcPb.Player_GREEN).next(tfcPb.Player_GREEN).next(tfcPb.Player_GREEN).
+		roll(tfcPb.Player_BLUE).
+		getError()
+	require.NoError(t, err)
+
+	_, err = NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_BLUE, tfcPb.Player_GREEN, tfcPb.Resource_HILL, 1).
+		invokeSignedMock(stub, playerSignedProposals[tfcPb.Player_BLUE])
+	require.NoError(t, err)
+
+	gameData, err := getGameData(stub)
+	require.NoError(t, err)
+	require.EqualValues(t, 6, gameData.Profiles[engine.GetPlayerId(tfcPb.Player_BLUE)].Resources[hillID])
+
+	digests, err = getHandDigests(stub)
+	require.NoError(t, err)
+	require.Empty(t, digests[engine.GetPlayerId(tfcPb.Player_BLUE)].Pending)
+	require.EqualValues(t, 31, digests[engine.GetPlayerId(tfcPb.Player_BLUE)].Total())
+}
+
+func TestMissingPayloadsAreRejected(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	for _, trxArgs := range []tfcPb.GameContractTrxArgs{
+		{Type: tfcPb.GameTrxType_TRADE},
+		{Type: tfcPb.GameTrxType_DEV},
+		{Type: tfcPb.GameTrxType_DEV, BuildTrxPayload: &tfcPb.BuildTrxPayload{Type: tfcPb.BuildType_ROAD}},
+		{Type: tfcPb.GameTrxType_DEV, BuildTrxPayload: &tfcPb.BuildTrxPayload{Type: tfcPb.BuildType_SETTLE}},
+	} {
+		protoArgs, err := proto.Marshal(&trxArgs)
+		require.NoError(t, err)
+
+		resp := stub.MockInvokeWithSignedProposal("missing",
+			[][]byte{[]byte("invoke"), protoArgs}, playerSignedProposals[tfcPb.Player_RED])
+		require.EqualValues(t, shim.ERROR, resp.Status)
+		require.Contains(t, resp.Message, "missing")
+
+		require.Error(t, AssertHandTotals(nil, nil, trxArgs))
+	}
+}
+
+func TestHandTotalsFromPublicState(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	// Only the public state is copied, as seen by a peer of no player org
+	publicDigests := func() map[int32]HandDigest {
+		public := shim.NewMockStub("public", nil)
+		for key, value := range stub.State {
+			public.State[key] = value
+		}
+		digests, err := getHandDigests(public)
+		require.NoError(t, err)
+		return digests
+	}
+
+	trade := NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_BLUE, tfcPb.Resource_HILL, 2)
+	pre := publicDigests()
+	_, err = trade.invokeSignedMock(stub, playerSignedProposals[tfcPb.Player_RED])
+	require.NoError(t, err)
+	post := publicDigests()
+
+	require.NoError(t, AssertHandTotals(pre, post, *trade.Args()))
+
+	redID, blueID := engine.GetPlayerId(tfcPb.Player_RED), engine.GetPlayerId(tfcPb.Player_BLUE)
+	tampered := map[int32]HandDigest{}
+	for pID, digest := range post {
+		tampered[pID] = digest
+	}
+	tampered[blueID] = HandDigest{Count: post[blueID].Count}
+	require.Error(t, AssertHandTotals(pre, tampered, *trade.Args()))
+
+	tampered[blueID] = post[blueID]
+	tampered[redID] = HandDigest{Count: pre[redID].Count}
+	require.Error(t, AssertHandTotals(pre, tampered, *trade.Args()))
+}
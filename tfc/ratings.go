@@ -0,0 +1,78 @@
+package tfc
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/ratings"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// recordRatings rates the game once it has been won.
+func recordRatings(APIstub shim.ChaincodeStubInterface, gameData tfcPb.GameData) error {
+	idMap, err := getIdentityMap(APIstub)
+	if err != nil {
+		return err
+	}
+
+	standings, err := finalStandings(gameData, idMap)
+	if err != nil {
+		return err
+	}
+	return ratings.Record(APIstub, standings)
+}
+
+// finalStandings ranks the winner first, and the other players by their
+// winning points. Players with as many points tie.
+func finalStandings(gameData tfcPb.GameData, idMap map[int32][]byte) (ratings.Standings, error) {
+	winner, won := engine.Winner(gameData.State)
+	if !won {
+		return nil, fmt.Errorf("the game is not over, it is in state %v", gameData.State)
+	}
+
+	identity := func(p tfcPb.Player) (string, error) {
+		sign, ok := idMap[engine.GetPlayerId(p)]
+		if !ok {
+			return "", fmt.Errorf("player <%v> has no identity", p)
+		}
+		return string(sign), nil
+	}
+
+	winnerID, err := identity(winner)
+	if err != nil {
+		return nil, err
+	}
+	standings := ratings.Standings{{winnerID}}
+
+	// Rank the others by points, players are in a fixed order so that
+	// every endorser ranks the same way
+	others := []tfcPb.Player{}
+	for _, p := range engine.Players {
+		if p == winner {
+			continue
+		}
+		if _, ok := gameData.Profiles[engine.GetPlayerId(p)]; ok {
+			others = append(others, p)
+		}
+	}
+	points := func(p tfcPb.Player) int32 {
+		return gameData.Profiles[engine.GetPlayerId(p)].WinningPoints
+	}
+	if len(others) == 2 && points(others[1]) > points(others[0]) {
+		others[0], others[1] = others[1], others[0]
+	}
+
+	for i, p := range others {
+		pID, err := identity(p)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && points(p) == points(others[i-1]) {
+			standings[len(standings)-1] = append(standings[len(standings)-1], pID)
+			continue
+		}
+		standings = append(standings, []string{pID})
+	}
+	return standings, nil
+}
@@ -0,0 +1,71 @@
+package tfc
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/ratings"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinalStandings(t *testing.T) {
+	idMap := map[int32][]byte{
+		engine.GetPlayerId(tfcPb.Player_RED):   []byte("r"),
+		engine.GetPlayerId(tfcPb.Player_GREEN): []byte("g"),
+		engine.GetPlayerId(tfcPb.Player_BLUE):  []byte("b"),
+	}
+	gameData := func(state tfcPb.GameState, r, g, b int32) tfcPb.GameData {
+		return tfcPb.GameData{
+			State: state,
+			Profiles: map[int32]*tfcPb.PlayerProfile{
+				engine.GetPlayerId(tfcPb.Player_RED):   {WinningPoints: r},
+				engine.GetPlayerId(tfcPb.Player_GREEN): {WinningPoints: g},
+				engine.GetPlayerId(tfcPb.Player_BLUE):  {WinningPoints: b},
+			},
+		}
+	}
+
+	standings, err := finalStandings(gameData(tfcPb.GameState_GWON, 3, 11, 5), idMap)
+	require.NoError(t, err)
+	require.Equal(t, ratings.Standings{{"g"}, {"b"}, {"r"}}, standings)
+
+	standings, err = finalStandings(gameData(tfcPb.GameState_BWON, 4, 4, 12), idMap)
+	require.NoError(t, err)
+	require.Equal(t, ratings.Standings{{"b"}, {"r", "g"}}, standings)
+
+	_, err = finalStandings(gameData(tfcPb.GameState_RTRADE, 4, 4, 12), idMap)
+	require.Error(t, err)
+}
+
+func TestRecordRatings(t *testing.T) {
+	stub := initContract(t, "ratings")
+	ledger := ratings.NewMockLedger(stub, "tfc")
+	err := newSI(stub).joinRGB(playerSignedProposals).getError()
+	require.NoError(t, err)
+
+	gameData, err := getGameData(stub)
+	require.NoError(t, err)
+	gameData.State = tfcPb.GameState_RWON
+	gameData.Profiles[engine.GetPlayerId(tfcPb.Player_RED)].WinningPoints = engine.WINNING_POINTS
+
+	stub.MockTransactionStart("won")
+	require.NoError(t, recordRatings(stub, *gameData))
+	stub.MockTransactionEnd("won")
+
+	board, err := ratings.Leaderboard(ledger, 0)
+	require.NoError(t, err)
+	require.Len(t, board, 3)
+
+	// The game answers the leaderboard query from the shared ratings
+	r := stub.MockInvoke("board", [][]byte{[]byte(ratings.LEADERBOARD_FCN)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	require.JSONEq(t, string(ledger.MockInvoke("board", [][]byte{[]byte(ratings.LEADERBOARD_FCN)}).Payload),
+		string(r.Payload))
+
+	idMap, err := getIdentityMap(stub)
+	require.NoError(t, err)
+	require.Equal(t, string(idMap[engine.GetPlayerId(tfcPb.Player_RED)]), board[0].Player)
+	require.True(t, board[0].Rating > ratings.INITIAL_RATING)
+}
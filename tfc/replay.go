@@ -0,0 +1,85 @@
+package tfc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// GameSeed derives the seed of the game board from the game ID.
+func GameSeed(gameID string) int64 {
+	return int64(crc32.ChecksumIEEE([]byte(gameID)))
+}
+
+// StateHash hashes the public part of the game data. The hands are left out,
+// since they are kept in the private collections.
+func StateHash(gameData tfcPb.GameData) ([]byte, error) {
+	publicData := proto.Clone(&gameData).(*tfcPb.GameData)
+	for _, profile := range publicData.Profiles {
+		profile.Resources = nil
+	}
+
+	// The json encoding sorts the map keys, unlike the proto encoding.
+	jsonData, err := json.Marshal(publicData)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal game data: %s", err)
+	}
+
+	hash := sha256.Sum256(jsonData)
+	return hash[:], nil
+}
+
+// Replay rebuilds the game data from the board seed and the move log.
+// Each move must lead to the state and state hash recorded with it.
+func Replay(seed int64, moves []MoveRecord) (*tfcPb.GameData, error) {
+	gameData, err := engine.NewGameData(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, move := range moves {
+		if move.Seq != uint32(i) {
+			return nil, fmt.Errorf("unexpected move sequence: expected %v, got %v", i, move.Seq)
+		}
+
+		newGameData, err := replayMove(*gameData, move)
+		if err != nil {
+			return nil, fmt.Errorf("could not replay move %v: %s", move.Seq, err)
+		}
+
+		stateHash, err := StateHash(newGameData)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(stateHash, move.StateHash) {
+			return nil, fmt.Errorf("replayed state of move %v does not match the recorded hash", move.Seq)
+		}
+		if gameData.State != move.PrevState || newGameData.State != move.State {
+			return nil, fmt.Errorf("replayed move %v goes from %v to %v, not from %v to %v as recorded",
+				move.Seq, gameData.State, newGameData.State, move.PrevState, move.State)
+		}
+
+		gameData = &newGameData
+	}
+	return gameData, nil
+}
+
+func replayMove(gameData tfcPb.GameData, move MoveRecord) (tfcPb.GameData, error) {
+	if move.Settlement != nil {
+		newGameData, _, err := engine.Settle(gameData, *move.Settlement)
+		return newGameData, err
+	}
+
+	trxArgs, err := move.TrxArgs()
+	if err != nil {
+		return gameData, err
+	}
+	newGameData, _, err := engine.Apply(gameData, move.Player, *trxArgs)
+	return newGameData, err
+}
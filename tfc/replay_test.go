@@ -0,0 +1,161 @@
+package tfc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveLog(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	moves := queryMoves(t, stub)
+	require.Len(t, moves, 4)
+
+	for i, move := range moves {
+		require.EqualValues(t, i, move.Seq)
+		require.NotEmpty(t, move.TxID)
+		require.NotEmpty(t, move.StateHash)
+	}
+
+	lastMove := moves[3]
+	require.Equal(t, tfcPb.Player_RED, lastMove.Player)
+	require.Equal(t, tfcPb.GameState_RROLL, lastMove.PrevState)
+	require.Equal(t, tfcPb.GameState_RTRADE, lastMove.State)
+
+	trxArgs, err := lastMove.TrxArgs()
+	require.NoError(t, err)
+	require.Equal(t, tfcPb.GameTrxType_ROLL, trxArgs.Type)
+}
+
+func TestMoveLogRounds(t *testing.T) {
+	stub := initContract(t, "01010101")
+	si := newSI(stub).joinRGB(playerSignedProposals)
+	for round := 0; round < 2; round++ {
+		for _, p := range []tfcPb.Player{tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE} {
+			si = si.roll(p).next(p).next(p)
+		}
+	}
+	require.NoError(t, si.getError())
+
+	// The round ends as blue passes the turn on to red
+	moves := queryMoves(t, stub)
+	require.Len(t, moves, 3+2*9)
+	round := uint32(0)
+	for _, move := range moves {
+		if move.PrevState == tfcPb.GameState_BDEV && move.State == tfcPb.GameState_RROLL {
+			round++
+		}
+		require.Equal(t, round, move.Round, "round of move %v", move.Seq)
+	}
+	require.EqualValues(t, 2, moves[len(moves)-1].Round)
+
+	// A new game starts from the first round
+	r := stub.MockInit("02020202", [][]byte{})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	err := newSI(stub).joinRGB(playerSignedProposals).roll(tfcPb.Player_RED).getError()
+	require.NoError(t, err)
+	for _, move := range queryMoves(t, stub) {
+		require.Zero(t, move.Round, "round of move %v", move.Seq)
+	}
+}
+
+func TestMoveLogOfNewGame(t *testing.T) {
+	stub := initContract(t, "01010101")
+	err := newSI(stub).joinRGB(playerSignedProposals).roll(tfcPb.Player_RED).getError()
+	require.NoError(t, err)
+
+	// Re-initializing starts a new game, with its own move log
+	cUUID := "02020202"
+	r := stub.MockInit(cUUID, [][]byte{})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	require.Empty(t, queryMoves(t, stub))
+
+	err = newSI(stub).joinRGB(playerSignedProposals).roll(tfcPb.Player_RED).getError()
+	require.NoError(t, err)
+
+	moves := queryMoves(t, stub)
+	require.Len(t, moves, 4)
+	require.Zero(t, moves[0].Seq)
+	_, err = Replay(GameSeed(cUUID), moves)
+	require.NoError(t, err)
+}
+
+func TestReplay(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+
+	for _, ss := range scriptTFC() {
+		_, err := ss.ab.invokeSignedMock(stub, playerSignedProposals[ss.p])
+		require.NoError(t, err)
+	}
+
+	moves := queryMoves(t, stub)
+	replayed, err := Replay(GameSeed(cUUID), moves)
+	require.NoError(t, err)
+
+	gameData, err := getGameData(stub)
+	require.NoError(t, err)
+	require.Equal(t, gameData.State, replayed.State)
+
+	expectedHash, err := StateHash(*gameData)
+	require.NoError(t, err)
+	actualHash, err := StateHash(*replayed)
+	require.NoError(t, err)
+	require.Equal(t, expectedHash, actualHash)
+
+	for pID := range gameData.Profiles {
+		require.Equal(t, heldResources(t, stub, tfcPb.Player(pID)), replayed.Profiles[pID].Resources,
+			"unexpected resources for %v after replay", tfcPb.Player(pID))
+	}
+}
+
+func TestReplayDetectsTamperedLog(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	moves := queryMoves(t, stub)
+	// Claim that red skipped the roll
+	nextArgs, err := NewArgsBuilder().WithNextArgs().Build()
+	require.NoError(t, err)
+	tampered := append([]MoveRecord{}, moves...)
+	tampered[3].Args = nextArgs[0]
+	_, err = Replay(GameSeed(cUUID), tampered)
+	require.Error(t, err)
+
+	// Keep the legal roll, but claim another outcome
+	tampered = append([]MoveRecord{}, moves...)
+	tampered[3].StateHash = moves[2].StateHash
+	_, err = Replay(GameSeed(cUUID), tampered)
+	require.EqualError(t, err, "replayed state of move 3 does not match the recorded hash")
+
+	tampered = append([]MoveRecord{}, moves...)
+	tampered[3].State = tfcPb.GameState_RDEV
+	_, err = Replay(GameSeed(cUUID), tampered)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not from RROLL to RDEV as recorded")
+}
+
+func queryMoves(t *testing.T, stub *shim.MockStub) []MoveRecord {
+	resp := stub.MockInvoke("moves", [][]byte{[]byte(MOVES_FCN)})
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+
+	moves := []MoveRecord{}
+	err := json.Unmarshal(resp.Payload, &moves)
+	require.NoError(t, err)
+	return moves
+}
@@ -0,0 +1,127 @@
+package tfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+)
+
+// SETTLE_FCN is the function name used to settle a finished alliance on
+// the game. It takes the alliance collection and the alliance contract ID
+// as arguments. Each alliance is settled at most once, and only in the
+// game it was formed in.
+const SETTLE_FCN = "settle"
+
+// ALLIANCE_CHAINCODE is the name of the alliance chaincode, which must
+// run on the same channel as the game.
+const ALLIANCE_CHAINCODE = "alliance"
+
+// ALLIANCE_SETTLEMENT_FCN is the alliance query returning the settlement
+// of a finished alliance. It takes the same arguments as SETTLE_FCN.
+const ALLIANCE_SETTLEMENT_FCN = "settlement"
+
+// SETTLED_INDEX is the object type of the settled alliance composite keys.
+// Settled alliances are keyed by game ID, alliance collection and alliance
+// contract ID, as contract IDs are only unique within a collection.
+const SETTLED_INDEX = "tfc.settled"
+
+// HandleSettle asks the alliance chaincode for the settlement of the
+// alliance, which it only gives once the alliance is over, and applies
+// it to the game.
+func HandleSettle(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	if len(args) != 3 {
+		return shim.Error("expected the alliance collection and contract ID")
+	}
+	collection := string(args[1])
+	allianceID, err := strconv.ParseUint(string(args[2]), 10, 32)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("invalid alliance contract ID <%s>: %s", args[2], err))
+	}
+
+	gameID, err := getGameID(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	settledKey, err := settledKey(APIstub, gameID, collection, uint32(allianceID))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	settled, err := APIstub.GetState(settledKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not get the settlement of alliance %v: %s", allianceID, err))
+	}
+	if settled != nil {
+		return shim.Error(fmt.Sprintf("alliance %v was already settled", allianceID))
+	}
+
+	resp := APIstub.InvokeChaincode(ALLIANCE_CHAINCODE,
+		[][]byte{[]byte(ALLIANCE_SETTLEMENT_FCN), args[1], args[2]}, "")
+	if resp.Status != shim.OK {
+		return shim.Error(fmt.Sprintf("could not get the settlement of alliance %v from %v: %s",
+			allianceID, collection, resp.Message))
+	}
+
+	settlement := engine.Settlement{}
+	err = json.Unmarshal(resp.Payload, &settlement)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not unmarshal the settlement of alliance %v: %s", allianceID, err))
+	}
+	if settlement.AllianceID != uint32(allianceID) {
+		return shim.Error(fmt.Sprintf("expected the settlement of alliance %v, got %v",
+			allianceID, settlement.AllianceID))
+	}
+	if settlement.GameID != gameID {
+		return shim.Error(fmt.Sprintf("alliance %v was formed in game <%s>, not in this game <%s>",
+			allianceID, settlement.GameID, gameID))
+	}
+
+	// Only winning points change, so the private hands are left alone
+	gameData, err := getLedgerData(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	prevState := gameData.State
+
+	newGameData, events, err := engine.Settle(*gameData, settlement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, event := range events {
+		log.Printf("Game event: %+v", event)
+	}
+
+	protoData, err := proto.Marshal(&newGameData)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal game data: %s", err))
+	}
+	APIstub.PutState(CONTRACT_STATE_KEY, protoData)
+
+	err = appendSettlement(APIstub, settlement, prevState, newGameData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = APIstub.PutState(settledKey, []byte{0x00})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not save the settlement of alliance %v: %s", allianceID, err))
+	}
+	return shim.Success(protoData)
+}
+
+func settledKey(APIstub shim.ChaincodeStubInterface, gameID, collection string,
+	allianceID uint32) (string, error) {
+
+	key, err := APIstub.CreateCompositeKey(SETTLED_INDEX,
+		[]string{gameID, collection, strconv.FormatUint(uint64(allianceID), 10)})
+	if err != nil {
+		return "", fmt.Errorf("could not create the settlement key of alliance %v: %s", allianceID, err)
+	}
+	return key, nil
+}
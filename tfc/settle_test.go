@@ -0,0 +1,126 @@
+package tfc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+// allianceSettlements stands in for the alliance chaincode, answering the
+// settlement query of the finished alliances.
+type allianceSettlements map[string]engine.Settlement
+
+func (as allianceSettlements) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (as allianceSettlements) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	settlement, ok := as[string(args[2])]
+	if string(args[0]) != ALLIANCE_SETTLEMENT_FCN || !ok {
+		return shim.Error("alliance is not over")
+	}
+
+	jsonData, err := json.Marshal(settlement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonData)
+}
+
+func settle(stub *shim.MockStub, allianceID string) pb.Response {
+	return settleIn(stub, "alliances", allianceID)
+}
+
+func settleIn(stub *shim.MockStub, collection, allianceID string) pb.Response {
+	return stub.MockInvoke("settle"+collection+allianceID,
+		[][]byte{[]byte(SETTLE_FCN), []byte(collection), []byte(allianceID)})
+}
+
+func TestSettleAlliance(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	red, green := engine.GetPlayerId(tfcPb.Player_RED), engine.GetPlayerId(tfcPb.Player_GREEN)
+
+	settlements := allianceSettlements{
+		"7": {AllianceID: 7, GameID: cUUID, Points: map[int32]int32{red: 2, green: -1}},
+		"8": {AllianceID: 9, GameID: cUUID, Points: map[int32]int32{red: 2}},
+	}
+	stub.MockPeerChaincode(ALLIANCE_CHAINCODE, shim.NewMockStub(ALLIANCE_CHAINCODE, settlements))
+
+	// Nothing to settle before the game starts
+	resp := settle(stub, "7")
+	require.EqualValues(t, shim.ERROR, resp.Status)
+
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	resp = settle(stub, "7")
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+
+	gameData, err := getGameData(stub)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, gameData.Profiles[red].WinningPoints)
+	require.Zero(t, gameData.Profiles[green].WinningPoints)
+
+	// Settled once, unknown or mismatching alliances are rejected
+	for _, allianceID := range []string{"7", "8", "10", "x"} {
+		resp = settle(stub, allianceID)
+		require.EqualValues(t, shim.ERROR, resp.Status, allianceID)
+	}
+
+	moves := queryMoves(t, stub)
+	require.Len(t, moves, 5)
+	require.Equal(t, settlements["7"], *moves[4].Settlement)
+	require.Equal(t, tfcPb.GameState_RTRADE, moves[4].State)
+
+	err = newSI(stub).next(tfcPb.Player_RED).getError()
+	require.NoError(t, err)
+
+	replayed, err := Replay(GameSeed(cUUID), queryMoves(t, stub))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, replayed.Profiles[red].WinningPoints)
+}
+
+func TestSettleAllianceOfGame(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	red := engine.GetPlayerId(tfcPb.Player_RED)
+
+	settlements := allianceSettlements{
+		"7": {AllianceID: 7, GameID: cUUID, Points: map[int32]int32{red: 1}},
+		"8": {AllianceID: 8, GameID: "02020202", Points: map[int32]int32{red: 1}},
+	}
+	stub.MockPeerChaincode(ALLIANCE_CHAINCODE, shim.NewMockStub(ALLIANCE_CHAINCODE, settlements))
+
+	err := newSI(stub).
+		joinRGB(playerSignedProposals).
+		roll(tfcPb.Player_RED).
+		getError()
+	require.NoError(t, err)
+
+	// Alliances formed in another game are not settled in this one
+	resp := settle(stub, "8")
+	require.EqualValues(t, shim.ERROR, resp.Status)
+	require.Contains(t, resp.Message, "02020202")
+
+	// Contract IDs are only unique within a collection
+	resp = settleIn(stub, "RG", "7")
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+	resp = settleIn(stub, "RB", "7")
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+	resp = settleIn(stub, "RG", "7")
+	require.EqualValues(t, shim.ERROR, resp.Status)
+
+	gameData, err := getGameData(stub)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, gameData.Profiles[red].WinningPoints)
+}
@@ -0,0 +1,98 @@
+package tfc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+// VIEW_FCN is the function name used to query the caller's view of the game.
+const VIEW_FCN = "view"
+
+// ProfileView is the part of a player profile visible to a viewer.
+// Resources are only filled in for the viewer's own profile,
+// everyone else only sees the number of resource cards.
+type ProfileView struct {
+	Resources     map[int32]int32 `json:"resources,omitempty"`
+	ResourceCount int32           `json:"resourceCount"`
+	WinningPoints int32           `json:"winningPoints"`
+	Settlements   int32           `json:"settlements"`
+	Roads         int32           `json:"roads"`
+}
+
+// GameView is the redacted game data returned to a viewer.
+type GameView struct {
+	Viewer   tfcPb.Player           `json:"viewer"`
+	State    tfcPb.GameState        `json:"state"`
+	Board    *tfcPb.GameBoard       `json:"board"`
+	Profiles map[int32]*ProfileView `json:"profiles"`
+}
+
+// HandleView returns the game as seen by the transaction creator.
+// Callers which are not in the identity map get the spectator view.
+func HandleView(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameData, err := getGameData(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	digests, err := getHandDigests(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creatorSign, err := getCreatorSign(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	viewer, err := getCreator(APIstub, creatorSign)
+	if err != nil {
+		viewer = engine.Spectator
+	}
+
+	view := RedactGameData(*gameData, digests, viewer)
+	jsonData, err := json.Marshal(view)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("could not marshal game view: %s", err))
+	}
+	return shim.Success(jsonData)
+}
+
+// RedactGameData builds the view of the game for the given viewer.
+// All redaction rules live here, so any hidden information added to
+// the game data must be stripped in this function. Resource counts are
+// taken from the public hand digests, and include the pending credits.
+func RedactGameData(gameData tfcPb.GameData, digests map[int32]HandDigest, viewer tfcPb.Player) GameView {
+	profiles := make(map[int32]*ProfileView)
+	for pID, profile := range gameData.Profiles {
+		pView := &ProfileView{
+			ResourceCount: digests[pID].Total(),
+			WinningPoints: profile.WinningPoints,
+			Settlements:   profile.Settlements,
+			Roads:         profile.Roads,
+		}
+
+		if viewer != engine.Spectator && pID == engine.GetPlayerId(viewer) {
+			pView.Resources = make(map[int32]int32)
+			for rID, amount := range profile.Resources {
+				pView.Resources[rID] = amount
+			}
+			for rID, amount := range digests[pID].Pending {
+				pView.Resources[rID] += amount
+			}
+		}
+		profiles[pID] = pView
+	}
+
+	return GameView{
+		Viewer:   viewer,
+		State:    gameData.State,
+		Board:    gameData.Board,
+		Profiles: profiles,
+	}
+}
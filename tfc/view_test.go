@@ -0,0 +1,65 @@
+package tfc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/tfc/engine"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+var spectatorProposal = &pb.SignedProposal{ProposalBytes: []byte{}, Signature: []byte("spectator")}
+
+func TestPlayerView(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).joinRGB(playerSignedProposals).getError()
+	require.NoError(t, err)
+
+	view := queryView(t, stub, playerSignedProposals[tfcPb.Player_RED])
+	require.Equal(t, tfcPb.Player_RED, view.Viewer)
+	require.Len(t, view.Profiles, 3)
+
+	redView := view.Profiles[engine.GetPlayerId(tfcPb.Player_RED)]
+	require.NotEmpty(t, redView.Resources,
+		"expected player to see their own resources")
+
+	for _, p := range []tfcPb.Player{tfcPb.Player_GREEN, tfcPb.Player_BLUE} {
+		pView := view.Profiles[engine.GetPlayerId(p)]
+		require.Empty(t, pView.Resources,
+			"expected resources of %v to be hidden", p)
+		require.EqualValues(t, 30, pView.ResourceCount,
+			"expected resource count of %v to be visible", p)
+	}
+}
+
+func TestSpectatorView(t *testing.T) {
+	cUUID := "01010101"
+	stub := initContract(t, cUUID)
+	err := newSI(stub).joinRGB(playerSignedProposals).getError()
+	require.NoError(t, err)
+
+	view := queryView(t, stub, spectatorProposal)
+	require.Equal(t, engine.Spectator, view.Viewer)
+	require.Equal(t, tfcPb.GameState_RROLL, view.State)
+	require.NotNil(t, view.Board)
+
+	for pID, pView := range view.Profiles {
+		require.Empty(t, pView.Resources,
+			"expected resources of %v to be hidden from spectators", pID)
+		require.EqualValues(t, 30, pView.ResourceCount)
+	}
+}
+
+func queryView(t *testing.T, stub *shim.MockStub, sp *pb.SignedProposal) GameView {
+	resp := stub.MockInvokeWithSignedProposal("view", [][]byte{[]byte(VIEW_FCN)}, sp)
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+
+	view := GameView{}
+	err := json.Unmarshal(resp.Payload, &view)
+	require.NoError(t, err)
+	return view
+}
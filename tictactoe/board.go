@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+// Board is the geometry of an m,n,k game: K marks in a row on a
+// Rows x Cols board win. The positions of the contract are stored
+// row by row.
+type Board struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+	K    int `json:"k"`
+}
+
+// defaultBoard is classic tic-tac-toe.
+var defaultBoard = Board{Rows: 3, Cols: 3, K: 3}
+
+func (b Board) size() int {
+	return b.Rows * b.Cols
+}
+
+// MAX_BOARD_DIM bounds the rows and the columns of a board, as the
+// positions of every game are kept in its contract state.
+const MAX_BOARD_DIM = 20
+
+func (b Board) validate() error {
+	if b.Rows < 1 || b.Cols < 1 || b.Rows > MAX_BOARD_DIM || b.Cols > MAX_BOARD_DIM {
+		return fmt.Errorf("Invalid board dimensions %dx%d, the maximum is %dx%d",
+			b.Rows, b.Cols, MAX_BOARD_DIM, MAX_BOARD_DIM)
+	}
+	if b.K < 1 || (b.K > b.Rows && b.K > b.Cols) {
+		return fmt.Errorf("Invalid k < %d > for a %dx%d board", b.K, b.Rows, b.Cols)
+	}
+	return nil
+}
+
+// The directions a line can run in: along the row, along the column,
+// and the two diagonals. The opposite directions are scanned as well.
+var lineDirections = [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// winsAt checks if the mark at the position completes K in a row.
+// Only the lines through the last move can have been completed by it,
+// so there is no need to scan the whole board.
+func (b Board) winsAt(positions []tttPb.Mark, position int) bool {
+	m := positions[position]
+	if m == tttPb.Mark_E {
+		return false
+	}
+
+	row, col := position/b.Cols, position%b.Cols
+	for _, d := range lineDirections {
+		count := 1 + b.countFrom(positions, m, row, col, d[0], d[1]) +
+			b.countFrom(positions, m, row, col, -d[0], -d[1])
+		if count >= b.K {
+			return true
+		}
+	}
+	return false
+}
+
+// countFrom counts the consecutive marks m after (row, col), going in
+// the direction (dr, dc).
+func (b Board) countFrom(positions []tttPb.Mark, m tttPb.Mark, row, col, dr, dc int) int {
+	count := 0
+	for r, c := row+dr, col+dc; r >= 0 && r < b.Rows && c >= 0 && c < b.Cols; r, c = r+dr, c+dc {
+		if positions[r*b.Cols+c] != m {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+var defaultInitArgs = tttPb.InitTrxArgs{Player1Mark: tttPb.Mark_X, Player2Mark: tttPb.Mark_O}
+
+// parseInitArgs reads the init arguments: the InitTrxArgs, followed by
+// the rows, columns and k of the board. All of them are optional, the
+// contract defaults to classic tic-tac-toe with player1 playing X.
+func parseInitArgs(args [][]byte) (tttPb.InitTrxArgs, Board, error) {
+	initArgs := defaultInitArgs
+	board := defaultBoard
+
+	if len(args) > 0 && len(args[0]) > 0 {
+		initArgs = tttPb.InitTrxArgs{}
+		if err := proto.Unmarshal(args[0], &initArgs); err != nil {
+			return initArgs, board, fmt.Errorf("Could not parse init args. Error %s", err.Error())
+		}
+	}
+
+	if initArgs.Player1Mark == initArgs.Player2Mark ||
+		initArgs.Player1Mark == tttPb.Mark_E || initArgs.Player2Mark == tttPb.Mark_E {
+		return initArgs, board, fmt.Errorf("Invalid player marks < %v > and < %v >",
+			initArgs.Player1Mark, initArgs.Player2Mark)
+	}
+
+	switch len(args) {
+	case 0, 1:
+		return initArgs, board, nil
+	case 4:
+	default:
+		return initArgs, board, fmt.Errorf(
+			"Expected the board rows, columns and k after the init args, got %d args", len(args)-1)
+	}
+
+	dims := make([]int, 3)
+	for i := range dims {
+		d, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return initArgs, board, fmt.Errorf("Invalid board dimension < %s >", args[i+1])
+		}
+		dims[i] = d
+	}
+	board = Board{Rows: dims[0], Cols: dims[1], K: dims[2]}
+	return initArgs, board, board.validate()
+}
+
+func getLedgerBoard(APIstub shim.ChaincodeStubInterface, gameID string) (Board, error) {
+	key, err := gameKey(APIstub, BOARD_INDEX, gameID)
+	if err != nil {
+		return Board{}, err
+	}
+
+	boardBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return Board{}, fmt.Errorf("Could not get the board from state. Error: %s", err.Error())
+	}
+	if boardBytes == nil {
+		return Board{}, fmt.Errorf("Unknown game < %s >", gameID)
+	}
+
+	board := Board{}
+	if err = json.Unmarshal(boardBytes, &board); err != nil {
+		return Board{}, fmt.Errorf("Could not unmarshal the board. Error: %s", err.Error())
+	}
+	return board, nil
+}
+
+func putLedgerBoard(APIstub shim.ChaincodeStubInterface, gameID string, board Board) error {
+	boardBytes, err := json.Marshal(board)
+	if err != nil {
+		return fmt.Errorf("Could not marshal the board. Error: %s", err.Error())
+	}
+
+	key, err := gameKey(APIstub, BOARD_INDEX, gameID)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, boardBytes)
+}
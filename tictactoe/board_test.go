@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/ratings"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+func initBoardContract(t *testing.T, initArgs tttPb.InitTrxArgs, dims ...int) *shim.MockStub {
+	stub := shim.NewMockStub("mockGameContract", new(GameContract))
+	ratings.NewMockLedger(stub, "tictactoe")
+	protoArgs, err := proto.Marshal(&initArgs)
+	require.NoError(t, err)
+
+	args := [][]byte{protoArgs}
+	for _, d := range dims {
+		args = append(args, []byte(strconv.Itoa(d)))
+	}
+	r := stub.MockInit(testGameID, args)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	for _, m := range []tttPb.Mark{initArgs.Player1Mark, initArgs.Player2Mark} {
+		r = joinAs(stub, m)
+		require.EqualValues(t, shim.OK, r.Status, r.Message)
+	}
+	return stub
+}
+
+var xFirst = tttPb.InitTrxArgs{Player1Mark: X, Player2Mark: O}
+
+func TestInitBoard(t *testing.T) {
+	stub := initBoardContract(t, xFirst, 4, 5, 3)
+
+	board, err := getLedgerBoard(stub, testGameID)
+	require.NoError(t, err)
+	require.Equal(t, Board{Rows: 4, Cols: 5, K: 3}, board)
+
+	contract, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+	require.Len(t, contract.Positions, 20)
+	require.Equal(t, tttPb.TttContract_XTURN, contract.State)
+}
+
+func TestInitPlayerMarks(t *testing.T) {
+	player1 := &pb.SignedProposal{Signature: []byte("player1")}
+	player2 := &pb.SignedProposal{Signature: []byte("player2")}
+	player1ID := fmt.Sprintf("%d", crc32.ChecksumIEEE(player1.Signature))
+	player2ID := fmt.Sprintf("%d", crc32.ChecksumIEEE(player2.Signature))
+
+	for _, initArgs := range []tttPb.InitTrxArgs{xFirst, {Player1Mark: O, Player2Mark: X}} {
+		stub := initUnjoinedContract(t, initArgs)
+		for i, sp := range []*pb.SignedProposal{player1, player2} {
+			r := stub.MockInvokeWithSignedProposal(strconv.Itoa(i),
+				[][]byte{[]byte(JOIN_FCN), []byte(testGameID)}, sp)
+			require.EqualValues(t, shim.OK, r.Status, r.Message)
+		}
+
+		contract, err := getLedgerContract(stub, testGameID)
+		require.NoError(t, err)
+		require.Equal(t, player1ID, *playerOf(contract, initArgs.Player1Mark), "%v", initArgs)
+		require.Equal(t, player2ID, *playerOf(contract, initArgs.Player2Mark), "%v", initArgs)
+
+		board, err := getLedgerBoard(stub, testGameID)
+		require.NoError(t, err)
+		require.Equal(t, defaultBoard, board)
+	}
+}
+
+func TestInitInvalidArgs(t *testing.T) {
+	sameMarks, err := proto.Marshal(&tttPb.InitTrxArgs{Player1Mark: O, Player2Mark: O})
+	require.NoError(t, err)
+	xo, err := proto.Marshal(&xFirst)
+	require.NoError(t, err)
+
+	for _, args := range [][][]byte{
+		{sameMarks},
+		{xo, []byte("3"), []byte("3")},
+		{xo, []byte("3"), []byte("3"), []byte("4")},
+		{xo, []byte("0"), []byte("3"), []byte("1")},
+		{xo, []byte("3"), []byte("three"), []byte("3")},
+		{xo, []byte("100000"), []byte("100000"), []byte("3")},
+		{xo, []byte("3"), []byte("21"), []byte("3")},
+	} {
+		stub := shim.NewMockStub("mockGameContract", new(GameContract))
+		r := stub.MockInit(testGameID, args)
+		require.EqualValues(t, shim.ERROR, r.Status, "expected init to fail for %q", args)
+	}
+}
+
+func TestWinsAtLongLines(t *testing.T) {
+	gomoku := Board{Rows: 15, Cols: 15, K: 5}
+	positions := make([]tttPb.Mark, gomoku.size())
+	for i := range positions {
+		positions[i] = E
+	}
+
+	// An anti-diagonal through (2, 10) .. (6, 6), completed in the middle
+	for i := 0; i < 5; i++ {
+		positions[(2+i)*15+10-i] = X
+	}
+	require.True(t, gomoku.winsAt(positions, 4*15+8))
+
+	positions[6*15+6] = O
+	require.False(t, gomoku.winsAt(positions, 4*15+8), "expected four in a row not to win")
+
+	// Lines do not wrap around the edge of the board
+	edge := []tttPb.Mark{
+		E, E, E, X,
+		X, X, E, E,
+		E, E, E, E,
+		E, E, E, E}
+	require.False(t, Board{Rows: 4, Cols: 4, K: 3}.winsAt(edge, 4))
+}
+
+func TestGameScript4x4K3(t *testing.T) {
+	stub := initBoardContract(t, xFirst, 4, 4, 3)
+	script := []tttPb.MoveTrxPayload{
+		{Position: 5, Mark: X},
+		{Position: 0, Mark: O},
+		{Position: 10, Mark: X},
+		{Position: 3, Mark: O},
+		{Position: 15, Mark: X},
+	}
+	_, err := runScriptAndCheckLastState(script, tttPb.TttContract_XWON, stub)
+	require.NoError(t, err)
+}
+
+// On a board too small for k in a row, every game is a tie.
+func TestGameScriptTieWithoutLines(t *testing.T) {
+	stub := initBoardContract(t, xFirst, 2, 3, 3)
+	script := []tttPb.MoveTrxPayload{
+		{Position: 0, Mark: X},
+		{Position: 3, Mark: O},
+		{Position: 1, Mark: X},
+		{Position: 4, Mark: O},
+		{Position: 5, Mark: X},
+		{Position: 2, Mark: O},
+	}
+	_, err := runScriptAndCheckLastState(script, tttPb.TttContract_TIE, stub)
+	require.NoError(t, err)
+}
+
+func TestContractAgreesWithSolver4x4(t *testing.T) {
+	board := Board{Rows: 4, Cols: 4, K: 3}
+	stub := initBoardContract(t, xFirst, 4, 4, 3)
+
+	// X opens in the center, and may win from there
+	script := []tttPb.MoveTrxPayload{
+		{Position: 5, Mark: X},
+		{Position: 0, Mark: O},
+		{Position: 6, Mark: X},
+		{Position: 4, Mark: O},
+	}
+	_, err := runScript(script, stub)
+	require.NoError(t, err)
+
+	contract, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+	for i := 0; !contractTerminated(*contract); i++ {
+		h, err := solveHint(board, *contract)
+		require.NoError(t, err)
+		_, err = newMoveArgsBuilder("solve"+strconv.Itoa(i), h.Position, h.Mark).invoke(stub)
+		require.NoError(t, err)
+
+		contract, err = getLedgerContract(stub, testGameID)
+		require.NoError(t, err)
+		winner, won := lineWinner(board, contract.Positions)
+		require.Equal(t, won, contractTerminated(*contract) && contract.State != tttPb.TttContract_TIE,
+			"board %v", contract.Positions)
+		if won {
+			require.Equal(t, tttPb.TttContract_XWON, contract.State)
+			require.Equal(t, X, winner)
+		}
+	}
+	require.Equal(t, tttPb.TttContract_XWON, contract.State)
+}
+
+func TestLargeBoardHintsAreSearched(t *testing.T) {
+	stub := initBoardContract(t, xFirst, 15, 15, 5)
+	r := stub.MockInvoke("hint", [][]byte{[]byte(HINT_FCN), []byte(testGameID)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	h := Hint{}
+	require.NoError(t, json.Unmarshal(r.Payload, &h))
+	require.Equal(t, UNKNOWN, h.Outcome, "expected the solver not to take on large boards")
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/ratings"
 	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
 )
 
@@ -31,20 +32,12 @@ import (
 type GameContract struct {
 }
 
-const CONTRACT_STATE_KEY = "contract.tictactoe"
-const BOARD_SIZE = 9
-
+// Init creates the first game of the contract, with the ID of the
+// init transaction.
 func (gc *GameContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
-	positions := make([]tttPb.Mark, BOARD_SIZE)
-	for i := 0; i < BOARD_SIZE; i++ {
-		positions[i] = tttPb.Mark_E
-	}
-
-	tttContract := &tttPb.TttContract{
-		State:     tttPb.TttContract_XTURN,
-		Positions: positions,
-		XPlayer:   "player1",
-		OPlayer:   "player2",
+	tttContract, err := createGame(APIstub, APIstub.GetTxID(), APIstub.GetArgs())
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	tttState, err := proto.Marshal(tttContract)
@@ -52,7 +45,6 @@ func (gc *GameContract) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
 		errMsg := fmt.Sprintf("Could not marshal the contract. Error: %s", err.Error())
 		return shim.Error(errMsg)
 	}
-	APIstub.PutState(CONTRACT_STATE_KEY, tttState)
 	return shim.Success(tttState)
 }
 
@@ -63,7 +55,7 @@ func (gc *GameContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response
 	// }
 
 	// The first argument is the function name!
-	// Second will be our protobuf payload.
+	// Second will be our protobuf payload, and third the game ID.
 
 	invokeST := time.Now()
 	defer func() {
@@ -71,10 +63,35 @@ func (gc *GameContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response
 		log.Printf("#############\n\t FINISHED INVOKE FUNCTION IN < %v > seconds", invokeDuration)
 	}()
 
+	switch string(APIstub.GetArgs()[0]) {
+	case CREATE_FCN:
+		return create(APIstub)
+	case GAMES_FCN:
+		return games(APIstub)
+	case HINT_FCN:
+		return hint(APIstub)
+	case JOIN_FCN:
+		return join(APIstub)
+	case HISTORY_FCN:
+		return history(APIstub)
+	case UNDO_FCN:
+		return proposeUndo(APIstub)
+	case ACCEPT_UNDO_FCN:
+		return acceptUndo(APIstub)
+	case REMATCH_FCN:
+		return rematch(APIstub)
+	case ratings.LEADERBOARD_FCN:
+		return ratings.QueryLeaderboard(APIstub)
+	}
+
+	gameID, err := gameIDArg(APIstub, 2)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	protoTrxArgs := APIstub.GetArgs()[1]
 
 	trxArgs := &tttPb.TrxArgs{}
-	err := proto.Unmarshal(protoTrxArgs, trxArgs)
+	err = proto.Unmarshal(protoTrxArgs, trxArgs)
 	if err != nil {
 		errMsg := fmt.Sprintf("Could not parse transaction args %v. Error %s", trxArgs, err.Error())
 		return shim.Error(errMsg)
@@ -82,18 +99,23 @@ func (gc *GameContract) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response
 
 	switch trxArgs.Type {
 	case tttPb.TrxType_MOVE:
-		return move(APIstub, trxArgs.MovePayload)
+		return move(APIstub, gameID, trxArgs.MovePayload)
 	}
 
 	return shim.Error(fmt.Sprintf("Unkown transaction type < %v >", trxArgs.Type))
 }
 
-func move(APIstub shim.ChaincodeStubInterface, payload *tttPb.MoveTrxPayload) pb.Response {
+func move(APIstub shim.ChaincodeStubInterface, gameID string, payload *tttPb.MoveTrxPayload) pb.Response {
 	if payload == nil {
 		return shim.Error("Unexpected empty payload. Failed to do move.")
 	}
 
-	contract, err := getLedgerContract(APIstub)
+	contract, err := getLedgerContract(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	board, err := getLedgerBoard(APIstub, gameID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -102,24 +124,39 @@ func move(APIstub shim.ChaincodeStubInterface, payload *tttPb.MoveTrxPayload) pb
 		return shim.Error(fmt.Sprintf("Contract already terminated with state %v", contract.State))
 	}
 
-	if err = validateMoveArgs(APIstub, *contract, *payload); err != nil {
+	if err = validateMoveArgs(*contract, *payload); err != nil {
 		return shim.Error(err.Error())
 	}
 
-	newContract, err := applyMove(*contract, *payload)
+	creator, err := getCreatorSign(APIstub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	newProtoContract, err := proto.Marshal(&newContract)
-	if err != nil {
+
+	if err = assertSigner(*contract, payload.Mark, creator); err != nil {
 		return shim.Error(err.Error())
 	}
 
-	err = APIstub.PutState(CONTRACT_STATE_KEY, newProtoContract)
+	newContract, err := applyMove(board, *contract, *payload)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	newProtoContract, err := putLedgerContract(APIstub, gameID, newContract)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
+	if err = appendMove(APIstub, gameID, *contract, creator, *payload); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if contractTerminated(newContract) {
+		err = ratings.Record(APIstub, finalStandings(newContract))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
 	return shim.Success(newProtoContract)
 }
 
@@ -132,7 +169,7 @@ func contractTerminated(contract tttPb.TttContract) bool {
 		fmt.Sprintf("%v", contract.State))
 }
 
-var positionRegexp = regexp.MustCompile(fmt.Sprintf("^[0-8]%v$", tttPb.Mark_E))
+var positionRegexp = regexp.MustCompile(fmt.Sprintf("^[0-9]+%v$", tttPb.Mark_E))
 
 func positionValidationString(position int32, mark tttPb.Mark) string {
 	return fmt.Sprintf("%d%v", position, mark)
@@ -147,7 +184,11 @@ func turnValidationString(mark tttPb.Mark, state tttPb.TttContract_State) string
 	return fmt.Sprintf("%v%v", mark, state)
 }
 
-func validateMoveArgs(APIstub shim.ChaincodeStubInterface, contract tttPb.TttContract, payload tttPb.MoveTrxPayload) error {
+func validateMoveArgs(contract tttPb.TttContract, payload tttPb.MoveTrxPayload) error {
+	if payload.Position < 0 || int(payload.Position) >= len(contract.Positions) {
+		return fmt.Errorf("Invalid position < %d >", payload.Position)
+	}
+
 	pvs := positionValidationString(payload.Position,
 		contract.Positions[payload.Position])
 	if !positionRegexp.MatchString(pvs) {
@@ -163,25 +204,13 @@ func validateMoveArgs(APIstub shim.ChaincodeStubInterface, contract tttPb.TttCon
 	return nil
 }
 
-func getLedgerContract(APIstub shim.ChaincodeStubInterface) (*tttPb.TttContract, error) {
-	contractBytes, err := APIstub.GetState(CONTRACT_STATE_KEY)
-	if err != nil {
-		return nil, fmt.Errorf("Could not get the contract from state. Error: %s", err.Error())
-	}
-
-	actualContract := &tttPb.TttContract{}
-	err = proto.Unmarshal(contractBytes, actualContract)
-	if err != nil {
-		return nil, fmt.Errorf("Could not unmarshal the proto contract. Error: %s", err.Error())
-	}
-	return actualContract, nil
-}
-
-func applyMove(contract tttPb.TttContract, payload tttPb.MoveTrxPayload) (tttPb.TttContract, error) {
-	newPositions := contract.Positions
+func applyMove(board Board, contract tttPb.TttContract, payload tttPb.MoveTrxPayload) (tttPb.TttContract, error) {
+	// Copy the positions, so that the old contract stays as it was
+	newPositions := make([]tttPb.Mark, len(contract.Positions))
+	copy(newPositions, contract.Positions)
 	newPositions[payload.Position] = payload.Mark
 
-	nextState, err := computeNextState(newPositions, contract.State)
+	nextState, err := computeNextState(board, newPositions, contract.State, int(payload.Position))
 	if err != nil {
 		return tttPb.TttContract{}, err
 	}
@@ -194,25 +223,28 @@ func applyMove(contract tttPb.TttContract, payload tttPb.MoveTrxPayload) (tttPb.
 	}, nil
 }
 
-func computeNextState(positions []tttPb.Mark, state tttPb.TttContract_State) (tttPb.TttContract_State, error) {
-	posString, err := winValidationString(positions)
-	if err != nil {
-		return state, err
+func computeNextState(board Board, positions []tttPb.Mark, state tttPb.TttContract_State,
+	lastPosition int) (tttPb.TttContract_State, error) {
+
+	if len(positions) != board.size() {
+		return state, fmt.Errorf(
+			"Invalid number of positions detected. Expected %d, got %d",
+			board.size(), len(positions))
 	}
 
 	switch state {
 	case tttPb.TttContract_XTURN:
-		if won(tttPb.Mark_X, posString) {
+		if board.winsAt(positions, lastPosition) {
 			return tttPb.TttContract_XWON, nil
-		} else if boardFull(posString) {
+		} else if boardFull(positions) {
 			return tttPb.TttContract_TIE, nil
 		} else {
 			return tttPb.TttContract_OTURN, nil
 		}
 	case tttPb.TttContract_OTURN:
-		if won(tttPb.Mark_O, posString) {
+		if board.winsAt(positions, lastPosition) {
 			return tttPb.TttContract_OWON, nil
-		} else if boardFull(posString) {
+		} else if boardFull(positions) {
 			return tttPb.TttContract_TIE, nil
 		} else {
 			return tttPb.TttContract_XTURN, nil
@@ -222,49 +254,24 @@ func computeNextState(positions []tttPb.Mark, state tttPb.TttContract_State) (tt
 	}
 }
 
-func winValidationString(positions []tttPb.Mark) (string, error) {
-	if len(positions) != BOARD_SIZE {
-		return "", fmt.Errorf(
-			"Invalid number of positions detected. Expected %d, got %d",
-			BOARD_SIZE, len(positions))
+// finalStandings ranks the players of a terminated contract for the ratings.
+func finalStandings(contract tttPb.TttContract) ratings.Standings {
+	switch contract.State {
+	case tttPb.TttContract_XWON:
+		return ratings.Standings{{contract.XPlayer}, {contract.OPlayer}}
+	case tttPb.TttContract_OWON:
+		return ratings.Standings{{contract.OPlayer}, {contract.XPlayer}}
 	}
-
-	result := ""
-	for i := 0; i < BOARD_SIZE; i++ {
-		result += positions[i].String()
-	}
-	return result, nil
-}
-
-func won(m tttPb.Mark, positions string) bool {
-	return threeInRowRegex(m).MatchString(positions) ||
-		threeInColRegex(m).MatchString(positions) ||
-		threeInDiagRegex(m).MatchString(positions)
-}
-
-func threeInRowRegex(m tttPb.Mark) *regexp.Regexp {
-	return regexp.MustCompile(
-		fmt.Sprintf("(^|...)(%s%s%s)(...|$)",
-			m.String(), m.String(), m.String()))
-}
-
-func threeInColRegex(m tttPb.Mark) *regexp.Regexp {
-	return regexp.MustCompile(
-		fmt.Sprintf("^(((%s..){3})|((.%s.){3})|((..%s){3}))$",
-			m.String(), m.String(), m.String()))
-}
-
-func threeInDiagRegex(m tttPb.Mark) *regexp.Regexp {
-	return regexp.MustCompile(
-		fmt.Sprintf("^(%s...%s...%s|..%s.%s.%s..)$",
-			m.String(), m.String(), m.String(),
-			m.String(), m.String(), m.String()))
+	return ratings.Standings{{contract.XPlayer, contract.OPlayer}}
 }
 
-var anyEmptyRegex = regexp.MustCompile(fmt.Sprintf("^.*%s.*$", tttPb.Mark_E.String()))
-
-func boardFull(positions string) bool {
-	return !anyEmptyRegex.MatchString(positions)
+func boardFull(positions []tttPb.Mark) bool {
+	for _, m := range positions {
+		if m == tttPb.Mark_E {
+			return false
+		}
+	}
+	return true
 }
 
 // The main function is only relevant in unit test mode. Only included here for completeness.
@@ -16,9 +16,9 @@ package main
 
 import (
 	"fmt"
+	"hash/crc32"
 	"math/rand"
 	"strconv"
-	"strings"
 	"testing"
 	"time"
 
@@ -28,22 +28,48 @@ import (
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/ratings"
 	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
 )
 
+// testGameID is the ID of the game created by Init, which is the ID of
+// the init transaction.
+const testGameID = "001"
+
 func initContract(t *testing.T) *shim.MockStub {
 	stub := shim.NewMockStub("mockGameContract", new(GameContract))
 	if stub == nil {
 		t.Fatalf("Failed to init mock")
 	}
-	r := stub.MockInit("001", [][]byte{})
+	ratings.NewMockLedger(stub, "tictactoe")
+	r := stub.MockInit(testGameID, [][]byte{})
 
 	if r.GetStatus() != shim.OK {
 		t.Fatalf("Could not init the contract. Error: %s", r.Message)
 	}
+
+	for _, m := range []tttPb.Mark{tttPb.Mark_X, tttPb.Mark_O} {
+		r = joinAs(stub, m)
+		if r.GetStatus() != shim.OK {
+			t.Fatalf("Could not join the contract. Error: %s", r.Message)
+		}
+	}
 	return stub
 }
 
+// markProposal signs the transactions of the player who plays the mark.
+func markProposal(m tttPb.Mark) *pb.SignedProposal {
+	return &pb.SignedProposal{ProposalBytes: []byte{}, Signature: []byte("player" + m.String())}
+}
+
+func markIdentity(m tttPb.Mark) string {
+	return fmt.Sprintf("%d", crc32.ChecksumIEEE(markProposal(m).Signature))
+}
+
+func joinAs(stub *shim.MockStub, m tttPb.Mark) pb.Response {
+	return stub.MockInvokeWithSignedProposal("join"+m.String(), [][]byte{[]byte(JOIN_FCN), []byte(testGameID)}, markProposal(m))
+}
+
 func TestInit(t *testing.T) {
 	stub := initContract(t)
 
@@ -55,11 +81,11 @@ func TestInit(t *testing.T) {
 	expectedContract := tttPb.TttContract{
 		Positions: expectedMarks,
 		State:     tttPb.TttContract_XTURN,
-		XPlayer:   "player1",
-		OPlayer:   "player2",
+		XPlayer:   markIdentity(tttPb.Mark_X),
+		OPlayer:   markIdentity(tttPb.Mark_O),
 	}
 
-	actualContract, err := getLedgerContract(stub)
+	actualContract, err := getLedgerContract(stub, testGameID)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -87,6 +113,11 @@ func contractsEqual(c1, c2 tttPb.TttContract) (bool, string) {
 		}
 	}
 
+	if c1.XPlayer != c2.XPlayer || c1.OPlayer != c2.OPlayer {
+		return false, fmt.Sprintf("Contract players do not match. C1: < %v %v >, C2: < %v %v >",
+			c1.XPlayer, c1.OPlayer, c2.XPlayer, c2.OPlayer)
+	}
+
 	return true, ""
 }
 
@@ -106,7 +137,7 @@ func TestInvokeMove(t *testing.T) {
 		t.FailNow()
 	}
 
-	actualContract, err := getLedgerContract(stub)
+	actualContract, err := getLedgerContract(stub, testGameID)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -139,7 +170,7 @@ func TestInvokeMoveOnOccupiedPos(t *testing.T) {
 		t.Fatalf("Did not expect invocation to be successful! position <%d> was taken!", positionID)
 	}
 
-	actualContract, err := getLedgerContract(stub)
+	actualContract, err := getLedgerContract(stub, testGameID)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -154,7 +185,7 @@ func TestInvokeMoveWrongMark(t *testing.T) {
 	stub := initContract(t)
 	position := int32(1)
 
-	actualContract, err := getLedgerContract(stub)
+	actualContract, err := getLedgerContract(stub, testGameID)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -173,7 +204,7 @@ func TestInvokeMoveWrongMark(t *testing.T) {
 		t.Fatalf("Did not expect invocation to be successful. Turn was < %v >  and mark < %v >", actualContract.State, mark)
 	}
 
-	actualContract, err = getLedgerContract(stub)
+	actualContract, err = getLedgerContract(stub, testGameID)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -184,37 +215,17 @@ func TestInvokeMoveWrongMark(t *testing.T) {
 	}
 }
 
-func TestWinRegexpFunctions(t *testing.T) {
-
-	positions := []string{
-		tttPb.Mark_X.String(), tttPb.Mark_O.String(), tttPb.Mark_X.String(),
-		tttPb.Mark_X.String(), tttPb.Mark_X.String(), tttPb.Mark_X.String(),
-		tttPb.Mark_O.String(), tttPb.Mark_O.String(), tttPb.Mark_X.String()}
-	posString := strings.Join(positions, "")
-
-	if !matchAll(tttPb.Mark_X, posString) {
-		t.Fatalf("Expected X to match on all dimensions.")
-	}
-
-	if matchAny(tttPb.Mark_O, posString) {
-		t.Fatalf("Expected O to not match any dimensions.")
-	}
-}
-
-func matchAll(m tttPb.Mark, posString string) bool {
-	tr := threeInRowRegex(m).MatchString(posString)
-	tc := threeInColRegex(m).MatchString(posString)
-	td := threeInDiagRegex(m).MatchString(posString)
-
-	return tr && tc && td
-}
-
-func matchAny(m tttPb.Mark, posString string) bool {
-	tr := threeInRowRegex(m).MatchString(posString)
-	tc := threeInColRegex(m).MatchString(posString)
-	td := threeInDiagRegex(m).MatchString(posString)
-
-	return tr || tc || td
+func TestWinsAt(t *testing.T) {
+	positions := []tttPb.Mark{
+		tttPb.Mark_X, tttPb.Mark_O, tttPb.Mark_X,
+		tttPb.Mark_X, tttPb.Mark_X, tttPb.Mark_X,
+		tttPb.Mark_O, tttPb.Mark_O, tttPb.Mark_X}
+
+	// The center completes the middle row and both diagonals
+	require.True(t, defaultBoard.winsAt(positions, 4))
+	require.True(t, defaultBoard.winsAt(positions, 8))
+	require.False(t, defaultBoard.winsAt(positions, 6), "expected O to have no line")
+	require.False(t, defaultBoard.winsAt(positions, 1), "expected O to have no line")
 }
 
 func TestGameScriptWinX(t *testing.T) {
@@ -372,7 +383,7 @@ func TestContractRandomConsistency(t *testing.T) {
 	t.Logf("Running script %v \n", script)
 	runScript(script, stub)
 
-	contract, err := getLedgerContract(stub)
+	contract, err := getLedgerContract(stub, testGameID)
 	require.NoError(t, err)
 
 	if contract.State == tttPb.TttContract_XTURN ||
@@ -386,7 +397,7 @@ func TestContractRandomConsistency(t *testing.T) {
 	for r := 0; r < 1000; r = r + 1 {
 		miniStub := initContract(t)
 		runScript(script, miniStub)
-		tempC, err := getLedgerContract(miniStub)
+		tempC, err := getLedgerContract(miniStub, testGameID)
 		require.NoError(t, err)
 		require.True(t, tempC.State == expectedState,
 			"Unexpected state for the contract %v. Expected %v.", tempC, expectedState)
@@ -395,14 +406,14 @@ func TestContractRandomConsistency(t *testing.T) {
 
 func generateRandomScript() []tttPb.MoveTrxPayload {
 	rand.Seed(time.Now().UnixNano())
-	script := make([]tttPb.MoveTrxPayload, BOARD_SIZE)
-	positions := make([]int, BOARD_SIZE)
-	for i := 0; i < BOARD_SIZE; i++ {
+	script := make([]tttPb.MoveTrxPayload, defaultBoard.size())
+	positions := make([]int, defaultBoard.size())
+	for i := 0; i < defaultBoard.size(); i++ {
 		positions[i] = i
 	}
 
 	nm := tttPb.Mark_X
-	for i := 0; i < BOARD_SIZE; i++ {
+	for i := 0; i < defaultBoard.size(); i++ {
 
 		np := rand.Intn(len(positions))
 		script[i] = tttPb.MoveTrxPayload{Position: int32(positions[np]), Mark: nm}
@@ -465,6 +476,7 @@ func (tArgsB *trxArgsBuilder) invoke(stub *shim.MockStub) (pb.Response, error) {
 	if err != nil {
 		return pb.Response{}, fmt.Errorf("Error creating invoke args. %s", err.Error())
 	}
-	r := stub.MockInvoke(tArgsB.uuid, [][]byte{[]byte("foo"), invokeArgs})
+	r := stub.MockInvokeWithSignedProposal(tArgsB.uuid, [][]byte{[]byte("foo"), invokeArgs, []byte(testGameID)},
+		markProposal(tArgsB.trxArgs.MovePayload.Mark))
 	return r, nil
 }
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+// CREATE_FCN creates a new game on the contract. It takes the same args
+// as Init, and returns the ID of the game.
+const CREATE_FCN = "create"
+
+// GAMES_FCN lists the games with the status given as second argument.
+const GAMES_FCN = "games"
+
+// The game state is keyed by the ID of the game, which is the ID of the
+// transaction that created it.
+const (
+	GAME_INDEX      = "tictactoe.game"
+	BOARD_INDEX     = "tictactoe.board"
+	INIT_ARGS_INDEX = "tictactoe.init"
+	// STATUS_INDEX keys the game IDs by status first, so the games with
+	// a status can be listed with a partial key.
+	STATUS_INDEX = "tictactoe.status"
+)
+
+const (
+	OPEN_STATUS     = "OPEN"
+	FINISHED_STATUS = "FINISHED"
+)
+
+// GameSummary is a game, as listed by the games query.
+type GameSummary struct {
+	ID      string                  `json:"id"`
+	State   tttPb.TttContract_State `json:"state"`
+	XPlayer string                  `json:"xPlayer"`
+	OPlayer string                  `json:"oPlayer"`
+	Board   Board                   `json:"board"`
+	Links   GameLinks               `json:"links"`
+}
+
+func create(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID := APIstub.GetTxID()
+	_, err := createGame(APIstub, gameID, APIstub.GetArgs()[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(gameID))
+}
+
+func createGame(APIstub shim.ChaincodeStubInterface, gameID string, args [][]byte) (*tttPb.TttContract, error) {
+	initArgs, board, err := parseInitArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// The players are bound to their marks as they join
+	return newGame(APIstub, gameID, initArgs, board, tttPb.TttContract{})
+}
+
+// newGame saves a game with an empty board, and the players of the
+// given contract.
+func newGame(APIstub shim.ChaincodeStubInterface, gameID string, initArgs tttPb.InitTrxArgs,
+	board Board, players tttPb.TttContract) (*tttPb.TttContract, error) {
+
+	key, err := gameKey(APIstub, GAME_INDEX, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if existing, err := APIstub.GetState(key); err != nil || existing != nil {
+		return nil, fmt.Errorf("Could not create game < %s >, it already exists", gameID)
+	}
+
+	positions := make([]tttPb.Mark, board.size())
+	for i := range positions {
+		positions[i] = tttPb.Mark_E
+	}
+
+	tttContract := &tttPb.TttContract{
+		State:     tttPb.TttContract_XTURN,
+		Positions: positions,
+		XPlayer:   players.XPlayer,
+		OPlayer:   players.OPlayer,
+	}
+
+	if err = putLedgerBoard(APIstub, gameID, board); err != nil {
+		return nil, err
+	}
+
+	if err = putLedgerInitArgs(APIstub, gameID, initArgs); err != nil {
+		return nil, err
+	}
+
+	if _, err = putLedgerContract(APIstub, gameID, *tttContract); err != nil {
+		return nil, err
+	}
+	return tttContract, nil
+}
+
+func games(APIstub shim.ChaincodeStubInterface) pb.Response {
+	args := APIstub.GetArgs()
+	if len(args) < 2 {
+		return shim.Error(fmt.Sprintf("Expected a status, one of %v or %v", OPEN_STATUS, FINISHED_STATUS))
+	}
+
+	summaries, err := listGames(APIstub, string(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(summaries)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Could not marshal the games. Error: %s", err.Error()))
+	}
+	return shim.Success(jsonData)
+}
+
+func listGames(APIstub shim.ChaincodeStubInterface, status string) ([]GameSummary, error) {
+	if status != OPEN_STATUS && status != FINISHED_STATUS {
+		return nil, fmt.Errorf("Unknown game status < %s >", status)
+	}
+
+	iter, err := APIstub.GetStateByPartialCompositeKey(STATUS_INDEX, []string{status})
+	if err != nil {
+		return nil, fmt.Errorf("Could not query the games. Error: %s", err.Error())
+	}
+	defer iter.Close()
+
+	summaries := []GameSummary{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("Could not iterate the games. Error: %s", err.Error())
+		}
+
+		_, attributes, err := APIstub.SplitCompositeKey(kv.Key)
+		if err != nil || len(attributes) != 2 {
+			return nil, fmt.Errorf("Invalid game status key < %s >", kv.Key)
+		}
+		gameID := attributes[1]
+
+		contract, err := getLedgerContract(APIstub, gameID)
+		if err != nil {
+			return nil, err
+		}
+		board, err := getLedgerBoard(APIstub, gameID)
+		if err != nil {
+			return nil, err
+		}
+		links, err := getGameLinks(APIstub, gameID)
+		if err != nil {
+			return nil, err
+		}
+
+		summaries = append(summaries, GameSummary{
+			ID:      gameID,
+			State:   contract.State,
+			XPlayer: contract.XPlayer,
+			OPlayer: contract.OPlayer,
+			Board:   board,
+			Links:   links,
+		})
+	}
+	return summaries, nil
+}
+
+func gameStatus(contract tttPb.TttContract) string {
+	if contractTerminated(contract) {
+		return FINISHED_STATUS
+	}
+	return OPEN_STATUS
+}
+
+// gameIDArg returns the game ID passed at the given argument position.
+func gameIDArg(APIstub shim.ChaincodeStubInterface, i int) (string, error) {
+	args := APIstub.GetArgs()
+	if len(args) <= i || len(args[i]) == 0 {
+		return "", fmt.Errorf("Missing the game ID at argument %d", i)
+	}
+	return string(args[i]), nil
+}
+
+func gameKey(APIstub shim.ChaincodeStubInterface, index string, gameID string) (string, error) {
+	key, err := APIstub.CreateCompositeKey(index, []string{gameID})
+	if err != nil {
+		return "", fmt.Errorf("Could not create the %s key of game < %s >. Error: %s", index, gameID, err.Error())
+	}
+	return key, nil
+}
+
+func getLedgerContract(APIstub shim.ChaincodeStubInterface, gameID string) (*tttPb.TttContract, error) {
+	key, err := gameKey(APIstub, GAME_INDEX, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	contractBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get the contract from state. Error: %s", err.Error())
+	}
+	if contractBytes == nil {
+		return nil, fmt.Errorf("Unknown game < %s >", gameID)
+	}
+
+	actualContract := &tttPb.TttContract{}
+	err = proto.Unmarshal(contractBytes, actualContract)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the proto contract. Error: %s", err.Error())
+	}
+	return actualContract, nil
+}
+
+// putLedgerContract saves the contract, and moves it to the status index
+// matching its state. It returns the marshalled contract.
+func putLedgerContract(APIstub shim.ChaincodeStubInterface, gameID string, contract tttPb.TttContract) ([]byte, error) {
+	protoContract, err := proto.Marshal(&contract)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal the contract. Error: %s", err.Error())
+	}
+
+	key, err := gameKey(APIstub, GAME_INDEX, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if err = APIstub.PutState(key, protoContract); err != nil {
+		return nil, err
+	}
+
+	for _, status := range []string{OPEN_STATUS, FINISHED_STATUS} {
+		statusKey, err := APIstub.CreateCompositeKey(STATUS_INDEX, []string{status, gameID})
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the status key of game < %s >. Error: %s", gameID, err.Error())
+		}
+
+		if status == gameStatus(contract) {
+			err = APIstub.PutState(statusKey, []byte{0x00})
+		} else {
+			err = APIstub.DelState(statusKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return protoContract, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/ratings"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+func createGame3x3(t *testing.T, stub *shim.MockStub, uuid string) string {
+	r := stub.MockInvoke(uuid, [][]byte{[]byte(CREATE_FCN)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	gameID := string(r.Payload)
+	require.Equal(t, uuid, gameID)
+
+	for _, m := range []tttPb.Mark{X, O} {
+		r = stub.MockInvokeWithSignedProposal(uuid+"join"+m.String(),
+			[][]byte{[]byte(JOIN_FCN), []byte(gameID)}, markProposal(m))
+		require.EqualValues(t, shim.OK, r.Status, r.Message)
+	}
+	return gameID
+}
+
+func moveIn(stub *shim.MockStub, uuid string, gameID string, position int32, mark tttPb.Mark) pb.Response {
+	args, _ := proto.Marshal(&tttPb.TrxArgs{
+		Type:        tttPb.TrxType_MOVE,
+		MovePayload: &tttPb.MoveTrxPayload{Position: position, Mark: mark},
+	})
+	return stub.MockInvokeWithSignedProposal(uuid,
+		[][]byte{[]byte("move"), args, []byte(gameID)}, markProposal(mark))
+}
+
+func listed(t *testing.T, stub *shim.MockStub, status string) []GameSummary {
+	r := stub.MockInvoke("games", [][]byte{[]byte(GAMES_FCN), []byte(status)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	summaries := []GameSummary{}
+	require.NoError(t, json.Unmarshal(r.Payload, &summaries))
+	return summaries
+}
+
+func TestGamesAreIndependent(t *testing.T) {
+	stub := initContract(t)
+	g1 := createGame3x3(t, stub, "g1")
+	g2 := createGame3x3(t, stub, "g2")
+
+	require.EqualValues(t, shim.OK, moveIn(stub, "m1", g1, 4, X).Status)
+	require.EqualValues(t, shim.OK, moveIn(stub, "m2", g2, 0, X).Status)
+
+	c1, err := getLedgerContract(stub, g1)
+	require.NoError(t, err)
+	c2, err := getLedgerContract(stub, g2)
+	require.NoError(t, err)
+	require.Equal(t, []tttPb.Mark{E, E, E, E, X, E, E, E, E}, c1.Positions)
+	require.Equal(t, []tttPb.Mark{X, E, E, E, E, E, E, E, E}, c2.Positions)
+
+	init, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+	require.Equal(t, tttPb.TttContract_XTURN, init.State)
+}
+
+func TestListGames(t *testing.T) {
+	stub := initContract(t)
+	g1 := createGame3x3(t, stub, "g1")
+
+	r := stub.MockInvoke("g2", [][]byte{[]byte(CREATE_FCN), []byte{}, []byte("4"), []byte("4"), []byte("3")})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	open := listed(t, stub, OPEN_STATUS)
+	require.Len(t, open, 3)
+	require.Empty(t, listed(t, stub, FINISHED_STATUS))
+
+	for _, s := range open {
+		if s.ID == "g2" {
+			require.Equal(t, Board{Rows: 4, Cols: 4, K: 3}, s.Board)
+			require.Empty(t, s.XPlayer, "expected nobody to have joined")
+		}
+	}
+
+	script := []tttPb.MoveTrxPayload{
+		{Position: 0, Mark: X}, {Position: 3, Mark: O}, {Position: 1, Mark: X},
+		{Position: 4, Mark: O}, {Position: 2, Mark: X}}
+	for i, m := range script {
+		r = moveIn(stub, strconv.Itoa(i), g1, m.Position, m.Mark)
+		require.EqualValues(t, shim.OK, r.Status, r.Message)
+	}
+
+	finished := listed(t, stub, FINISHED_STATUS)
+	require.Len(t, finished, 1)
+	require.Equal(t, GameSummary{
+		ID:      g1,
+		State:   tttPb.TttContract_XWON,
+		XPlayer: markIdentity(X),
+		OPlayer: markIdentity(O),
+		Board:   defaultBoard,
+	}, finished[0])
+	require.Len(t, listed(t, stub, OPEN_STATUS), 2)
+}
+
+func TestGameAddressing(t *testing.T) {
+	stub := initContract(t)
+
+	r := moveIn(stub, "1", "", 0, X)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected moves to need a game ID")
+
+	r = moveIn(stub, "2", "nogame", 0, X)
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "Unknown game")
+
+	r = stub.MockInvoke("3", [][]byte{[]byte(GAMES_FCN), []byte("PLAYING")})
+	require.EqualValues(t, shim.ERROR, r.Status)
+
+	r = stub.MockInvoke(testGameID, [][]byte{[]byte(CREATE_FCN)})
+	require.EqualValues(t, shim.ERROR, r.Status, "expected game IDs to be unique")
+}
+
+func TestFinishedGamesAreRated(t *testing.T) {
+	stub := initContract(t)
+	script := []tttPb.MoveTrxPayload{
+		{Position: 0, Mark: X}, {Position: 3, Mark: O}, {Position: 1, Mark: X},
+		{Position: 4, Mark: O}, {Position: 2, Mark: X}}
+	_, err := runScriptAndCheckLastState(script, tttPb.TttContract_XWON, stub)
+	require.NoError(t, err)
+
+	r := stub.MockInvoke("board", [][]byte{[]byte(ratings.LEADERBOARD_FCN)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	board := []ratings.Rating{}
+	require.NoError(t, json.Unmarshal(r.Payload, &board))
+
+	require.Len(t, board, 2)
+	require.Equal(t, markIdentity(X), board[0].Player)
+	require.Equal(t, markIdentity(O), board[1].Player)
+	require.True(t, board[0].Rating > board[1].Rating)
+
+	// A tie between the same players closes the gap
+	g := createGame3x3(t, stub, "tie")
+	tie := []tttPb.MoveTrxPayload{
+		{Position: 0, Mark: X}, {Position: 4, Mark: O}, {Position: 8, Mark: X},
+		{Position: 1, Mark: O}, {Position: 7, Mark: X}, {Position: 6, Mark: O},
+		{Position: 2, Mark: X}, {Position: 5, Mark: O}, {Position: 3, Mark: X}}
+	for i, m := range tie {
+		r = moveIn(stub, "tie"+strconv.Itoa(i), g, m.Position, m.Mark)
+		require.EqualValues(t, shim.OK, r.Status, r.Message)
+	}
+	contract, err := getLedgerContract(stub, g)
+	require.NoError(t, err)
+	require.Equal(t, tttPb.TttContract_TIE, contract.State)
+
+	x, _, err := ratings.GetRating(stub.Invokables[ratings.RATINGS_CHAINCODE], markIdentity(X))
+	require.NoError(t, err)
+	require.Equal(t, 2, x.Games)
+	require.True(t, x.Rating < board[0].Rating)
+}
@@ -11,6 +11,7 @@ require (
 	github.com/miekg/pkcs11 v1.0.2 // indirect
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7 // indirect
 	github.com/spf13/viper v1.3.2 // indirect
+	github.com/stefanprisca/strategy-code v0.0.0
 	github.com/stefanprisca/strategy-protobufs v0.0.0-20190505095635-b62e068f2a12
 	github.com/stretchr/testify v1.3.0
 	github.com/sykesm/zap-logfmt v0.0.2 // indirect
@@ -20,3 +21,5 @@ require (
 	google.golang.org/genproto v0.0.0-20180831171423-11092d34479b // indirect
 	google.golang.org/grpc v1.20.1 // indirect
 )
+
+replace github.com/stefanprisca/strategy-code => ../
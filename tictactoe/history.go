@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+// HISTORY_FCN returns the moves of the game given as second argument,
+// in the order they were played.
+const HISTORY_FCN = "history"
+
+// UNDO_FCN proposes to take back the last move of the game. Only the
+// player who made the move can propose it.
+const UNDO_FCN = "undo"
+
+// ACCEPT_UNDO_FCN accepts the undo proposed by the opponent. The proposal
+// is dropped once another move is played.
+const ACCEPT_UNDO_FCN = "acceptundo"
+
+// Moves are keyed by game ID and sequence number, undo proposals by game ID.
+const (
+	MOVE_INDEX = "tictactoe.move"
+	UNDO_INDEX = "tictactoe.undo"
+)
+
+// MoveRecord is a move, as kept in the history of the game.
+type MoveRecord struct {
+	Seq       int        `json:"seq"`
+	TxID      string     `json:"txID"`
+	Player    string     `json:"player"`
+	Mark      tttPb.Mark `json:"mark"`
+	Position  int32      `json:"position"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// UndoProposal asks the opponent to take back the move with the sequence
+// number. The tx ID tells the move apart from a later one with the same number.
+type UndoProposal struct {
+	Seq      int    `json:"seq"`
+	TxID     string `json:"txID"`
+	Proposer string `json:"proposer"`
+}
+
+func history(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID, err := gameIDArg(APIstub, 1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	moves, err := getMoveHistory(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(moves)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Could not marshal the history. Error: %s", err.Error()))
+	}
+	return shim.Success(jsonData)
+}
+
+// appendMove records the move. The sequence number is the number of
+// marks on the board before the move, so an undone move frees its number.
+func appendMove(APIstub shim.ChaincodeStubInterface, gameID string, contract tttPb.TttContract,
+	player string, payload tttPb.MoveTrxPayload) error {
+
+	ts, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("Could not get the transaction timestamp. Error: %s", err.Error())
+	}
+	timestamp, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return fmt.Errorf("Invalid transaction timestamp. Error: %s", err.Error())
+	}
+
+	move := MoveRecord{
+		Seq:       len(contract.Positions) - countEmpty(contract.Positions),
+		TxID:      APIstub.GetTxID(),
+		Player:    player,
+		Mark:      payload.Mark,
+		Position:  payload.Position,
+		Timestamp: timestamp,
+	}
+
+	jsonData, err := json.Marshal(move)
+	if err != nil {
+		return fmt.Errorf("Could not marshal move %d. Error: %s", move.Seq, err.Error())
+	}
+
+	key, err := moveKey(APIstub, gameID, move.Seq)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, jsonData)
+}
+
+func getMoveHistory(APIstub shim.ChaincodeStubInterface, gameID string) ([]MoveRecord, error) {
+	if _, err := getLedgerContract(APIstub, gameID); err != nil {
+		return nil, err
+	}
+
+	iter, err := APIstub.GetStateByPartialCompositeKey(MOVE_INDEX, []string{gameID})
+	if err != nil {
+		return nil, fmt.Errorf("Could not query the history. Error: %s", err.Error())
+	}
+	defer iter.Close()
+
+	moves := []MoveRecord{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, fmt.Errorf("Could not iterate the history. Error: %s", err.Error())
+		}
+
+		move := MoveRecord{}
+		if err = json.Unmarshal(kv.Value, &move); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal move %s. Error: %s", kv.Key, err.Error())
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// The sequence number is zero padded, so the keys sort in move order.
+func moveKey(APIstub shim.ChaincodeStubInterface, gameID string, seq int) (string, error) {
+	key, err := APIstub.CreateCompositeKey(MOVE_INDEX, []string{gameID, fmt.Sprintf("%05d", seq)})
+	if err != nil {
+		return "", fmt.Errorf("Could not create the key of move %d. Error: %s", seq, err.Error())
+	}
+	return key, nil
+}
+
+func proposeUndo(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID, err := gameIDArg(APIstub, 1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	last, err := undoableMove(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creator, err := getCreatorSign(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if last.Player != creator {
+		return shim.Error(fmt.Sprintf("Only the player of move %d can propose to undo it", last.Seq))
+	}
+
+	proposal := UndoProposal{Seq: last.Seq, TxID: last.TxID, Proposer: creator}
+	jsonData, err := json.Marshal(proposal)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Could not marshal the undo proposal. Error: %s", err.Error()))
+	}
+
+	key, err := gameKey(APIstub, UNDO_INDEX, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = APIstub.PutState(key, jsonData); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonData)
+}
+
+func acceptUndo(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID, err := gameIDArg(APIstub, 1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	last, err := undoableMove(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := gameKey(APIstub, UNDO_INDEX, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	proposalData, err := APIstub.GetState(key)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Could not get the undo proposal. Error: %s", err.Error()))
+	}
+	if proposalData == nil {
+		return shim.Error(fmt.Sprintf("No undo proposed in game < %s >", gameID))
+	}
+
+	proposal := UndoProposal{}
+	if err = json.Unmarshal(proposalData, &proposal); err != nil {
+		return shim.Error(fmt.Sprintf("Could not unmarshal the undo proposal. Error: %s", err.Error()))
+	}
+	if proposal.Seq != last.Seq || proposal.TxID != last.TxID {
+		return shim.Error(fmt.Sprintf("The undo of move %d is stale, the last move is %d",
+			proposal.Seq, last.Seq))
+	}
+
+	contract, err := getLedgerContract(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creator, err := getCreatorSign(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = assertSigner(*contract, opponent(last.Mark), creator); err != nil {
+		return shim.Error(fmt.Sprintf("Only the opponent can accept the undo. %s", err.Error()))
+	}
+
+	// Take the mark back, and give the turn back to its player
+	contract.Positions[last.Position] = tttPb.Mark_E
+	contract.State = tttPb.TttContract_XTURN
+	if last.Mark == tttPb.Mark_O {
+		contract.State = tttPb.TttContract_OTURN
+	}
+
+	protoContract, err := putLedgerContract(APIstub, gameID, *contract)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lastKey, err := moveKey(APIstub, gameID, last.Seq)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, k := range []string{key, lastKey} {
+		if err = APIstub.DelState(k); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(protoContract)
+}
+
+// undoableMove returns the last move of a game that is still being played.
+func undoableMove(APIstub shim.ChaincodeStubInterface, gameID string) (MoveRecord, error) {
+	contract, err := getLedgerContract(APIstub, gameID)
+	if err != nil {
+		return MoveRecord{}, err
+	}
+	if contractTerminated(*contract) {
+		return MoveRecord{}, fmt.Errorf("Contract already terminated with state %v", contract.State)
+	}
+
+	moves, err := getMoveHistory(APIstub, gameID)
+	if err != nil {
+		return MoveRecord{}, err
+	}
+	if len(moves) == 0 {
+		return MoveRecord{}, fmt.Errorf("No move to undo in game < %s >", gameID)
+	}
+	return moves[len(moves)-1], nil
+}
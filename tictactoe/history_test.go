@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+func gameCall(stub *shim.MockStub, uuid string, fcn string, gameID string, m tttPb.Mark) pb.Response {
+	return stub.MockInvokeWithSignedProposal(uuid, [][]byte{[]byte(fcn), []byte(gameID)}, markProposal(m))
+}
+
+func queryHistory(t *testing.T, stub *shim.MockStub, gameID string) []MoveRecord {
+	r := stub.MockInvoke("history", [][]byte{[]byte(HISTORY_FCN), []byte(gameID)})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	moves := []MoveRecord{}
+	require.NoError(t, json.Unmarshal(r.Payload, &moves))
+	return moves
+}
+
+func TestMoveHistory(t *testing.T) {
+	stub := initContract(t)
+	require.Empty(t, queryHistory(t, stub, testGameID))
+
+	script := []tttPb.MoveTrxPayload{
+		{Position: 4, Mark: X}, {Position: 0, Mark: O}, {Position: 8, Mark: X}}
+	_, err := runScript(script, stub)
+	require.NoError(t, err)
+
+	moves := queryHistory(t, stub, testGameID)
+	require.Len(t, moves, 3)
+	for i, m := range moves {
+		require.Equal(t, i, m.Seq)
+		require.Equal(t, script[i].Position, m.Position)
+		require.Equal(t, script[i].Mark, m.Mark)
+		require.Equal(t, markIdentity(m.Mark), m.Player)
+		require.False(t, m.Timestamp.IsZero())
+	}
+	require.NotEqual(t, moves[0].TxID, moves[1].TxID)
+}
+
+func TestUndo(t *testing.T) {
+	stub := initContract(t)
+	script := []tttPb.MoveTrxPayload{{Position: 4, Mark: X}, {Position: 0, Mark: O}}
+	_, err := runScript(script, stub)
+	require.NoError(t, err)
+
+	r := gameCall(stub, "u1", UNDO_FCN, testGameID, X)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected X not to undo the move of O")
+
+	r = gameCall(stub, "u2", UNDO_FCN, testGameID, O)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	r = gameCall(stub, "u3", ACCEPT_UNDO_FCN, testGameID, O)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected O not to accept their own undo")
+
+	r = gameCall(stub, "u4", ACCEPT_UNDO_FCN, testGameID, X)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	contract, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+	require.Equal(t, tttPb.TttContract_OTURN, contract.State)
+	require.Equal(t, E, contract.Positions[0])
+	require.Len(t, queryHistory(t, stub, testGameID), 1)
+
+	r = gameCall(stub, "u5", ACCEPT_UNDO_FCN, testGameID, X)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected the proposal to be used up")
+
+	// O plays somewhere else instead
+	r, err = newMoveArgsBuilder("m", 2, O).invoke(stub)
+	require.NoError(t, err)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	moves := queryHistory(t, stub, testGameID)
+	require.Len(t, moves, 2)
+	require.EqualValues(t, 2, moves[1].Position)
+}
+
+func TestUndoGoesStale(t *testing.T) {
+	stub := initContract(t)
+	_, err := runScript([]tttPb.MoveTrxPayload{{Position: 4, Mark: X}}, stub)
+	require.NoError(t, err)
+
+	r := gameCall(stub, "u1", UNDO_FCN, testGameID, X)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	// O plays on instead of accepting
+	r, err = newMoveArgsBuilder("m", 0, O).invoke(stub)
+	require.NoError(t, err)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	r = gameCall(stub, "u2", ACCEPT_UNDO_FCN, testGameID, O)
+	require.EqualValues(t, shim.ERROR, r.Status)
+	r = gameCall(stub, "u3", ACCEPT_UNDO_FCN, testGameID, X)
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "stale")
+}
+
+func TestNoUndoAfterTheGameEnded(t *testing.T) {
+	stub := initContract(t)
+	script := []tttPb.MoveTrxPayload{
+		{Position: 0, Mark: X}, {Position: 3, Mark: O}, {Position: 1, Mark: X},
+		{Position: 4, Mark: O}, {Position: 2, Mark: X}}
+	_, err := runScriptAndCheckLastState(script, tttPb.TttContract_XWON, stub)
+	require.NoError(t, err)
+
+	r := gameCall(stub, "u1", UNDO_FCN, testGameID, X)
+	require.EqualValues(t, shim.ERROR, r.Status)
+}
+
+func TestRematch(t *testing.T) {
+	stub := initContract(t)
+
+	r := gameCall(stub, "r0", REMATCH_FCN, testGameID, X)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected no rematch before the game ended")
+
+	script := []tttPb.MoveTrxPayload{
+		{Position: 0, Mark: X}, {Position: 3, Mark: O}, {Position: 1, Mark: X},
+		{Position: 4, Mark: O}, {Position: 2, Mark: X}}
+	_, err := runScriptAndCheckLastState(script, tttPb.TttContract_XWON, stub)
+	require.NoError(t, err)
+
+	stranger := &pb.SignedProposal{Signature: []byte("stranger")}
+	r = stub.MockInvokeWithSignedProposal("r1", [][]byte{[]byte(REMATCH_FCN), []byte(testGameID)}, stranger)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected only the players to ask for a rematch")
+
+	r = gameCall(stub, "r2", REMATCH_FCN, testGameID, O)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	rematchID := string(r.Payload)
+
+	r = gameCall(stub, "r3", REMATCH_FCN, testGameID, X)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected a single rematch per game")
+
+	// The former O player opens with X
+	contract, err := getLedgerContract(stub, rematchID)
+	require.NoError(t, err)
+	require.Equal(t, markIdentity(O), contract.XPlayer)
+	require.Equal(t, markIdentity(X), contract.OPlayer)
+	require.Equal(t, tttPb.TttContract_XTURN, contract.State)
+	require.Equal(t, countEmpty(contract.Positions), 9)
+
+	signedMove, err := newMoveArgsBuilder("m1", 4, X).marshal()
+	require.NoError(t, err)
+	r = stub.MockInvokeWithSignedProposal("m1",
+		[][]byte{[]byte("foo"), signedMove, []byte(rematchID)}, markProposal(O))
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	links, err := getGameLinks(stub, testGameID)
+	require.NoError(t, err)
+	require.Equal(t, GameLinks{Rematch: rematchID}, links)
+	links, err = getGameLinks(stub, rematchID)
+	require.NoError(t, err)
+	require.Equal(t, GameLinks{Previous: testGameID}, links)
+
+	initArgs, err := getLedgerInitArgs(stub, rematchID)
+	require.NoError(t, err)
+	require.Equal(t, O, initArgs.Player1Mark)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+// JOIN_FCN is the function name of the join transaction, which takes the
+// game ID as second argument. The first player to join plays the mark of
+// player1 from the init args, the second one the mark of player2.
+const JOIN_FCN = "join"
+
+func join(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID, err := gameIDArg(APIstub, 1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	contract, err := getLedgerContract(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if contractTerminated(*contract) {
+		return shim.Error(fmt.Sprintf("Contract already terminated with state %v", contract.State))
+	}
+
+	initArgs, err := getLedgerInitArgs(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	creator, err := getCreatorSign(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, m := range []tttPb.Mark{tttPb.Mark_X, tttPb.Mark_O} {
+		if *playerOf(contract, m) == creator {
+			return shim.Error(fmt.Sprintf("Creator already joined as < %v >", m))
+		}
+	}
+
+	mark := initArgs.Player1Mark
+	if *playerOf(contract, mark) != "" {
+		mark = initArgs.Player2Mark
+	}
+	if *playerOf(contract, mark) != "" {
+		return shim.Error("Both players already joined")
+	}
+
+	log.Printf("Joining player %v with sign %v", mark, creator)
+	*playerOf(contract, mark) = creator
+
+	protoContract, err := putLedgerContract(APIstub, gameID, *contract)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(protoContract)
+}
+
+// playerOf returns the identity field bound to the mark.
+func playerOf(contract *tttPb.TttContract, m tttPb.Mark) *string {
+	if m == tttPb.Mark_O {
+		return &contract.OPlayer
+	}
+	return &contract.XPlayer
+}
+
+// assertSigner checks that the move is signed by the player of the mark.
+func assertSigner(contract tttPb.TttContract, mark tttPb.Mark, creator string) error {
+	player := *playerOf(&contract, mark)
+	if player == "" {
+		return fmt.Errorf("No player joined for mark < %v >", mark)
+	}
+	if player != creator {
+		return fmt.Errorf("Creator < %s > cannot play mark < %v >", creator, mark)
+	}
+	return nil
+}
+
+// getCreatorSign returns the checksum of the transaction creator, which
+// identifies the players in the contract.
+func getCreatorSign(APIstub shim.ChaincodeStubInterface) (string, error) {
+	creatorSign, err := APIstub.GetCreator()
+	if err != nil {
+		return "", fmt.Errorf("Could not retrieve transaction creator. Error: %s", err.Error())
+	}
+
+	return fmt.Sprintf("%d", crc32.ChecksumIEEE(creatorSign)), nil
+}
+
+func getLedgerInitArgs(APIstub shim.ChaincodeStubInterface, gameID string) (tttPb.InitTrxArgs, error) {
+	key, err := gameKey(APIstub, INIT_ARGS_INDEX, gameID)
+	if err != nil {
+		return tttPb.InitTrxArgs{}, err
+	}
+
+	protoArgs, err := APIstub.GetState(key)
+	if err != nil {
+		return tttPb.InitTrxArgs{}, fmt.Errorf("Could not get the init args from state. Error: %s", err.Error())
+	}
+	if protoArgs == nil {
+		return tttPb.InitTrxArgs{}, fmt.Errorf("Unknown game < %s >", gameID)
+	}
+
+	initArgs := tttPb.InitTrxArgs{}
+	err = proto.Unmarshal(protoArgs, &initArgs)
+	if err != nil {
+		return initArgs, fmt.Errorf("Could not unmarshal the init args. Error: %s", err.Error())
+	}
+	return initArgs, nil
+}
+
+func putLedgerInitArgs(APIstub shim.ChaincodeStubInterface, gameID string, initArgs tttPb.InitTrxArgs) error {
+	protoArgs, err := proto.Marshal(&initArgs)
+	if err != nil {
+		return fmt.Errorf("Could not marshal the init args. Error: %s", err.Error())
+	}
+
+	key, err := gameKey(APIstub, INIT_ARGS_INDEX, gameID)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, protoArgs)
+}
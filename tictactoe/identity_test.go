@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stefanprisca/strategy-code/ratings"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+func initUnjoinedContract(t *testing.T, initArgs tttPb.InitTrxArgs) *shim.MockStub {
+	stub := shim.NewMockStub("mockGameContract", new(GameContract))
+	ratings.NewMockLedger(stub, "tictactoe")
+	protoArgs, err := proto.Marshal(&initArgs)
+	require.NoError(t, err)
+
+	r := stub.MockInit(testGameID, [][]byte{protoArgs})
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	return stub
+}
+
+func TestJoinBindsIdentities(t *testing.T) {
+	stub := initUnjoinedContract(t, xFirst)
+
+	r := joinAs(stub, X)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	contract := tttPb.TttContract{}
+	require.NoError(t, proto.Unmarshal(r.Payload, &contract))
+	require.Equal(t, markIdentity(X), contract.XPlayer)
+	require.Empty(t, contract.OPlayer)
+
+	r = joinAs(stub, O)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+	require.NoError(t, proto.Unmarshal(r.Payload, &contract))
+	require.Equal(t, markIdentity(X), contract.XPlayer)
+	require.Equal(t, markIdentity(O), contract.OPlayer)
+}
+
+func TestJoinPlayer1Mark(t *testing.T) {
+	// The first player to join plays O
+	stub := initUnjoinedContract(t, tttPb.InitTrxArgs{Player1Mark: O, Player2Mark: X})
+	sp := &pb.SignedProposal{Signature: []byte("first")}
+	r := stub.MockInvokeWithSignedProposal("1", [][]byte{[]byte(JOIN_FCN), []byte(testGameID)}, sp)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+
+	contract, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+	require.Empty(t, contract.XPlayer)
+	require.NotEmpty(t, contract.OPlayer)
+}
+
+func TestJoinRejections(t *testing.T) {
+	stub := initUnjoinedContract(t, xFirst)
+	require.EqualValues(t, shim.OK, joinAs(stub, X).Status)
+
+	r := joinAs(stub, X)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected a player not to join twice")
+
+	require.EqualValues(t, shim.OK, joinAs(stub, O).Status)
+
+	stranger := &pb.SignedProposal{Signature: []byte("stranger")}
+	r = stub.MockInvokeWithSignedProposal("3", [][]byte{[]byte(JOIN_FCN), []byte(testGameID)}, stranger)
+	require.EqualValues(t, shim.ERROR, r.Status, "expected a full game to reject joins")
+}
+
+func TestMoveBeforeJoin(t *testing.T) {
+	stub := initUnjoinedContract(t, xFirst)
+	r, err := newMoveArgsBuilder("1", 0, X).invoke(stub)
+	require.NoError(t, err)
+	require.EqualValues(t, shim.ERROR, r.Status)
+	require.Contains(t, r.Message, "No player joined")
+}
+
+func TestMoveSignedByOtherPlayer(t *testing.T) {
+	stub := initContract(t)
+
+	// O signs a move with X's mark
+	b := newMoveArgsBuilder("1", 0, X)
+	args, err := b.marshal()
+	require.NoError(t, err)
+	r := stub.MockInvokeWithSignedProposal("1", [][]byte{[]byte("foo"), args, []byte(testGameID)}, markProposal(O))
+	require.EqualValues(t, shim.ERROR, r.Status)
+
+	stranger := &pb.SignedProposal{Signature: []byte("stranger")}
+	r = stub.MockInvokeWithSignedProposal("2", [][]byte{[]byte("foo"), args, []byte(testGameID)}, stranger)
+	require.EqualValues(t, shim.ERROR, r.Status)
+
+	contract, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+	require.Equal(t, E, contract.Positions[0])
+
+	r, err = b.invoke(stub)
+	require.NoError(t, err)
+	require.EqualValues(t, shim.OK, r.Status, r.Message)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+// REMATCH_FCN starts a new game after the game given as second argument
+// has ended. The players keep their seats, with the marks swapped, so the
+// other player opens. It returns the ID of the new game.
+const REMATCH_FCN = "rematch"
+
+// LINK_INDEX keys the links between a game and its rematches.
+const LINK_INDEX = "tictactoe.link"
+
+// GameLinks chains a game to the game it is a rematch of, and to its rematch.
+type GameLinks struct {
+	Previous string `json:"previous,omitempty"`
+	Rematch  string `json:"rematch,omitempty"`
+}
+
+func rematch(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID, err := gameIDArg(APIstub, 1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	contract, err := getLedgerContract(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !contractTerminated(*contract) {
+		return shim.Error(fmt.Sprintf("Game < %s > is still being played, in state %v", gameID, contract.State))
+	}
+
+	creator, err := getCreatorSign(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if creator != contract.XPlayer && creator != contract.OPlayer {
+		return shim.Error(fmt.Sprintf("Only the players of game < %s > can ask for a rematch", gameID))
+	}
+
+	links, err := getGameLinks(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if links.Rematch != "" {
+		return shim.Error(fmt.Sprintf("Game < %s > already has the rematch < %s >", gameID, links.Rematch))
+	}
+
+	board, err := getLedgerBoard(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	initArgs, err := getLedgerInitArgs(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rematchID := APIstub.GetTxID()
+	swapped := tttPb.InitTrxArgs{Player1Mark: initArgs.Player2Mark, Player2Mark: initArgs.Player1Mark}
+	players := tttPb.TttContract{XPlayer: contract.OPlayer, OPlayer: contract.XPlayer}
+	if _, err = newGame(APIstub, rematchID, swapped, board, players); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	links.Rematch = rematchID
+	if err = putGameLinks(APIstub, gameID, links); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putGameLinks(APIstub, rematchID, GameLinks{Previous: gameID}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(rematchID))
+}
+
+func getGameLinks(APIstub shim.ChaincodeStubInterface, gameID string) (GameLinks, error) {
+	links := GameLinks{}
+	key, err := gameKey(APIstub, LINK_INDEX, gameID)
+	if err != nil {
+		return links, err
+	}
+
+	jsonData, err := APIstub.GetState(key)
+	if err != nil {
+		return links, fmt.Errorf("Could not get the links of game < %s >. Error: %s", gameID, err.Error())
+	}
+	if jsonData == nil {
+		return links, nil
+	}
+
+	if err = json.Unmarshal(jsonData, &links); err != nil {
+		return links, fmt.Errorf("Could not unmarshal the links of game < %s >. Error: %s", gameID, err.Error())
+	}
+	return links, nil
+}
+
+func putGameLinks(APIstub shim.ChaincodeStubInterface, gameID string, links GameLinks) error {
+	jsonData, err := json.Marshal(links)
+	if err != nil {
+		return fmt.Errorf("Could not marshal the links of game < %s >. Error: %s", gameID, err.Error())
+	}
+
+	key, err := gameKey(APIstub, LINK_INDEX, gameID)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, jsonData)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+
+	"github.com/stefanprisca/strategy-code/mcts"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+// searchState adapts the contract to the tree search. It uses the same
+// validation and state transitions as the move transaction.
+type searchState struct {
+	board    Board
+	contract tttPb.TttContract
+}
+
+func (s searchState) mark() tttPb.Mark {
+	if s.contract.State == tttPb.TttContract_OTURN {
+		return tttPb.Mark_O
+	}
+	return tttPb.Mark_X
+}
+
+func (s searchState) Player() int {
+	return int(s.mark())
+}
+
+func (s searchState) LegalMoves() []mcts.Move {
+	moves := []mcts.Move{}
+	if contractTerminated(s.contract) {
+		return moves
+	}
+
+	// The mark always matches the turn, so the empty positions are the
+	// moves validateMoveArgs accepts. Checking them all with it would
+	// dominate the rollouts on large boards.
+	for i, m := range s.contract.Positions {
+		if m == tttPb.Mark_E {
+			moves = append(moves, tttPb.MoveTrxPayload{Position: int32(i), Mark: s.mark()})
+		}
+	}
+	return moves
+}
+
+func (s searchState) Apply(move mcts.Move) (mcts.State, error) {
+	payload := move.(tttPb.MoveTrxPayload)
+	if err := validateMoveArgs(s.contract, payload); err != nil {
+		return nil, err
+	}
+
+	newContract, err := applyMove(s.board, s.contract, payload)
+	if err != nil {
+		return nil, err
+	}
+	return searchState{s.board, newContract}, nil
+}
+
+func (s searchState) Terminal() bool {
+	return contractTerminated(s.contract)
+}
+
+// Reward is 1 for a win, 0.5 for a tie and 0 for a loss.
+func (s searchState) Reward(player int) float64 {
+	switch s.contract.State {
+	case tttPb.TttContract_XWON:
+		if player == int(tttPb.Mark_X) {
+			return 1
+		}
+		return 0
+	case tttPb.TttContract_OWON:
+		if player == int(tttPb.Mark_O) {
+			return 1
+		}
+		return 0
+	}
+	return 0.5
+}
+
+// searchMove returns the move found by the tree search for the player to move.
+func searchMove(board Board, contract tttPb.TttContract, cfg mcts.Config) (tttPb.MoveTrxPayload, error) {
+	if contractTerminated(contract) {
+		return tttPb.MoveTrxPayload{}, fmt.Errorf("Contract already terminated with state %v", contract.State)
+	}
+
+	result, err := mcts.Search(searchState{board, contract}, cfg)
+	if err != nil {
+		return tttPb.MoveTrxPayload{}, err
+	}
+	return result.Move.(tttPb.MoveTrxPayload), nil
+}
+
+// SEARCH_ITERATIONS and SEARCH_ROLLOUT_DEPTH are the budget of the tree
+// search behind the hints of positions too large to solve.
+const (
+	SEARCH_ITERATIONS    = 1000
+	SEARCH_ROLLOUT_DEPTH = 40
+)
+
+// searchHint hints the move found by the tree search. The search is seeded
+// by the position, so that every peer answers the same hint.
+func searchHint(board Board, contract tttPb.TttContract) (Hint, error) {
+	position := fmt.Sprintf("%v%v%v", board, contract.State, contract.Positions)
+	move, err := searchMove(board, contract, mcts.Config{
+		Iterations:   SEARCH_ITERATIONS,
+		RolloutDepth: SEARCH_ROLLOUT_DEPTH,
+		Rnd:          rand.New(rand.NewSource(int64(crc32.ChecksumIEEE([]byte(position))))),
+	})
+	if err != nil {
+		return Hint{}, err
+	}
+	return Hint{Position: move.Position, Mark: move.Mark, Outcome: UNKNOWN}, nil
+}
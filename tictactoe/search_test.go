@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/stefanprisca/strategy-code/mcts"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	X = tttPb.Mark_X
+	O = tttPb.Mark_O
+	E = tttPb.Mark_E
+)
+
+func searchConfig() mcts.Config {
+	return mcts.Config{
+		Iterations: 2000,
+		Rnd:        rand.New(rand.NewSource(1)),
+	}
+}
+
+func TestSearchTakesTheWin(t *testing.T) {
+	contract := tttPb.TttContract{
+		State: tttPb.TttContract_XTURN,
+		Positions: []tttPb.Mark{
+			X, X, E,
+			O, O, E,
+			E, E, E},
+	}
+	move, err := searchMove(defaultBoard, contract, searchConfig())
+	require.NoError(t, err)
+	require.Equal(t, tttPb.MoveTrxPayload{Position: 2, Mark: X}, move)
+}
+
+func TestSearchBlocks(t *testing.T) {
+	contract := tttPb.TttContract{
+		State: tttPb.TttContract_OTURN,
+		Positions: []tttPb.Mark{
+			X, E, E,
+			E, X, E,
+			E, E, O},
+	}
+	move, err := searchMove(defaultBoard, contract, searchConfig())
+	require.NoError(t, err)
+	require.Contains(t, []int32{2, 6}, move.Position,
+		"expected O to take a corner")
+}
+
+func TestSearchSelfPlayTies(t *testing.T) {
+	stub := initContract(t)
+	contract, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+
+	for !contractTerminated(*contract) {
+		move, err := searchMove(defaultBoard, *contract, searchConfig())
+		require.NoError(t, err)
+
+		resp, err := newMoveArgsBuilder("search", move.Position, move.Mark).invoke(stub)
+		require.NoError(t, err)
+		require.EqualValues(t, 200, resp.Status, resp.Message)
+
+		contract, err = getLedgerContract(stub, testGameID)
+		require.NoError(t, err)
+	}
+	require.Equal(t, tttPb.TttContract_TIE, contract.State)
+}
+
+func TestApplyMoveKeepsTheOldPositions(t *testing.T) {
+	contract := tttPb.TttContract{
+		State:     tttPb.TttContract_XTURN,
+		Positions: []tttPb.Mark{E, E, E, E, E, E, E, E, E},
+	}
+	_, err := applyMove(defaultBoard, contract, tttPb.MoveTrxPayload{Position: 4, Mark: X})
+	require.NoError(t, err)
+	require.Equal(t, E, contract.Positions[4])
+}
+
+func TestHintSearchesLargeBoards(t *testing.T) {
+	stub := initBoardContract(t, xFirst, 10, 10, 5)
+	marks := []tttPb.Mark{X, O}
+	for i, pos := range []int32{41, 0, 42, 99, 43, 9, 44, 90} {
+		_, err := newMoveArgsBuilder(strconv.Itoa(i), pos, marks[i%2]).invoke(stub)
+		require.NoError(t, err)
+	}
+
+	hint := func() Hint {
+		resp := stub.MockInvoke("hint", [][]byte{[]byte(HINT_FCN), []byte(testGameID)})
+		require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+		h := Hint{}
+		require.NoError(t, json.Unmarshal(resp.Payload, &h))
+		return h
+	}
+
+	// Far too many empty positions to solve, but X completes the row
+	h := hint()
+	require.Equal(t, UNKNOWN, h.Outcome)
+	require.Equal(t, X, h.Mark)
+	require.Contains(t, []int32{40, 45}, h.Position)
+	require.Equal(t, h, hint(), "expected every peer to answer the same hint")
+}
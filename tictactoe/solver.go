@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+// HINT_FCN is the function name of the read-only hint query. It takes
+// the game ID as second argument.
+const HINT_FCN = "hint"
+
+// Outcome is the result of the game under perfect play,
+// for the player to move.
+type Outcome string
+
+const (
+	WIN  Outcome = "WIN"
+	DRAW Outcome = "DRAW"
+	LOSS Outcome = "LOSS"
+	// UNKNOWN is the outcome of searched hints, which are not solved.
+	UNKNOWN Outcome = "UNKNOWN"
+)
+
+// Hint is the optimal move from the current position, and where it
+// leads under perfect play. Positions too large to solve get the move
+// found by the tree search instead, with an UNKNOWN outcome.
+type Hint struct {
+	Position int32      `json:"position"`
+	Mark     tttPb.Mark `json:"mark"`
+	Outcome  Outcome    `json:"outcome"`
+}
+
+func hint(APIstub shim.ChaincodeStubInterface) pb.Response {
+	gameID, err := gameIDArg(APIstub, 1)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	contract, err := getLedgerContract(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	board, err := getLedgerBoard(APIstub, gameID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	h, err := solveHint(board, *contract)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, err := json.Marshal(h)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("Could not marshal the hint. Error: %s", err.Error()))
+	}
+	return shim.Success(jsonData)
+}
+
+// MAX_SOLVE_EMPTY bounds the empty positions the solver searches from.
+// Larger boards have far too many states to solve exhaustively.
+const MAX_SOLVE_EMPTY = 12
+
+func solveHint(board Board, contract tttPb.TttContract) (Hint, error) {
+	if contractTerminated(contract) {
+		return Hint{}, fmt.Errorf("Contract already terminated with state %v", contract.State)
+	}
+
+	if countEmpty(contract.Positions) > MAX_SOLVE_EMPTY {
+		return searchHint(board, contract)
+	}
+
+	mark := tttPb.Mark_X
+	if contract.State == tttPb.TttContract_OTURN {
+		mark = tttPb.Mark_O
+	}
+
+	s := tttSolver.solve(board, contract.Positions, mark)
+	return Hint{Position: s.position, Mark: mark, Outcome: s.outcome()}, nil
+}
+
+// solution is the minimax value of a position for the player to move.
+// Wins score higher the sooner they come, and losses the later.
+type solution struct {
+	score    int
+	position int32
+}
+
+func (s solution) outcome() Outcome {
+	switch {
+	case s.score > 0:
+		return WIN
+	case s.score < 0:
+		return LOSS
+	}
+	return DRAW
+}
+
+// MAX_SOLVER_MEMO bounds the solutions the solver keeps across hints.
+// The memo is dropped once full, which only costs solving again.
+const MAX_SOLVER_MEMO = 1 << 18
+
+// solver memoizes the solutions by board state. Endorsements may run
+// in parallel, hence the lock.
+type solver struct {
+	mu   sync.Mutex
+	memo map[string]solution
+}
+
+var tttSolver = &solver{memo: make(map[string]solution)}
+
+func (s *solver) solve(board Board, positions []tttPb.Mark, toMove tttPb.Mark) solution {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.solveLocked(board, positions, toMove)
+}
+
+func (s *solver) solveLocked(board Board, positions []tttPb.Mark, toMove tttPb.Mark) solution {
+	key := fmt.Sprintf("%v%v%v", board, toMove, positions)
+	if sol, ok := s.memo[key]; ok {
+		return sol
+	}
+
+	sol := solution{position: -1}
+	empty := countEmpty(positions)
+
+	if _, won := lineWinner(board, positions); won {
+		// The previous player completed a line
+		sol.score = -(empty + 1)
+	} else if empty > 0 {
+		next := opponent(toMove)
+		for i, m := range positions {
+			if m != tttPb.Mark_E {
+				continue
+			}
+
+			child := make([]tttPb.Mark, len(positions))
+			copy(child, positions)
+			child[i] = toMove
+
+			score := -s.solveLocked(board, child, next).score
+			if sol.position < 0 || score > sol.score {
+				sol = solution{score: score, position: int32(i)}
+			}
+		}
+	}
+
+	if len(s.memo) >= MAX_SOLVER_MEMO {
+		s.memo = make(map[string]solution)
+	}
+	s.memo[key] = sol
+	return sol
+}
+
+func opponent(m tttPb.Mark) tttPb.Mark {
+	if m == tttPb.Mark_X {
+		return tttPb.Mark_O
+	}
+	return tttPb.Mark_X
+}
+
+func countEmpty(positions []tttPb.Mark) int {
+	empty := 0
+	for _, m := range positions {
+		if m == tttPb.Mark_E {
+			empty++
+		}
+	}
+	return empty
+}
+
+// lineWinner scans the whole board for K in a row. The contract only
+// checks the lines through the last move, so the solver can be held
+// against it.
+func lineWinner(board Board, positions []tttPb.Mark) (tttPb.Mark, bool) {
+	for start, m := range positions {
+		if m == tttPb.Mark_E {
+			continue
+		}
+		row, col := start/board.Cols, start%board.Cols
+		for _, d := range lineDirections {
+			endRow, endCol := row+(board.K-1)*d[0], col+(board.K-1)*d[1]
+			if endRow >= board.Rows || endCol < 0 || endCol >= board.Cols {
+				continue
+			}
+
+			i := 1
+			for ; i < board.K; i++ {
+				if positions[(row+i*d[0])*board.Cols+col+i*d[1]] != m {
+					break
+				}
+			}
+			if i == board.K {
+				return m, true
+			}
+		}
+	}
+	return tttPb.Mark_E, false
+}
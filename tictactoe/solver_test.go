@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSolveEmptyBoard(t *testing.T) {
+	h, err := solveHint(defaultBoard, tttPb.TttContract{
+		State:     tttPb.TttContract_XTURN,
+		Positions: []tttPb.Mark{E, E, E, E, E, E, E, E, E},
+	})
+	require.NoError(t, err)
+	require.Equal(t, DRAW, h.Outcome)
+	require.Equal(t, X, h.Mark)
+}
+
+func TestSolveFindsTheWin(t *testing.T) {
+	h, err := solveHint(defaultBoard, tttPb.TttContract{
+		State: tttPb.TttContract_OTURN,
+		Positions: []tttPb.Mark{
+			X, X, E,
+			O, O, E,
+			X, E, E},
+	})
+	require.NoError(t, err)
+	require.Equal(t, Hint{Position: 5, Mark: O, Outcome: WIN}, h)
+}
+
+func TestSolveLostPosition(t *testing.T) {
+	// X has two open lines, O can only block one
+	h, err := solveHint(defaultBoard, tttPb.TttContract{
+		State: tttPb.TttContract_OTURN,
+		Positions: []tttPb.Mark{
+			X, E, X,
+			E, O, E,
+			X, E, O},
+	})
+	require.NoError(t, err)
+	require.Equal(t, LOSS, h.Outcome)
+}
+
+func TestSolverMemoIsBounded(t *testing.T) {
+	s := &solver{memo: make(map[string]solution)}
+	for i := 0; i < MAX_SOLVER_MEMO; i++ {
+		s.memo[strconv.Itoa(i)] = solution{}
+	}
+
+	// A full memo is dropped rather than grown
+	positions := []tttPb.Mark{X, O, X, O, X, O, E, E, E}
+	sol := s.solve(defaultBoard, positions, X)
+	require.Equal(t, WIN, sol.outcome())
+	require.True(t, len(s.memo) <= MAX_SOLVER_MEMO, "memo grew to %v", len(s.memo))
+	require.Equal(t, sol, s.memo[fmt.Sprintf("%v%v%v", defaultBoard, X, positions)])
+}
+
+func TestSolveTerminatedContract(t *testing.T) {
+	_, err := solveHint(defaultBoard, tttPb.TttContract{
+		State:     tttPb.TttContract_XWON,
+		Positions: []tttPb.Mark{X, X, X, O, O, E, E, E, E},
+	})
+	require.Error(t, err)
+}
+
+// Random games on the contract must end exactly when the solver
+// sees a completed line or a full board, and perfect play must
+// keep the outcome the solver predicts.
+func TestContractAgreesWithSolver(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	for g := 0; g < 200; g++ {
+		stub := initContract(t)
+		contract, err := getLedgerContract(stub, testGameID)
+		require.NoError(t, err)
+
+		for i := 0; !contractTerminated(*contract); i++ {
+			h, err := solveHint(defaultBoard, *contract)
+			require.NoError(t, err)
+
+			move := tttPb.MoveTrxPayload{Position: h.Position, Mark: h.Mark}
+			if rnd.Intn(2) == 0 {
+				empty := []int32{}
+				for p, m := range contract.Positions {
+					if m == E {
+						empty = append(empty, int32(p))
+					}
+				}
+				move.Position = empty[rnd.Intn(len(empty))]
+			}
+
+			_, err = newMoveArgsBuilder(strconv.Itoa(i), move.Position, move.Mark).invoke(stub)
+			require.NoError(t, err)
+			next, err := getLedgerContract(stub, testGameID)
+			require.NoError(t, err)
+
+			winner, won := lineWinner(defaultBoard, next.Positions)
+			switch {
+			case won && winner == X:
+				require.Equal(t, tttPb.TttContract_XWON, next.State, "board %v", next.Positions)
+			case won && winner == O:
+				require.Equal(t, tttPb.TttContract_OWON, next.State, "board %v", next.Positions)
+			case countEmpty(next.Positions) == 0:
+				require.Equal(t, tttPb.TttContract_TIE, next.State, "board %v", next.Positions)
+			default:
+				require.False(t, contractTerminated(*next), "board %v", next.Positions)
+
+				// The hinted move keeps the predicted outcome
+				if move.Position == h.Position {
+					nextHint, err := solveHint(defaultBoard, *next)
+					require.NoError(t, err)
+					require.Equal(t, map[Outcome]Outcome{WIN: LOSS, DRAW: DRAW, LOSS: WIN}[h.Outcome],
+						nextHint.Outcome)
+				}
+			}
+			contract = next
+		}
+	}
+}
+
+func TestHintQuery(t *testing.T) {
+	stub := initContract(t)
+	_, err := newMoveArgsBuilder("1", 0, X).invoke(stub)
+	require.NoError(t, err)
+
+	resp := stub.MockInvoke("hint", [][]byte{[]byte(HINT_FCN), []byte(testGameID)})
+	require.EqualValues(t, shim.OK, resp.Status, resp.Message)
+
+	h := Hint{}
+	require.NoError(t, json.Unmarshal(resp.Payload, &h))
+	require.Equal(t, O, h.Mark)
+	require.Equal(t, DRAW, h.Outcome)
+	require.EqualValues(t, 4, h.Position, "the only drawing reply to a corner is the center")
+
+	contract, err := getLedgerContract(stub, testGameID)
+	require.NoError(t, err)
+	require.Equal(t, tttPb.TttContract_OTURN, contract.State, "expected the hint to be read-only")
+}